@@ -0,0 +1,118 @@
+// Команда dlq -- просмотр и повторная отправка сообщений Kafka из DLQ через внутренний API сервера.
+//
+//	dlq list [-topic notifications] [-pending] [-limit 50]
+//	dlq show <id>
+//	dlq replay <id>
+//
+// Адрес сервера -- PAY_AWARE_URL (по умолчанию http://localhost:8000), токен -- INTERNAL_ACCESS_TOKEN.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = list(os.Args[2:])
+	case "show":
+		err = withID(os.Args[2:], func(id string) error { return call(http.MethodGet, "/internal/dlq/"+id) })
+	case "replay":
+		err = withID(os.Args[2:], func(id string) error { return call(http.MethodPost, "/internal/dlq/"+id+"/replay") })
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dlq:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlq list [-topic name] [-pending] [-limit n] | dlq show <id> | dlq replay <id>")
+	os.Exit(2)
+}
+
+// list выводит сообщения из DLQ
+func list(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	topic := flags.String("topic", "", "only messages from this topic")
+	pending := flags.Bool("pending", false, "only messages that have not been replayed")
+	limit := flags.Int("limit", 50, "maximum number of messages (1-200)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(*limit))
+	if *topic != "" {
+		query.Set("topic", *topic)
+	}
+	if *pending {
+		query.Set("pending", "true")
+	}
+	return call(http.MethodGet, "/internal/dlq?"+query.Encode())
+}
+
+// withID проверяет, что передан идентификатор сообщения, и вызывает run
+func withID(args []string, run func(id string) error) error {
+	if len(args) != 1 {
+		usage()
+	}
+	if _, err := strconv.ParseUint(args[0], 10, 64); err != nil {
+		return fmt.Errorf("invalid dead letter ID %q", args[0])
+	}
+	return run(args[0])
+}
+
+// call выполняет запрос к внутреннему API и печатает ответ
+func call(method, path string) error {
+	baseURL := os.Getenv("PAY_AWARE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8000"
+	}
+
+	req, err := http.NewRequest(method, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Internal-Access-Token", os.Getenv("INTERNAL_ACCESS_TOKEN"))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(body))
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+	fmt.Println(out.String())
+	return nil
+}
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
 	"os"
+	"syscall"
+	"time"
+	_ "time/tzdata" // База часовых поясов внутри бинарника: в финальном образе нет tzdata
 
+	"github.com/SergeyMilch/pay_aware/internal/bus"
 	"github.com/SergeyMilch/pay_aware/internal/config"
 	"github.com/SergeyMilch/pay_aware/internal/kafka"
+	"github.com/SergeyMilch/pay_aware/internal/leader"
+	"github.com/SergeyMilch/pay_aware/internal/lifecycle"
 	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/internal/realtime"
+	"github.com/SergeyMilch/pay_aware/internal/webhook"
 	"github.com/SergeyMilch/pay_aware/pkg/db"
 	"github.com/SergeyMilch/pay_aware/pkg/handlers"
 	"github.com/SergeyMilch/pay_aware/pkg/middleware"
@@ -13,6 +26,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// shutdownTimeout -- сколько ждём остановки всех компонентов после SIGTERM
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	env := os.Getenv("ENV")
 	if env == "" {
@@ -39,24 +55,63 @@ func main() {
 	db.InitRedis()
 	logger.Info("Connected to Redis successfully")
 
-	// Загрузка конфигурации Kafka
-	kafkaConfig := config.LoadKafkaConfig()
-	producer, err := kafka.InitKafka(kafkaConfig)
+	// Регистрируем каналы доставки уведомлений (push, email, Telegram)
+	notifier.Init()
+
+	// Фоновые задачи и подключения останавливаются при SIGTERM/SIGINT в порядке, обратном запуску:
+	// сначала HTTP и планировщики, затем получатель сообщений и отправщик push-уведомлений, в конце -- шина, Redis и Postgres
+	app := lifecycle.New()
+	app.OnStop("postgres", func(context.Context) error { return db.CloseGorm() })
+	app.OnStop("redis", func(context.Context) error {
+		db.CloseRedis()
+		return nil
+	})
+
+	// Шина сообщений между планировщиком и отправкой уведомлений: Kafka, Redis Streams или память процесса (BUS_DRIVER)
+	busConfig := config.LoadBusConfig()
+	messageBus, err := bus.Open(busConfig)
 	if err != nil {
-		logger.Error("Failed to initialize Kafka producer", "error", err)
-		return // Завершаем работу программы, если Kafka не инициализирован
+		logger.Error("Failed to initialize message bus", "driver", busConfig.Driver, "error", err)
+		app.Shutdown(shutdownTimeout)
+		return // Завершаем работу программы, если шина не инициализирована
 	}
-	defer producer.Close() // Закрываем продюсер при завершении работы
-	logger.Info("Kafka producer successfully initialized")
+	app.OnStop("message bus", func(context.Context) error { return messageBus.Close() })
+	logger.Info("Message bus successfully initialized", "driver", busConfig.Driver)
 
-	// Запуск Kafka consumer в горутине
-	go kafka.StartKafkaConsumer(kafkaConfig)
-	logger.Info("Kafka configuration loaded successfully, excluding sensitive data")
+	// Общий отправщик push-уведомлений останавливается после получателя сообщений: собранные пачки успевают уйти в Expo
+	app.OnStop("expo batcher", notifier.CloseExpoBatcher)
 
-	// Запуск планировщика уведомлений с использованием Kafka продюсера
-	go producer.StartNotificationScheduler()
+	// Запуск получателя уведомлений
+	app.Go("message consumer", func(ctx context.Context) {
+		kafka.StartConsumer(ctx, messageBus, busConfig.Topic)
+	})
+
+	// Отправка в шину сообщений, записанных планировщиком в outbox
+	producer := kafka.NewProducer(messageBus, busConfig.Topic)
+	app.Go("outbox relay", producer.StartOutboxRelay)
+
+	// Подписка на события пользователей в Redis для потока /api/notifications/stream
+	app.Go("realtime hub", realtime.Start)
+
+	// Запуск планировщика уведомлений
+	app.Go("notification scheduler", producer.StartNotificationScheduler)
 	logger.Info("Notification scheduler started with cron")
 
+	// Запуск рассылки еженедельных и ежемесячных сводок по email
+	app.Go("digest scheduler", notifier.StartDigestScheduler)
+
+	// Запуск очистки просроченных архивов с персональными данными
+	app.Go("data export cleanup", handlers.StartDataExportCleanup)
+
+	// Запуск сборки архивов с персональными данными по запросам пользователей
+	app.Go("data export worker", handlers.StartDataExportWorker)
+
+	// Запуск повторной доставки webhook-событий
+	app.Go("webhook retry worker", webhook.StartRetryWorker)
+
+	// Запуск проверки квитанций о доставке push-уведомлений
+	app.Go("push receipts poller", notifier.StartReceiptPoller)
+
 	// Создаем экземпляр Gin
 	r := gin.Default()
 
@@ -64,7 +119,8 @@ func main() {
 	corsConfig := cors.Config{
 		AllowOrigins:		[]string{os.Getenv("ADDR_SERVER")}, // Ограничение списка разрешенных доменов
 		AllowMethods: 		[]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders: 		[]string{"Authorization", "Content-Type"},
+		AllowHeaders: 		[]string{"Authorization", "Content-Type", "X-Action-Token"},
+		ExposeHeaders: 		[]string{"X-Next-Cursor"}, // Курсор следующей страницы истории уведомлений
 		AllowCredentials: 	true,
 	}
 
@@ -80,6 +136,11 @@ func main() {
 	r.POST("/forgot-password", handlers.ForgotPassword)
     r.POST("/reset-password", handlers.ResetPassword)
 	r.GET("/reset-password", handlers.PasswordResetRedirect)
+	r.GET("/data-export/:token", handlers.DownloadDataExport)
+	r.POST("/telegram/webhook", handlers.TelegramWebhook)
+	r.POST("/notifications/:id/actions", handlers.ApplyNotificationAction) // Авторизация токеном действия из уведомления
+	r.GET("/digest/unsubscribe", handlers.UnsubscribeDigest)  // Авторизация токеном отписки из письма
+	r.POST("/digest/unsubscribe", handlers.UnsubscribeDigest) // Отписка в один клик из почтового клиента
 
 	// Защищенные маршруты
 	authorized := r.Group("/")
@@ -95,11 +156,34 @@ func main() {
 		authorized.GET("/subscriptions", handlers.GetSubscriptions)
 		authorized.GET("/subscriptions/:id", handlers.GetSubscriptionByID)
 		authorized.PUT("/users/device-token", handlers.UpdateDeviceToken)
+		authorized.GET("/users/devices", handlers.GetDevices)
+		authorized.DELETE("/users/devices/:id", handlers.DeleteDevice)
+		authorized.PUT("/users/notification-channel", handlers.UpdateNotificationChannel)
+		authorized.PUT("/users/time-zone", handlers.UpdateTimeZone)
+		authorized.PUT("/users/locale", handlers.UpdateLocale)
+		authorized.GET("/users/me/notification-preferences", handlers.GetNotificationPreferences)
+		authorized.PUT("/users/me/notification-preferences", handlers.UpdateNotificationPreferences)
+		authorized.POST("/users/telegram/link-code", handlers.CreateTelegramLinkCode)
+		authorized.DELETE("/users/telegram", handlers.UnlinkTelegram)
+		authorized.GET("/webpush/vapid-public-key", handlers.GetVAPIDPublicKey)
+		authorized.POST("/webpush/subscriptions", handlers.RegisterWebPushSubscription)
+		authorized.DELETE("/webpush/subscriptions", handlers.DeleteWebPushSubscription)
+		authorized.POST("/webhooks", handlers.CreateWebhookEndpoint)
+		authorized.GET("/webhooks", handlers.GetWebhookEndpoints)
+		authorized.PUT("/webhooks/:id", handlers.UpdateWebhookEndpoint)
+		authorized.DELETE("/webhooks/:id", handlers.DeleteWebhookEndpoint)
+		authorized.GET("/webhooks/:id/deliveries", handlers.GetWebhookDeliveries)
 		authorized.POST("/set-pin", handlers.SetPin)
 		authorized.GET("/api/notifications", handlers.GetUserNotifications)
 		authorized.POST("/api/notifications/:id/read", handlers.MarkNotificationAsRead)
+		authorized.GET("/api/notifications/unread-count", handlers.GetUnreadNotificationsCount)
+		authorized.GET("/api/notifications/stream", handlers.StreamNotifications) // Server-Sent Events
+		authorized.POST("/api/notifications/read-all", handlers.MarkAllNotificationsAsRead)
+		authorized.DELETE("/api/notifications", handlers.DeleteNotifications)
+		authorized.DELETE("/api/notifications/:id", handlers.DeleteNotification)
 		authorized.PUT("/users/logout", handlers.LogoutUser)
 		authorized.DELETE("/users", handlers.DeleteUserAccount)
+		authorized.POST("/users/me/data-export", handlers.RequestDataExport)
 		// При больших нагрузках на клиент, можно будет перейти на серверный подход
 		// authorized.GET("/subscriptions/total-cost", handlers.GetTotalCost)   <-- расчет общей стоимости реализован на фронтенде
 	}
@@ -109,10 +193,42 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
-	// Запускаем сервер
-	logger.Info("Starting server on port 8000")
-	if err := r.Run("0.0.0.0:8000"); err != nil {
-		logger.Error("Failed to start server", "error", err)
+	// Кто из экземпляров держит аренды лидерства (планировщик уведомлений)
+	r.GET("/internal/leader", middleware.InternalAccessMiddleware(), func(c *gin.Context) {
+		c.JSON(200, gin.H{"leases": leader.Statuses(c.Request.Context())})
+	})
+
+	// Сообщения Kafka, попавшие в DLQ: просмотр и повторная отправка (см. также cmd/dlq)
+	dlq := r.Group("/internal/dlq", middleware.InternalAccessMiddleware())
+	{
+		dlq.GET("", handlers.GetDeadLetters)
+		dlq.GET("/:id", handlers.GetDeadLetter)
+		dlq.POST("/:id/replay", handlers.ReplayDeadLetter)
 	}
 
+	// Запускаем сервер. При остановке он перестаёт принимать соединения и дожидается текущих запросов;
+	// контексты запросов отменяются, чтобы долгие потоки (Server-Sent Events) тоже завершились
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        "0.0.0.0:8000",
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return requestsCtx },
+	}
+	server.RegisterOnShutdown(cancelRequests)
+	app.OnStop("http server", server.Shutdown)
+
+	go func() {
+		logger.Info("Starting server on port 8000")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Failed to start server", "error", err)
+			app.Stop()
+		}
+	}()
+
+	app.Wait(syscall.SIGINT, syscall.SIGTERM)
+	if err := app.Shutdown(shutdownTimeout); err != nil {
+		logger.Error("Graceful shutdown finished with errors", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Server stopped gracefully")
 }
@@ -0,0 +1,112 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/config"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+)
+
+// Драйверы шины (BUS_DRIVER)
+const (
+	DriverKafka  = "kafka"
+	DriverRedis  = "redis"
+	DriverMemory = "memory"
+)
+
+// ErrClosed -- шина уже закрыта
+var ErrClosed = errors.New("message bus is closed")
+
+// redeliveryDelay -- через сколько снова доставляется сообщение, обработка которого вернула ошибку
+const redeliveryDelay = 5 * time.Second
+
+// Message -- сообщение шины
+type Message struct {
+	Topic   string
+	Key     string // Сообщения с одним ключом обрабатываются по порядку
+	Value   []byte
+	Headers map[string]string
+}
+
+// Handler обрабатывает сообщение. Без ошибки сообщение подтверждается; с ошибкой -- остаётся
+// неподтверждённым и доставляется снова: через время из RetryLater или через redeliveryDelay.
+// Следующие сообщения топика (партиции) ждут, пока это не будет обработано. Если ctx отменён,
+// получатель останавливается, и сообщение достаётся другому получателю группы.
+type Handler func(ctx context.Context, message Message) error
+
+// RetryLaterError -- сообщение ещё рано обрабатывать, см. RetryLater
+type RetryLaterError struct {
+	Delay time.Duration
+}
+
+func (e *RetryLaterError) Error() string {
+	return fmt.Sprintf("message is not ready, retry in %s", e.Delay)
+}
+
+// RetryLater возвращается обработчиком вместо ожидания внутри него: шина доставит сообщение снова
+// через delay. Ожидание прерывается остановкой получателя или (в Kafka) перебалансировкой группы.
+func RetryLater(delay time.Duration) error {
+	return &RetryLaterError{Delay: delay}
+}
+
+// Bus -- шина сообщений: публикация и получение в группе получателей
+type Bus interface {
+	// Publish отправляет сообщение и возвращается, когда шина его приняла
+	Publish(ctx context.Context, message Message) error
+	// Consume получает сообщения топиков, пока не отменён ctx. Каждое сообщение получает один
+	// получатель группы group; сообщения одного топика обрабатываются по порядку.
+	Consume(ctx context.Context, group string, topics []string, handler Handler) error
+	// Close освобождает соединения шины
+	Close() error
+}
+
+// Open создаёт шину по настройкам. Драйвер redis использует подключение db.RedisClient.
+func Open(cfg config.BusConfig) (Bus, error) {
+	switch cfg.Driver {
+	case DriverKafka:
+		return OpenKafka(cfg.Kafka)
+	case DriverRedis:
+		if db.RedisClient == nil {
+			return nil, errors.New("redis bus requires an initialized Redis client")
+		}
+		return NewRedis(db.RedisClient), nil
+	case DriverMemory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown message bus driver %q", cfg.Driver)
+	}
+}
+
+// deliver передаёт сообщение обработчику, пока тот его не примет, выдерживая паузы перед повторами.
+// Возвращает false, если ctx отменён раньше: сообщение остаётся неподтверждённым.
+func deliver(ctx context.Context, message Message, handler Handler) bool {
+	for {
+		err := handler(ctx, message)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		delay := redeliveryDelay
+		var later *RetryLaterError
+		if errors.As(err, &later) {
+			delay = later.Delay
+		} else {
+			logger.Warn("Failed to handle message, redelivering", "topic", message.Topic, "delay", delay, "error", err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
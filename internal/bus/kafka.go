@@ -0,0 +1,168 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/SergeyMilch/pay_aware/internal/config"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/utils"
+)
+
+// Kafka -- шина на Kafka
+type Kafka struct {
+	cfg      config.KafkaConfig
+	producer sarama.SyncProducer
+}
+
+// OpenKafka дожидается готовности Kafka и подключает producer
+func OpenKafka(cfg config.KafkaConfig) (*Kafka, error) {
+	kafkaBroker := cfg.Broker
+	retryTimeout := 60 * time.Second
+
+	logger.Info("Waiting for Kafka readiness before connecting...")
+	if !utils.WaitForKafkaReady(kafkaBroker, retryTimeout) {
+		logger.Error("Kafka is not ready after waiting; aborting connection attempts")
+		return nil, fmt.Errorf("kafka not ready")
+	}
+
+	retryAttempts := 3
+	sleepDuration := 5 * time.Second
+
+	var producer sarama.SyncProducer
+	err := utils.Retry(retryAttempts, sleepDuration, func() error {
+		producerConfig, err := saramaConfig(cfg)
+		if err != nil {
+			return err
+		}
+		producerConfig.Producer.Return.Successes = true
+
+		// Создание нового Kafka producer
+		producer, err = sarama.NewSyncProducer([]string{kafkaBroker}, producerConfig)
+		if err != nil {
+			logger.Warn("Failed to connect to Kafka, retrying...", "error", err)
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		logger.Error("Failed to initialize Kafka producer after retries", "error", err)
+		return nil, err
+	}
+
+	logger.Debug("Kafka producer successfully initialized", "broker", kafkaBroker, "topic", cfg.Topic)
+	return &Kafka{cfg: cfg, producer: producer}, nil
+}
+
+// Publish отправляет сообщение в Kafka
+func (k *Kafka) Publish(_ context.Context, message Message) error {
+	msg := &sarama.ProducerMessage{
+		Topic: message.Topic,
+		Value: sarama.ByteEncoder(message.Value),
+	}
+	if message.Key != "" {
+		msg.Key = sarama.StringEncoder(message.Key)
+	}
+	for name, value := range message.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(name), Value: []byte(value)})
+	}
+
+	_, _, err := k.producer.SendMessage(msg)
+	return err
+}
+
+// Consume читает топики в группе получателей Kafka, пока не отменён ctx
+func (k *Kafka) Consume(ctx context.Context, group string, topics []string, handler Handler) error {
+	retryAttempts := 3
+	sleepDuration := 5 * time.Second
+
+	return utils.Retry(retryAttempts, sleepDuration, func() error {
+		consumerConfig, err := saramaConfig(k.cfg)
+		if err != nil {
+			return err
+		}
+
+		consumer, err := sarama.NewConsumerGroup([]string{k.cfg.Broker}, group, consumerConfig)
+		if err != nil {
+			logger.Error("Error creating Kafka consumer group", "error", err)
+			return err
+		}
+		defer consumer.Close()
+
+		logger.Info("Kafka consumer initialized successfully", "group", group, "topics", topics)
+		for {
+			if err := consumer.Consume(ctx, topics, &consumerGroupHandler{handler: handler}); err != nil {
+				logger.Error("Error consuming Kafka message", "error", err)
+				return err
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+		}
+	})
+}
+
+// Close завершает соединение с Kafka producer
+func (k *Kafka) Close() error {
+	if err := k.producer.Close(); err != nil {
+		logger.Error("Failed to close Kafka producer", "error", err)
+		return err
+	}
+	logger.Info("Kafka producer closed successfully")
+	return nil
+}
+
+// saramaConfig создаёт настройки клиента Kafka
+func saramaConfig(cfg config.KafkaConfig) (*sarama.Config, error) {
+	saramaCfg := sarama.NewConfig()
+
+	// Настройка SSL, если флаг `UseSSL` установлен в true
+	if cfg.UseSSL {
+		saramaCfg.Net.TLS.Enable = true
+		tlsConfig, err := utils.CreateTLSConfiguration(cfg.Truststore, cfg.TruststorePassword)
+		if err != nil {
+			logger.Error("Failed to create TLS configuration", "error", err)
+			return nil, err
+		}
+		saramaCfg.Net.TLS.Config = tlsConfig
+	}
+	return saramaCfg, nil
+}
+
+// consumerGroupHandler передаёт сообщения партиции обработчику по порядку
+type consumerGroupHandler struct {
+	handler Handler
+}
+
+func (h *consumerGroupHandler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
+func (h *consumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
+
+func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for message := range claim.Messages() {
+		logger.Debug("Message claimed", "value", string(message.Value), "timestamp", message.Timestamp, "topic", message.Topic)
+
+		headers := make(map[string]string, len(message.Headers))
+		for _, header := range message.Headers {
+			if header != nil {
+				headers[string(header.Key)] = string(header.Value)
+			}
+		}
+
+		// Пока сообщение ждёт повтора, партиция стоит. Контекст сессии отменяется при перебалансировке,
+		// поэтому ожидание её не задерживает: сообщение не отмечено, и его получит тот, кому достанется партиция.
+		if !deliver(session.Context(), Message{
+			Topic:   message.Topic,
+			Key:     string(message.Key),
+			Value:   message.Value,
+			Headers: headers,
+		}, h.handler) {
+			return nil
+		}
+		session.MarkMessage(message, "")
+		logger.Debug("Message processed and marked", "topic", message.Topic, "offset", message.Offset)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package bus
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory -- шина в памяти процесса: для тестов и небольших установок из одного экземпляра без брокера.
+// Сообщения не переживают перезапуск. Все получатели топика образуют одну группу.
+type Memory struct {
+	mu     sync.Mutex
+	queues map[string]*memoryQueue
+	closed bool
+}
+
+// memoryQueue -- очередь сообщений одного топика
+type memoryQueue struct {
+	messages []Message
+	ready    chan struct{} // Сигнал получателям, что в очереди появились сообщения
+}
+
+// NewMemory создаёт пустую шину в памяти
+func NewMemory() *Memory {
+	return &Memory{queues: map[string]*memoryQueue{}}
+}
+
+// Publish добавляет сообщение в очередь топика
+func (m *Memory) Publish(_ context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	queue := m.queue(message.Topic)
+	queue.messages = append(queue.messages, copyMessage(message))
+	signal(queue.ready)
+	return nil
+}
+
+// Consume обрабатывает сообщения каждого топика по порядку в отдельной горутине, пока не отменён ctx.
+// Сообщение, не обработанное к остановке, возвращается в начало очереди.
+func (m *Memory) Consume(ctx context.Context, _ string, topics []string, handler Handler) error {
+	var wg sync.WaitGroup
+	for _, topic := range topics {
+		wg.Add(1)
+		go func(topic string) {
+			defer wg.Done()
+			m.consumeTopic(ctx, topic, handler)
+		}(topic)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Close закрывает шину: новые сообщения не принимаются
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// consumeTopic обрабатывает сообщения топика, пока не отменён ctx
+func (m *Memory) consumeTopic(ctx context.Context, topic string, handler Handler) {
+	for {
+		message, ready, ok := m.next(topic)
+		if !ok {
+			select {
+			case <-ready:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if !deliver(ctx, message, handler) {
+			m.requeue(message)
+			return
+		}
+	}
+}
+
+// next забирает первое сообщение топика; если очередь пуста, возвращает канал сигнала о новых сообщениях
+func (m *Memory) next(topic string) (Message, <-chan struct{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue := m.queue(topic)
+	if len(queue.messages) == 0 {
+		return Message{}, queue.ready, false
+	}
+	message := queue.messages[0]
+	queue.messages = queue.messages[1:]
+	if len(queue.messages) > 0 {
+		// Сообщения остались -- их могут забрать другие получатели топика
+		signal(queue.ready)
+	}
+	return message, queue.ready, true
+}
+
+// requeue возвращает необработанное сообщение в начало очереди
+func (m *Memory) requeue(message Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue := m.queue(message.Topic)
+	queue.messages = append([]Message{message}, queue.messages...)
+	signal(queue.ready)
+}
+
+// queue возвращает очередь топика, создавая её при необходимости. Вызывается под m.mu.
+func (m *Memory) queue(topic string) *memoryQueue {
+	queue, ok := m.queues[topic]
+	if !ok {
+		queue = &memoryQueue{ready: make(chan struct{}, 1)}
+		m.queues[topic] = queue
+	}
+	return queue
+}
+
+// signal будит одного ждущего получателя, не блокируясь
+func signal(ready chan struct{}) {
+	select {
+	case ready <- struct{}{}:
+	default:
+	}
+}
+
+// copyMessage копирует сообщение, чтобы отправитель мог менять свои данные после Publish
+func copyMessage(message Message) Message {
+	copied := message
+	copied.Value = append([]byte(nil), message.Value...)
+	if message.Headers != nil {
+		copied.Headers = make(map[string]string, len(message.Headers))
+		for name, value := range message.Headers {
+			copied.Headers[name] = value
+		}
+	}
+	return copied
+}
@@ -0,0 +1,133 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/bus"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+// collect запускает получателя и возвращает полученные сообщения, когда их наберётся want
+func collect(t *testing.T, b bus.Bus, topics []string, want int) []bus.Message {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var received []bus.Message
+	done := make(chan struct{})
+	go func() {
+		b.Consume(ctx, "test", topics, func(_ context.Context, message bus.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, message)
+			if len(received) == want {
+				close(done)
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for messages")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return received
+}
+
+func TestMemoryDeliversInOrderIncludingEarlierMessages(t *testing.T) {
+	b := bus.NewMemory()
+	ctx := context.Background()
+
+	// Сообщения, опубликованные до запуска получателя, не теряются
+	headers := map[string]string{"x-attempt": "1"}
+	assert.NoError(t, b.Publish(ctx, bus.Message{Topic: "notifications", Key: "7", Value: []byte("first"), Headers: headers}))
+	assert.NoError(t, b.Publish(ctx, bus.Message{Topic: "notifications", Value: []byte("second")}))
+	headers["x-attempt"] = "2"
+
+	received := collect(t, b, []string{"notifications"}, 2)
+	assert.Equal(t, "first", string(received[0].Value))
+	assert.Equal(t, "7", received[0].Key)
+	assert.Equal(t, "1", received[0].Headers["x-attempt"])
+	assert.Equal(t, "second", string(received[1].Value))
+}
+
+func TestMemoryRedeliversUnacknowledgedMessage(t *testing.T) {
+	b := bus.NewMemory()
+	ctx := context.Background()
+	assert.NoError(t, b.Publish(ctx, bus.Message{Topic: "notifications", Value: []byte("first")}))
+	assert.NoError(t, b.Publish(ctx, bus.Message{Topic: "notifications", Value: []byte("second")}))
+
+	// Получатель останавливается, не подтвердив сообщение
+	stopCtx, stop := context.WithCancel(ctx)
+	err := b.Consume(stopCtx, "test", []string{"notifications"}, func(_ context.Context, _ bus.Message) error {
+		stop()
+		return errors.New("shutting down")
+	})
+	assert.NoError(t, err)
+
+	received := collect(t, b, []string{"notifications"}, 2)
+	assert.Equal(t, "first", string(received[0].Value))
+	assert.Equal(t, "second", string(received[1].Value))
+}
+
+func TestMemoryRetriesMessageLater(t *testing.T) {
+	b := bus.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, b.Publish(ctx, bus.Message{Topic: "notifications.retry.1m", Value: []byte("retry")}))
+
+	var attempts []time.Time
+	done := make(chan struct{})
+	go b.Consume(ctx, "test", []string{"notifications.retry.1m"}, func(_ context.Context, _ bus.Message) error {
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 1 {
+			return bus.RetryLater(50 * time.Millisecond)
+		}
+		close(done)
+		return nil
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Message was not redelivered")
+	}
+	assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), 50*time.Millisecond)
+}
+
+func TestMemoryStopsOnCancelAndRejectsAfterClose(t *testing.T) {
+	b := bus.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stopped := make(chan struct{})
+	go func() {
+		b.Consume(ctx, "test", []string{"notifications", "notifications.retry.1m"}, func(_ context.Context, _ bus.Message) error {
+			return nil
+		})
+		close(stopped)
+	}()
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Consume did not stop after cancel")
+	}
+
+	assert.NoError(t, b.Close())
+	assert.ErrorIs(t, b.Publish(context.Background(), bus.Message{Topic: "notifications"}), bus.ErrClosed)
+}
@@ -0,0 +1,201 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisStreamPrefix  = "bus:"          // Поток Redis для топика: bus:<topic>
+	redisStreamMaxLen  = 100000          // Поток обрезается примерно до этой длины
+	redisReadBlock     = 5 * time.Second // Сколько ждём новых сообщений за один запрос
+	redisReadCount     = 10
+	redisClaimIdle     = 5 * time.Minute // Неподтверждённое столько времени сообщение забирает другой получатель
+	redisClaimInterval = 30 * time.Second
+	redisKeepAlive     = time.Minute // Как часто продлеваем сообщение, которое ещё обрабатывается
+)
+
+// Redis -- шина на Redis Streams: топик -- поток, группа получателей -- группа потока.
+// Сообщения упавшего экземпляра, оставшиеся неподтверждёнными, через redisClaimIdle забирает другой.
+type Redis struct {
+	client   *redis.Client
+	consumer string // Имя получателя в группе: у каждого экземпляра своё
+}
+
+// NewRedis создаёт шину на Redis Streams
+func NewRedis(client *redis.Client) *Redis {
+	hostname, _ := os.Hostname()
+	return &Redis{client: client, consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid())}
+}
+
+// Publish добавляет сообщение в поток топика
+func (r *Redis) Publish(ctx context.Context, message Message) error {
+	headers, err := json.Marshal(message.Headers)
+	if err != nil {
+		return err
+	}
+	return r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: redisStreamPrefix + message.Topic,
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"key":     message.Key,
+			"value":   message.Value,
+			"headers": string(headers),
+		},
+	}).Err()
+}
+
+// Consume обрабатывает сообщения каждого топика по порядку в отдельной горутине, пока не отменён ctx
+func (r *Redis) Consume(ctx context.Context, group string, topics []string, handler Handler) error {
+	for _, topic := range topics {
+		// Группа читает поток с начала: сообщения, записанные до первого запуска получателя, не теряются
+		err := r.client.XGroupCreateMkStream(ctx, redisStreamPrefix+topic, group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create consumer group for %s: %w", topic, err)
+		}
+	}
+
+	logger.Info("Redis Streams consumer initialized successfully", "group", group, "topics", topics, "consumer", r.consumer)
+	var wg sync.WaitGroup
+	for _, topic := range topics {
+		wg.Add(1)
+		go func(topic string) {
+			defer wg.Done()
+			r.consumeTopic(ctx, group, topic, handler)
+		}(topic)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Close ничего не делает: подключение к Redis общее и закрывается отдельно
+func (r *Redis) Close() error {
+	return nil
+}
+
+// consumeTopic читает поток топика, пока не отменён ctx
+func (r *Redis) consumeTopic(ctx context.Context, group, topic string, handler Handler) {
+	stream := redisStreamPrefix + topic
+	lastClaim := time.Time{}
+
+	for ctx.Err() == nil {
+		var messages []redis.XMessage
+
+		// Сначала -- брошенные сообщения упавших получателей
+		if time.Since(lastClaim) >= redisClaimInterval {
+			lastClaim = time.Now()
+			claimed, _, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   stream,
+				Group:    group,
+				Consumer: r.consumer,
+				MinIdle:  redisClaimIdle,
+				Start:    "0",
+				Count:    redisReadCount,
+			}).Result()
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Failed to claim abandoned stream messages", "stream", stream, "error", err)
+			}
+			messages = claimed
+		}
+
+		if len(messages) == 0 {
+			streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group:    group,
+				Consumer: r.consumer,
+				Streams:  []string{stream, ">"},
+				Count:    redisReadCount,
+				Block:    redisReadBlock,
+			}).Result()
+			if err != nil {
+				if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+					continue
+				}
+				logger.Error("Failed to read stream messages", "stream", stream, "error", err)
+				select {
+				case <-time.After(redisReadBlock):
+				case <-ctx.Done():
+				}
+				continue
+			}
+			for _, s := range streams {
+				messages = append(messages, s.Messages...)
+			}
+		}
+
+		for i := range messages {
+			if !r.handle(ctx, group, stream, topic, messages[i:], handler) {
+				// Сообщения остались неподтверждёнными: их заберёт XAUTOCLAIM
+				return
+			}
+		}
+	}
+}
+
+// handle передаёт обработчику первое сообщение из pending и подтверждает его. Пока оно обрабатывается
+// или ждёт повтора, продлеваются все сообщения pending: они уже выданы этому получателю,
+// и иначе через redisClaimIdle их забрал бы и обработал повторно другой получатель.
+func (r *Redis) handle(ctx context.Context, group, stream, topic string, pending []redis.XMessage, handler Handler) bool {
+	message := pending[0]
+	ids := make([]string, 0, len(pending))
+	for _, held := range pending {
+		ids = append(ids, held.ID)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(redisKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.client.XClaimJustID(ctx, &redis.XClaimArgs{
+					Stream:   stream,
+					Group:    group,
+					Consumer: r.consumer,
+					Messages: ids,
+				}).Err(); err != nil && ctx.Err() == nil {
+					logger.Warn("Failed to extend stream messages", "stream", stream, "messageID", message.ID, "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if !deliver(ctx, decodeStreamMessage(topic, message), handler) {
+		return false
+	}
+
+	if err := r.client.XAck(ctx, stream, group, message.ID).Err(); err != nil {
+		logger.Error("Failed to acknowledge stream message", "stream", stream, "messageID", message.ID, "error", err)
+	}
+	return true
+}
+
+// decodeStreamMessage собирает сообщение шины из записи потока
+func decodeStreamMessage(topic string, message redis.XMessage) Message {
+	decoded := Message{Topic: topic, Headers: map[string]string{}}
+	if key, ok := message.Values["key"].(string); ok {
+		decoded.Key = key
+	}
+	if value, ok := message.Values["value"].(string); ok {
+		decoded.Value = []byte(value)
+	}
+	if headers, ok := message.Values["headers"].(string); ok && headers != "" && headers != "null" {
+		if err := json.Unmarshal([]byte(headers), &decoded.Headers); err != nil {
+			logger.Warn("Invalid stream message headers", "topic", topic, "messageID", message.ID, "error", err)
+		}
+	}
+	return decoded
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"os"
+)
+
+// BusConfig -- настройки шины сообщений между планировщиком и отправкой уведомлений
+type BusConfig struct {
+	Driver string // "kafka" (по умолчанию), "redis" (Redis Streams) или "memory" (в памяти процесса)
+	Topic  string
+	Kafka  KafkaConfig // Только для драйвера kafka
+}
+
+// LoadBusConfig загружает настройки шины. Драйвер задаётся BUS_DRIVER;
+// для драйверов без Kafka переменные KAFKA_* не обязательны.
+func LoadBusConfig() BusConfig {
+	driver := os.Getenv("BUS_DRIVER")
+	if driver == "" {
+		driver = "kafka"
+	}
+
+	if driver == "kafka" {
+		kafkaConfig := LoadKafkaConfig()
+		return BusConfig{Driver: driver, Topic: kafkaConfig.Topic, Kafka: kafkaConfig}
+	}
+
+	topic := os.Getenv("KAFKA_TOPIC")
+	if topic == "" {
+		topic = "notifications"
+	}
+	return BusConfig{Driver: driver, Topic: topic}
+}
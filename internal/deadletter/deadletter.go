@@ -0,0 +1,189 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/outbox"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"gorm.io/gorm"
+)
+
+// Заголовки сообщений, отправленных на повтор или в DLQ
+const (
+	HeaderAttempt       = "x-attempt"        // Номер повторной попытки; у исходного сообщения заголовка нет
+	HeaderNotBefore     = "x-not-before"     // Раньше этого момента (unix, мс) сообщение не обрабатывается
+	HeaderError         = "x-error"          // Ошибка последней попытки
+	HeaderOriginalTopic = "x-original-topic" // Топик, в который сообщение было отправлено изначально
+	HeaderDeadLetterID  = "x-dead-letter-id" // Запись в dead_letters, по которой сообщение можно отправить повторно
+)
+
+// Delays -- задержки перед повторными попытками. Каждой соответствует свой топик,
+// после последней сообщение уходит в DLQ.
+var Delays = []time.Duration{time.Minute, 10 * time.Minute, time.Hour}
+
+// ErrPermanent -- сообщение невозможно обработать (например, оно не проходит проверку по схеме):
+// повторять бессмысленно, оно сразу уходит в DLQ
+var ErrPermanent = errors.New("message cannot be processed")
+
+// Failure -- неудачная обработка сообщения
+type Failure struct {
+	Topic   string // Исходный топик (не топик повтора)
+	Key     string
+	Payload []byte
+	Attempt int // Номер неудачной попытки: 0 -- исходное сообщение
+	Err     error
+}
+
+// RetryTopic возвращает топик повторов с задержкой delay, например "notifications.retry.10m"
+func RetryTopic(topic string, delay time.Duration) string {
+	return topic + ".retry." + formatDelay(delay)
+}
+
+// Topic возвращает топик DLQ для топика topic
+func Topic(topic string) string {
+	return topic + ".dlq"
+}
+
+// Topics возвращает исходный топик и все топики повторов: их читает потребитель
+func Topics(topic string) []string {
+	topics := []string{topic}
+	for _, delay := range Delays {
+		topics = append(topics, RetryTopic(topic, delay))
+	}
+	return topics
+}
+
+// Attempt возвращает номер попытки из заголовков сообщения
+func Attempt(headers map[string]string) int {
+	attempt, err := strconv.Atoi(headers[HeaderAttempt])
+	if err != nil || attempt < 0 {
+		return 0
+	}
+	return attempt
+}
+
+// NotBefore возвращает момент, раньше которого сообщение не обрабатывается (нулевой -- без ожидания)
+func NotBefore(headers map[string]string) time.Time {
+	ms, err := strconv.ParseInt(headers[HeaderNotBefore], 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// Handle отправляет сообщение на следующую попытку через топик повторов,
+// а если попытки закончились или ошибка неустранима -- в DLQ.
+// Сообщение пишется в outbox, поэтому после возврата без ошибки исходное сообщение можно отмечать обработанным.
+func Handle(ctx context.Context, failure Failure) error {
+	if failure.Attempt < len(Delays) && !errors.Is(failure.Err, ErrPermanent) {
+		return retry(ctx, failure)
+	}
+	return bury(ctx, failure)
+}
+
+// retry отправляет сообщение в топик повторов с задержкой, соответствующей номеру попытки
+func retry(ctx context.Context, failure Failure) error {
+	delay := Delays[failure.Attempt]
+	next := failure.Attempt + 1
+	_, err := outbox.Add(db.GormDB.WithContext(ctx), outbox.Message{
+		Topic:   RetryTopic(failure.Topic, delay),
+		Key:     failure.Key,
+		Payload: failure.Payload,
+		Headers: map[string]string{
+			HeaderAttempt:       strconv.Itoa(next),
+			HeaderNotBefore:     strconv.FormatInt(time.Now().Add(delay).UnixMilli(), 10),
+			HeaderError:         failure.Err.Error(),
+			HeaderOriginalTopic: failure.Topic,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	outbox.Notify()
+
+	logger.Warn("Kafka message scheduled for retry", "topic", failure.Topic, "attempt", next, "retryIn", delay, "error", failure.Err)
+	return nil
+}
+
+// bury сохраняет сообщение в dead_letters и отправляет его в топик DLQ
+func bury(ctx context.Context, failure Failure) error {
+	letter := models.DeadLetter{
+		Topic:      failure.Topic,
+		MessageKey: failure.Key,
+		Payload:    string(failure.Payload),
+		Error:      failure.Err.Error(),
+		Attempts:   failure.Attempt + 1,
+	}
+
+	err := db.GormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&letter).Error; err != nil {
+			return err
+		}
+		_, err := outbox.Add(tx, outbox.Message{
+			Topic:   Topic(failure.Topic),
+			Key:     failure.Key,
+			Payload: failure.Payload,
+			Headers: map[string]string{
+				HeaderAttempt:       strconv.Itoa(failure.Attempt),
+				HeaderError:         failure.Err.Error(),
+				HeaderOriginalTopic: failure.Topic,
+				HeaderDeadLetterID:  strconv.FormatUint(uint64(letter.ID), 10),
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	outbox.Notify()
+
+	logger.Error("Kafka message moved to dead-letter queue", "topic", failure.Topic, "deadLetterID", letter.ID, "attempts", letter.Attempts, "error", failure.Err)
+	return nil
+}
+
+// Replay отправляет сообщение из DLQ в исходный топик заново, с первой попытки.
+// Если записи нет, возвращает gorm.ErrRecordNotFound.
+func Replay(ctx context.Context, id uint) (models.DeadLetter, error) {
+	var letter models.DeadLetter
+	err := db.GormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&letter, id).Error; err != nil {
+			return err
+		}
+		if _, err := outbox.Add(tx, outbox.Message{
+			Topic:   letter.Topic,
+			Key:     letter.MessageKey,
+			Payload: []byte(letter.Payload),
+		}); err != nil {
+			return err
+		}
+
+		replayedAt := time.Now().UTC()
+		letter.ReplayedAt = &replayedAt
+		return tx.Model(&letter).Update("replayed_at", replayedAt).Error
+	})
+	if err != nil {
+		return models.DeadLetter{}, err
+	}
+	outbox.Notify()
+
+	logger.Info("Dead letter replayed", "deadLetterID", letter.ID, "topic", letter.Topic)
+	return letter, nil
+}
+
+// formatDelay записывает задержку для имени топика: 1m, 10m, 1h
+func formatDelay(delay time.Duration) string {
+	switch {
+	case delay%time.Hour == 0:
+		return fmt.Sprintf("%dh", delay/time.Hour)
+	case delay%time.Minute == 0:
+		return fmt.Sprintf("%dm", delay/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", delay/time.Second)
+	}
+}
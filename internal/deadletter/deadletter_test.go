@@ -0,0 +1,144 @@
+package deadletter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/deadletter"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/outbox"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+// initDeadLetterDB создаёт таблицы outbox и DLQ в SQLite в памяти
+func initDeadLetterDB(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open("file:deadletter?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal("Failed to initialize mock database", err)
+	}
+	gormDB.Migrator().DropTable(&models.OutboxMessage{}, &models.DeadLetter{})
+	gormDB.AutoMigrate(&models.OutboxMessage{}, &models.DeadLetter{})
+
+	// SQLite не разбирает колонки timestamptz обратно в time.Time, пересоздаём их с datetime
+	for _, table := range []string{"outbox_messages", "dead_letters"} {
+		var ddl string
+		gormDB.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&ddl)
+		gormDB.Exec("DROP TABLE " + table)
+		gormDB.Exec(strings.ReplaceAll(ddl, "timestamptz", "datetime"))
+	}
+	gormDB.Exec("CREATE UNIQUE INDEX idx_outbox_messages_idempotency_key ON outbox_messages (idempotency_key)")
+	db.GormDB = gormDB
+}
+
+// lastOutboxMessage возвращает последнее записанное в outbox сообщение и его заголовки
+func lastOutboxMessage(t *testing.T) (models.OutboxMessage, map[string]string) {
+	var message models.OutboxMessage
+	if err := db.GormDB.Order("id desc").First(&message).Error; err != nil {
+		t.Fatal("Outbox is empty", err)
+	}
+	headers, err := outbox.Headers(message)
+	assert.NoError(t, err)
+	return message, headers
+}
+
+func TestTopics(t *testing.T) {
+	assert.Equal(t, []string{
+		"notifications",
+		"notifications.retry.1m",
+		"notifications.retry.10m",
+		"notifications.retry.1h",
+	}, deadletter.Topics("notifications"))
+	assert.Equal(t, "notifications.dlq", deadletter.Topic("notifications"))
+}
+
+func TestHandleRetriesWithIncreasingDelaysThenBuries(t *testing.T) {
+	initDeadLetterDB(t)
+	failure := deadletter.Failure{Topic: "notifications", Key: "7", Payload: []byte(`{"id":"e1"}`), Err: errors.New("push failed")}
+
+	for attempt, topic := range deadletter.Topics("notifications")[1:] {
+		failure.Attempt = attempt
+		before := time.Now()
+		assert.NoError(t, deadletter.Handle(context.Background(), failure))
+
+		message, headers := lastOutboxMessage(t)
+		assert.Equal(t, topic, message.Topic)
+		assert.Equal(t, "7", message.MessageKey)
+		assert.Equal(t, `{"id":"e1"}`, message.Payload)
+		assert.Equal(t, attempt+1, deadletter.Attempt(headers))
+		assert.Equal(t, "push failed", headers[deadletter.HeaderError])
+		assert.WithinDuration(t, before.Add(deadletter.Delays[attempt]), deadletter.NotBefore(headers), time.Second)
+	}
+
+	var letters int64
+	db.GormDB.Model(&models.DeadLetter{}).Count(&letters)
+	assert.Zero(t, letters)
+
+	// Попытки закончились -- сообщение сохраняется в DLQ вместе с ошибкой
+	failure.Attempt = len(deadletter.Delays)
+	assert.NoError(t, deadletter.Handle(context.Background(), failure))
+
+	var letter models.DeadLetter
+	assert.NoError(t, db.GormDB.First(&letter).Error)
+	assert.Equal(t, "notifications", letter.Topic)
+	assert.Equal(t, `{"id":"e1"}`, letter.Payload)
+	assert.Equal(t, "push failed", letter.Error)
+	assert.Equal(t, len(deadletter.Delays)+1, letter.Attempts)
+
+	message, headers := lastOutboxMessage(t)
+	assert.Equal(t, "notifications.dlq", message.Topic)
+	assert.Equal(t, fmt.Sprint(letter.ID), headers[deadletter.HeaderDeadLetterID])
+}
+
+func TestPermanentFailureSkipsRetries(t *testing.T) {
+	initDeadLetterDB(t)
+
+	err := fmt.Errorf("%w: invalid event envelope", deadletter.ErrPermanent)
+	assert.NoError(t, deadletter.Handle(context.Background(), deadletter.Failure{Topic: "notifications", Payload: []byte("{}"), Err: err}))
+
+	message, _ := lastOutboxMessage(t)
+	assert.Equal(t, "notifications.dlq", message.Topic)
+
+	var letter models.DeadLetter
+	assert.NoError(t, db.GormDB.First(&letter).Error)
+	assert.Equal(t, 1, letter.Attempts)
+}
+
+func TestReplaySendsMessageToOriginalTopic(t *testing.T) {
+	initDeadLetterDB(t)
+	assert.NoError(t, deadletter.Handle(context.Background(), deadletter.Failure{
+		Topic: "notifications", Key: "7", Payload: []byte(`{"id":"e1"}`), Attempt: len(deadletter.Delays), Err: errors.New("push failed"),
+	}))
+	var letter models.DeadLetter
+	assert.NoError(t, db.GormDB.First(&letter).Error)
+
+	replayed, err := deadletter.Replay(context.Background(), letter.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, replayed.ReplayedAt)
+
+	// Сообщение начинает с первой попытки: без заголовков повтора
+	message, headers := lastOutboxMessage(t)
+	assert.Equal(t, "notifications", message.Topic)
+	assert.Equal(t, "7", message.MessageKey)
+	assert.Equal(t, `{"id":"e1"}`, message.Payload)
+	assert.Zero(t, deadletter.Attempt(headers))
+
+	db.GormDB.First(&letter, letter.ID)
+	assert.NotNil(t, letter.ReplayedAt)
+
+	_, err = deadletter.Replay(context.Background(), letter.ID+100)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,194 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+)
+
+// Типы событий в Kafka
+const (
+	TypeReminderDue = "reminder.due" // Пора отправить напоминание о платеже
+)
+
+// Текущие версии схем событий, которые публикует сервис
+const (
+	ReminderDueVersion = 1
+)
+
+var (
+	// ErrNotEnvelope -- сообщение не в формате конверта (например, записано до его появления)
+	ErrNotEnvelope = errors.New("message is not an event envelope")
+	// ErrUnknownEvent -- тип или версия события неизвестны этому экземпляру (его опубликовал более новый сервис)
+	ErrUnknownEvent = errors.New("unknown event type or schema version")
+)
+
+// Envelope -- конверт события: одинаковые для всех событий поля и данные конкретного типа в Payload
+type Envelope struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// ReminderDue -- данные события reminder.due
+type ReminderDue struct {
+	UserID         int    `json:"user_id"`
+	SubscriptionID int    `json:"subscription_id"`
+	Message        string `json:"message"`          // Текст для истории уведомлений
+	Missed         bool   `json:"missed,omitempty"` // Напоминание опоздало больше допустимого
+	IdempotencyKey string `json:"idempotency_key"`  // Ключ напоминания за период: повторы отбрасываются
+}
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+var (
+	envelopeSchema *schema
+	payloadSchemas = map[string]*schema{} // "<type>.v<version>" -> схема данных
+)
+
+func init() {
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := schemaFiles.ReadFile("schemas/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		s, err := parseSchema(data)
+		if err != nil {
+			panic(fmt.Sprintf("invalid event schema %s: %v", entry.Name(), err))
+		}
+
+		name := entry.Name()[:len(entry.Name())-len(".json")]
+		if name == "envelope.v1" {
+			envelopeSchema = s
+			continue
+		}
+		payloadSchemas[name] = s
+	}
+	if envelopeSchema == nil {
+		panic("event envelope schema is missing")
+	}
+}
+
+// payloadSchema возвращает схему данных события; nil -- тип или версия неизвестны
+func payloadSchema(eventType string, version int) *schema {
+	return payloadSchemas[fmt.Sprintf("%s.v%d", eventType, version)]
+}
+
+// New создаёт событие и проверяет его данные по схеме. Публиковать событие без схемы нельзя.
+func New(eventType string, version int, payload interface{}) (Envelope, error) {
+	s := payloadSchema(eventType, version)
+	if s == nil {
+		return Envelope{}, fmt.Errorf("%w: %s v%d", ErrUnknownEvent, eventType, version)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	if err := s.validate(data); err != nil {
+		return Envelope{}, fmt.Errorf("invalid %s v%d payload: %w", eventType, version, err)
+	}
+
+	id, err := newEventID()
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:            id,
+		Type:          eventType,
+		SchemaVersion: version,
+		OccurredAt:    time.Now().UTC(),
+		Payload:       data,
+	}, nil
+}
+
+// Marshal создаёт событие и сериализует его для отправки
+func Marshal(eventType string, version int, payload interface{}) ([]byte, error) {
+	envelope, err := New(eventType, version, payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+
+// Decode разбирает сообщение и проверяет конверт и данные по схемам.
+// ErrNotEnvelope -- сообщение в старом формате, ErrUnknownEvent -- событие, которое этот экземпляр не знает.
+func Decode(data []byte) (Envelope, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return Envelope{}, err
+	}
+	if _, ok := probe["schema_version"]; !ok {
+		return Envelope{}, ErrNotEnvelope
+	}
+
+	if err := envelopeSchema.validate(data); err != nil {
+		return Envelope{}, fmt.Errorf("invalid event envelope: %w", err)
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return Envelope{}, err
+	}
+
+	s := payloadSchema(envelope.Type, envelope.SchemaVersion)
+	if s == nil {
+		return envelope, fmt.Errorf("%w: %s v%d", ErrUnknownEvent, envelope.Type, envelope.SchemaVersion)
+	}
+	if err := s.validate(envelope.Payload); err != nil {
+		return envelope, fmt.Errorf("invalid %s v%d payload: %w", envelope.Type, envelope.SchemaVersion, err)
+	}
+	return envelope, nil
+}
+
+// Handler обрабатывает событие одного типа
+type Handler func(ctx context.Context, envelope Envelope) error
+
+// Router передаёт события обработчикам по типу. События, которых этот экземпляр не знает,
+// пропускаются, поэтому новые типы можно публиковать до обновления всех потребителей.
+type Router struct {
+	handlers map[string]Handler
+}
+
+// NewRouter создаёт пустой маршрутизатор
+func NewRouter() *Router {
+	return &Router{handlers: map[string]Handler{}}
+}
+
+// Handle регистрирует обработчик событий типа eventType
+func (r *Router) Handle(eventType string, handler Handler) {
+	r.handlers[eventType] = handler
+}
+
+// Dispatch передаёт событие обработчику его типа. Неизвестные события пропускаются без ошибки.
+func (r *Router) Dispatch(ctx context.Context, envelope Envelope) error {
+	handler, ok := r.handlers[envelope.Type]
+	if !ok {
+		logger.Warn("No handler for event type, skipping", "type", envelope.Type, "version", envelope.SchemaVersion, "eventID", envelope.ID)
+		return nil
+	}
+	return handler(ctx, envelope)
+}
+
+// newEventID создаёт уникальный идентификатор события
+func newEventID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,95 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/SergeyMilch/pay_aware/internal/events"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+func validReminder() events.ReminderDue {
+	return events.ReminderDue{
+		UserID:         1,
+		SubscriptionID: 7,
+		Message:        "Don't forget to pay for Netflix!",
+		IdempotencyKey: "reminder:7:1700000000",
+	}
+}
+
+func TestMarshalDecodeRoundTrip(t *testing.T) {
+	data, err := events.Marshal(events.TypeReminderDue, events.ReminderDueVersion, validReminder())
+	assert.NoError(t, err)
+
+	envelope, err := events.Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, events.TypeReminderDue, envelope.Type)
+	assert.Equal(t, 1, envelope.SchemaVersion)
+	assert.NotEmpty(t, envelope.ID)
+	assert.False(t, envelope.OccurredAt.IsZero())
+
+	var payload events.ReminderDue
+	assert.NoError(t, json.Unmarshal(envelope.Payload, &payload))
+	assert.Equal(t, validReminder(), payload)
+}
+
+func TestMarshalRejectsInvalidPayload(t *testing.T) {
+	reminder := validReminder()
+	reminder.SubscriptionID = 0
+
+	_, err := events.Marshal(events.TypeReminderDue, events.ReminderDueVersion, reminder)
+	assert.ErrorContains(t, err, "$.subscription_id")
+
+	_, err = events.Marshal("reminder.unknown", 1, reminder)
+	assert.ErrorIs(t, err, events.ErrUnknownEvent)
+}
+
+func TestDecodeValidatesEnvelopeAndPayload(t *testing.T) {
+	cases := map[string]string{
+		"missing payload":    `{"id":"1","type":"reminder.due","schema_version":1,"occurred_at":"2025-01-01T00:00:00Z"}`,
+		"bad occurred_at":    `{"id":"1","type":"reminder.due","schema_version":1,"occurred_at":"yesterday","payload":{}}`,
+		"fractional version": `{"id":"1","type":"reminder.due","schema_version":1.5,"occurred_at":"2025-01-01T00:00:00Z","payload":{}}`,
+		"payload field type": `{"id":"1","type":"reminder.due","schema_version":1,"occurred_at":"2025-01-01T00:00:00Z",` +
+			`"payload":{"user_id":"1","subscription_id":7,"message":"","idempotency_key":"k"}}`,
+	}
+	for name, message := range cases {
+		_, err := events.Decode([]byte(message))
+		assert.Error(t, err, name)
+		assert.NotErrorIs(t, err, events.ErrUnknownEvent, name)
+	}
+}
+
+func TestDecodeAcceptsAdditiveFieldsAndReportsUnknownEvents(t *testing.T) {
+	// Новое необязательное поле в данных не ломает старых потребителей
+	_, err := events.Decode([]byte(`{"id":"1","type":"reminder.due","schema_version":1,"occurred_at":"2025-01-01T00:00:00Z",` +
+		`"payload":{"user_id":1,"subscription_id":7,"message":"","idempotency_key":"k","channel_hint":"push"}}`))
+	assert.NoError(t, err)
+
+	envelope, err := events.Decode([]byte(`{"id":"2","type":"reminder.due","schema_version":2,"occurred_at":"2025-01-01T00:00:00Z","payload":{}}`))
+	assert.ErrorIs(t, err, events.ErrUnknownEvent)
+	assert.Equal(t, 2, envelope.SchemaVersion)
+
+	_, err = events.Decode([]byte(`{"user_id":1,"subscription_id":7,"message":"legacy"}`))
+	assert.ErrorIs(t, err, events.ErrNotEnvelope)
+}
+
+func TestRouterDispatchesByType(t *testing.T) {
+	var handled []string
+	router := events.NewRouter()
+	router.Handle(events.TypeReminderDue, func(_ context.Context, envelope events.Envelope) error {
+		handled = append(handled, envelope.ID)
+		return nil
+	})
+
+	assert.NoError(t, router.Dispatch(context.Background(), events.Envelope{ID: "a", Type: events.TypeReminderDue}))
+	assert.NoError(t, router.Dispatch(context.Background(), events.Envelope{ID: "b", Type: "subscription.archived"}))
+	assert.Equal(t, []string{"a"}, handled)
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// schema -- подмножество JSON Schema, которым описаны события: type, required, properties,
+// additionalProperties, enum, minLength, minimum и format "date-time".
+// Остальные ключевые слова ($schema, $id, title, ...) не влияют на проверку.
+type schema struct {
+	Type                 string             `json:"type"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Enum                 []interface{}      `json:"enum"`
+	MinLength            *int               `json:"minLength"`
+	Minimum              *float64           `json:"minimum"`
+	Format               string             `json:"format"`
+}
+
+// parseSchema разбирает JSON Schema
+func parseSchema(data []byte) (*schema, error) {
+	var s schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// validate проверяет JSON-документ data по схеме
+func (s *schema) validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	return s.check("$", value)
+}
+
+// check проверяет значение value, находящееся в документе по пути path
+func (s *schema) check(path string, value interface{}) error {
+	if err := s.checkType(path, value); err != nil {
+		return err
+	}
+
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, option := range s.Enum {
+			if fmt.Sprint(option) == fmt.Sprint(value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%s: value %v is not one of %v", path, value, s.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if s.MinLength != nil && len([]rune(v)) < *s.MinLength {
+			return fmt.Errorf("%s: string is shorter than %d", path, *s.MinLength)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				return fmt.Errorf("%s: invalid date-time %q", path, v)
+			}
+		}
+
+	case json.Number:
+		if s.Minimum != nil {
+			n, _ := v.Float64()
+			if n < *s.Minimum {
+				return fmt.Errorf("%s: %v is less than minimum %v", path, v, *s.Minimum)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+
+		// Свойства обходим по порядку, чтобы ошибка для одного документа была всегда одна и та же
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, known := s.Properties[name]
+			if !known {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", path, name)
+				}
+				continue
+			}
+			if err := property.check(path+"."+name, v[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkType проверяет ключевое слово type
+func (s *schema) checkType(path string, value interface{}) error {
+	if s.Type == "" {
+		return nil
+	}
+
+	ok := false
+	switch s.Type {
+	case "object":
+		_, ok = value.(map[string]interface{})
+	case "array":
+		_, ok = value.([]interface{})
+	case "string":
+		_, ok = value.(string)
+	case "boolean":
+		_, ok = value.(bool)
+	case "null":
+		ok = value == nil
+	case "number":
+		_, ok = value.(json.Number)
+	case "integer":
+		if n, isNumber := value.(json.Number); isNumber {
+			_, err := n.Int64()
+			ok = err == nil
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", path, s.Type)
+	}
+
+	if !ok {
+		return fmt.Errorf("%s: expected %s", path, s.Type)
+	}
+	return nil
+}
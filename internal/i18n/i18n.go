@@ -0,0 +1,295 @@
+package i18n
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+)
+
+// DefaultLocale -- язык по умолчанию (для пользователей, зарегистрированных до появления локализации)
+const DefaultLocale = "ru"
+
+// DefaultCurrency -- валюта стоимости подписок
+const DefaultCurrency = "RUB"
+
+//go:embed locales/*.json
+var localesFS embed.FS
+
+// entry -- строка каталога: обычный шаблон или набор форм множественного числа
+type entry struct {
+	text  *template.Template
+	forms map[string]*template.Template // "one", "few", "many", "other"
+}
+
+// catalogs -- локаль -> ключ -> строка
+var catalogs = map[string]map[string]entry{}
+
+// SupportedLocales -- локали, для которых есть каталог
+var SupportedLocales []string
+
+func init() {
+	files, err := localesFS.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: failed to read locales: %v", err))
+	}
+
+	for _, file := range files {
+		locale := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		data, err := localesFS.ReadFile("locales/" + file.Name())
+		if err != nil {
+			panic(fmt.Sprintf("i18n: failed to read %s: %v", file.Name(), err))
+		}
+
+		catalog, err := parseCatalog(locale, data)
+		if err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", file.Name(), err))
+		}
+		catalogs[locale] = catalog
+		SupportedLocales = append(SupportedLocales, locale)
+	}
+	sort.Strings(SupportedLocales)
+}
+
+// parseCatalog разбирает JSON-каталог: значение -- строка-шаблон или объект с формами множественного числа
+func parseCatalog(locale string, data []byte) (map[string]entry, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	catalog := make(map[string]entry, len(raw))
+	for key, value := range raw {
+		var text string
+		if err := json.Unmarshal(value, &text); err == nil {
+			tmpl, err := newTemplate(locale, key, text)
+			if err != nil {
+				return nil, err
+			}
+			catalog[key] = entry{text: tmpl}
+			continue
+		}
+
+		var forms map[string]string
+		if err := json.Unmarshal(value, &forms); err != nil {
+			return nil, fmt.Errorf("key %s: expected string or plural forms", key)
+		}
+		if _, ok := forms["other"]; !ok {
+			return nil, fmt.Errorf("key %s: plural form \"other\" is required", key)
+		}
+
+		parsed := make(map[string]*template.Template, len(forms))
+		for form, text := range forms {
+			tmpl, err := newTemplate(locale, key+"."+form, text)
+			if err != nil {
+				return nil, err
+			}
+			parsed[form] = tmpl
+		}
+		catalog[key] = entry{forms: parsed}
+	}
+	return catalog, nil
+}
+
+// newTemplate компилирует строку каталога. Внутри доступна функция plural: {{plural "days" .Days}}
+func newTemplate(locale, name, text string) (*template.Template, error) {
+	return template.New(name).
+		Option("missingkey=zero").
+		Funcs(template.FuncMap{
+			"plural": func(key string, n int) string { return Plural(locale, key, n) },
+		}).
+		Parse(text)
+}
+
+// IsSupported проверяет, есть ли каталог для локали
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Normalize приводит тег языка к поддерживаемой локали: "en-US" -> "en", неизвестные -> DefaultLocale
+func Normalize(locale string) string {
+	base := strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(base, "-_"); i >= 0 {
+		base = base[:i]
+	}
+	if IsSupported(base) {
+		return base
+	}
+	return DefaultLocale
+}
+
+// FromAcceptLanguage выбирает поддерживаемую локаль по заголовку Accept-Language с учётом q-весов
+func FromAcceptLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		locale := strings.ToLower(tag)
+		if i := strings.IndexAny(locale, "-_"); i >= 0 {
+			locale = locale[:i]
+		}
+		if IsSupported(locale) && q > bestQ {
+			best, bestQ = locale, q
+		}
+	}
+
+	if best == "" {
+		return DefaultLocale
+	}
+	return best
+}
+
+// T возвращает строку каталога для локали, подставляя data.
+// Если ключа нет в каталоге локали, используется DefaultLocale, а затем сам ключ.
+func T(locale, key string, data map[string]interface{}) string {
+	e, ok := lookup(locale, key)
+	if !ok || e.text == nil {
+		logger.Warn("Missing translation", "locale", locale, "key", key)
+		return key
+	}
+	return execute(e.text, data)
+}
+
+// Plural возвращает форму множественного числа для n, например "5 дней"
+func Plural(locale, key string, n int) string {
+	e, ok := lookup(locale, key)
+	if !ok || e.forms == nil {
+		logger.Warn("Missing plural translation", "locale", locale, "key", key)
+		return strconv.Itoa(n)
+	}
+
+	tmpl, ok := e.forms[pluralForm(Normalize(locale), n)]
+	if !ok {
+		tmpl = e.forms["other"]
+	}
+	return execute(tmpl, map[string]interface{}{"N": n})
+}
+
+// FormatNumber форматирует число по правилам локали: "1 234,50" (ru) или "1,234.50" (en).
+// Дробная часть выводится с двумя знаками, нулевая -- опускается.
+func FormatNumber(locale string, value float64) string {
+	groupSep, decimalSep := "\u00a0", "," // Неразрывный пробел, чтобы сумма не переносилась
+	if Normalize(locale) == "en" {
+		groupSep, decimalSep = ",", "."
+	}
+
+	negative := value < 0
+	cents := int64(math.Round(math.Abs(value) * 100))
+	whole, fraction := cents/100, cents%100
+
+	digits := strconv.FormatInt(whole, 10)
+	var grouped strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteString(groupSep)
+		}
+		grouped.WriteRune(digit)
+	}
+
+	result := grouped.String()
+	if fraction != 0 {
+		result += decimalSep + fmt.Sprintf("%02d", fraction)
+	}
+	if negative {
+		result = "-" + result
+	}
+	return result
+}
+
+// FormatCurrency форматирует сумму с символом валюты: "1 234 ₽" (ru) или "₽1,234" (en)
+func FormatCurrency(locale string, amount float64, currency string) string {
+	symbol := currencySymbol(currency)
+	number := FormatNumber(locale, amount)
+	if Normalize(locale) == "en" {
+		return symbol + number
+	}
+	return number + "\u00a0" + symbol
+}
+
+// FormatDate форматирует дату по правилам локали: "02.01.2006" (ru) или "Jan 2, 2006" (en)
+func FormatDate(locale string, t time.Time) string {
+	if Normalize(locale) == "en" {
+		return t.Format("Jan 2, 2006")
+	}
+	return t.Format("02.01.2006")
+}
+
+// lookup ищет строку в каталоге локали, затем в каталоге по умолчанию
+func lookup(locale, key string) (entry, bool) {
+	if e, ok := catalogs[Normalize(locale)][key]; ok {
+		return e, true
+	}
+	e, ok := catalogs[DefaultLocale][key]
+	return e, ok
+}
+
+// execute выполняет шаблон, ошибки только логируются
+func execute(tmpl *template.Template, data map[string]interface{}) string {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		logger.Error("Failed to render translation", "template", tmpl.Name(), "error", err)
+		return tmpl.Name()
+	}
+	return buf.String()
+}
+
+// pluralForm выбирает категорию множественного числа CLDR для целого n
+func pluralForm(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+
+	switch locale {
+	case "ru":
+		mod10, mod100 := n%10, n%100
+		switch {
+		case mod10 == 1 && mod100 != 11:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+// currencySymbol возвращает символ валюты по коду ISO 4217
+func currencySymbol(currency string) string {
+	switch strings.ToUpper(currency) {
+	case "RUB", "":
+		return "₽"
+	case "USD":
+		return "$"
+	case "EUR":
+		return "€"
+	default:
+		return strings.ToUpper(currency)
+	}
+}
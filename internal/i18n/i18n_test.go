@@ -0,0 +1,62 @@
+package i18n_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+func TestFromAcceptLanguagePicksBestSupportedLocale(t *testing.T) {
+	assert.Equal(t, "en", i18n.FromAcceptLanguage("en-US,en;q=0.9"))
+	assert.Equal(t, "ru", i18n.FromAcceptLanguage("de-DE,ru;q=0.8,en;q=0.5"))
+	assert.Equal(t, "en", i18n.FromAcceptLanguage("ru;q=0.3, en-GB;q=0.7"))
+	assert.Equal(t, i18n.DefaultLocale, i18n.FromAcceptLanguage("fr-FR"))
+	assert.Equal(t, i18n.DefaultLocale, i18n.FromAcceptLanguage(""))
+}
+
+func TestPluralRules(t *testing.T) {
+	assert.Equal(t, "1 день", i18n.Plural("ru", "days", 1))
+	assert.Equal(t, "3 дня", i18n.Plural("ru", "days", 3))
+	assert.Equal(t, "5 дней", i18n.Plural("ru", "days", 5))
+	assert.Equal(t, "11 дней", i18n.Plural("ru", "days", 11))
+	assert.Equal(t, "21 день", i18n.Plural("ru", "days", 21))
+	assert.Equal(t, "1 day", i18n.Plural("en", "days", 1))
+	assert.Equal(t, "48 hours", i18n.Plural("en-US", "hours", 48))
+}
+
+func TestFormatCurrency(t *testing.T) {
+	assert.Equal(t, "1\u00a0234,50\u00a0₽", i18n.FormatCurrency("ru", 1234.5, "RUB"))
+	assert.Equal(t, "499\u00a0₽", i18n.FormatCurrency("ru", 499, "RUB"))
+	assert.Equal(t, "₽1,234,567.99", i18n.FormatCurrency("en", 1234567.99, "RUB"))
+	assert.Equal(t, "$12", i18n.FormatCurrency("en", 12, "USD"))
+}
+
+func TestTranslateFallsBackToDefaultLocale(t *testing.T) {
+	body := i18n.T("en", "reminder.body", map[string]interface{}{"Service": "NETFLIX", "Cost": "₽499"})
+	assert.Equal(t, "Don't forget to pay\n• Service: “NETFLIX”\n• Cost: ₽499", body)
+
+	// Неизвестная локаль -> каталог по умолчанию
+	assert.Equal(t, "Напоминание об оплате!", i18n.T("fr", "reminder.title", nil))
+	// Неизвестный ключ возвращается как есть
+	assert.Equal(t, "missing.key", i18n.T("en", "missing.key", nil))
+}
+
+func TestTranslateWithPlural(t *testing.T) {
+	body := i18n.T("ru", "overdue.body", map[string]interface{}{"Service": "IVI", "Cost": "299 ₽", "Days": 2})
+	assert.Contains(t, body, "уже 2 дня")
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "05.03.2024", i18n.FormatDate("ru", date))
+	assert.Equal(t, "Mar 5, 2024", i18n.FormatDate("en", date))
+}
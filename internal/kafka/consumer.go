@@ -3,83 +3,142 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
-	"github.com/IBM/sarama"
-	"github.com/SergeyMilch/pay_aware/internal/config"
+	"github.com/SergeyMilch/pay_aware/internal/bus"
+	"github.com/SergeyMilch/pay_aware/internal/deadletter"
+	"github.com/SergeyMilch/pay_aware/internal/events"
 	"github.com/SergeyMilch/pay_aware/internal/logger"
 	"github.com/SergeyMilch/pay_aware/pkg/models"
-	"github.com/SergeyMilch/pay_aware/pkg/utils"
 )
 
-// StartKafkaConsumer запускает Kafka consumer
-func StartKafkaConsumer(cfg config.KafkaConfig) {
-	retryAttempts := 3
-	sleepDuration := 5 * time.Second
-
-	err := utils.Retry(retryAttempts, sleepDuration, func() error {
-		consumerGroupHandler := &ConsumerGroupHandler{}
-		consumerConfig := sarama.NewConfig()
-
-		// Настройка SSL, если флаг `UseSSL` установлен в true
-		if cfg.UseSSL {
-			consumerConfig.Net.TLS.Enable = true
-			tlsConfig, err := utils.CreateTLSConfiguration(cfg.Truststore, cfg.TruststorePassword)
-			if err != nil {
-				logger.Error("Failed to create TLS configuration", "error", err)
-				return err
-			}
-			consumerConfig.Net.TLS.Config = tlsConfig
-		}
+// consumerGroup -- группа получателей уведомлений: каждое сообщение обрабатывает один экземпляр сервиса
+const consumerGroup = "subscription_consumer_group"
 
-		consumer, err := sarama.NewConsumerGroup([]string{cfg.Broker}, "subscription_consumer_group", consumerConfig)
-		if err != nil {
-			logger.Error("Error creating Kafka consumer group", "error", err)
-			return err
-		}
+// StartConsumer получает сообщения исходного топика и топиков повторов из шины, пока не отменён ctx
+func StartConsumer(ctx context.Context, b bus.Bus, topic string) {
+	if err := b.Consume(ctx, consumerGroup, deadletter.Topics(topic), consume(topic)); err != nil {
+		logger.Error("Failed to consume messages", "error", err)
+		return
+	}
+	logger.Info("Message consumer stopped")
+}
 
-		defer consumer.Close()
-		ctx := context.Background()
-		for {
-			if err := consumer.Consume(ctx, []string{cfg.Topic}, consumerGroupHandler); err != nil {
-				logger.Error("Error consuming Kafka message", "error", err)
-				return err
-			}
+// consume возвращает обработчик сообщений шины. Неудачи уходят на повтор или в DLQ
+// от имени исходного топика topic.
+func consume(topic string) bus.Handler {
+	return func(ctx context.Context, message bus.Message) error {
+		// Сообщение из топика повторов ждёт своей задержки. Ждёт шина, а не обработчик: так ожидание
+		// не мешает перебалансировке и остановке. Задержка у всех сообщений топика одна,
+		// поэтому следующие сообщения топика готовы не раньше этого.
+		if wait := time.Until(deadletter.NotBefore(message.Headers)); wait > 0 {
+			logger.Debug("Message is not ready for retry yet", "topic", message.Topic, "wait", wait)
+			return bus.RetryLater(wait)
 		}
-	})
 
-	if err != nil {
-		logger.Error("Failed to initialize Kafka consumer after retries", "error", err)
+		// Обработка сообщения: события маршрутизируются по типу. Ошибка означает, что сообщение
+		// не удалось даже отправить на повтор: оно остаётся неподтверждённым и придёт снова.
+		return handleMessage(ctx, delivery{
+			topic:   topic,
+			key:     message.Key,
+			value:   message.Value,
+			attempt: deadletter.Attempt(message.Headers),
+		})
 	}
+}
 
-	logger.Info("Kafka consumer initialized successfully")
+// delivery -- полученное сообщение и номер попытки его обработки
+type delivery struct {
+	topic   string
+	key     string
+	value   []byte
+	attempt int
 }
 
-type ConsumerGroupHandler struct{}
+// eventRouter -- обработчики событий по типу
+var eventRouter = newEventRouter()
 
-func (h *ConsumerGroupHandler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
-func (h *ConsumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
+func newEventRouter() *events.Router {
+	router := events.NewRouter()
+	router.Handle(events.TypeReminderDue, handleReminderDue)
+	return router
+}
 
-func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		logger.Debug("Message claimed", "value", string(message.Value), "timestamp", message.Timestamp, "topic", message.Topic)
+// handleMessage обрабатывает сообщение. Если обработка не удалась, сообщение уходит
+// в топик повторов, а после последней попытки -- в DLQ. Ошибка возвращается, только если
+// сообщение не удалось ни обработать, ни отправить на повтор.
+func handleMessage(ctx context.Context, d delivery) error {
+	if err := processMessage(ctx, d.value); err != nil {
+		return fail(d, err)
+	}
+	return nil
+}
 
-		// Обработка сообщения
-		var notification models.Notification
-		if err := json.Unmarshal(message.Value, &notification); err != nil {
-			logger.Warn("Error unmarshalling Kafka message", "error", err)
-			continue
-		}
+// processMessage проверяет сообщение по схеме и передаёт его обработчику типа события.
+// Неизвестные события пропускаются, некорректные возвращают deadletter.ErrPermanent.
+func processMessage(ctx context.Context, value []byte) error {
+	envelope, err := events.Decode(value)
+	switch {
+	case errors.Is(err, events.ErrNotEnvelope):
+		// Сообщения, записанные до появления конверта, ещё могут оставаться в топике
+		return handleLegacyNotification(ctx, value)
+	case errors.Is(err, events.ErrUnknownEvent):
+		logger.Warn("Unknown event, skipping", "type", envelope.Type, "version", envelope.SchemaVersion, "eventID", envelope.ID)
+		return nil
+	case err != nil:
+		return fmt.Errorf("%w: %v", deadletter.ErrPermanent, err)
+	}
 
-		if notification.UserID == 0 || notification.SubscriptionID == 0 {
-			logger.Warn("Invalid notification data: user_id or subscription_id is zero", "userID", notification.UserID, "subscriptionID", notification.SubscriptionID)
-			continue
-		}
+	if err := eventRouter.Dispatch(ctx, envelope); err != nil {
+		logger.Error("Failed to handle event", "type", envelope.Type, "eventID", envelope.ID, "error", err)
+		return err
+	}
+	return nil
+}
 
-		// Обработка сообщения с валидными данными
-		ProcessKafkaMessage(notification)
-		session.MarkMessage(message, "")
-		logger.Debug("Message processed and marked", "userID", notification.UserID, "subscriptionID", notification.SubscriptionID)
+// fail отправляет сообщение на повтор или в DLQ
+func fail(d delivery, err error) error {
+	if err := deadletter.Handle(context.Background(), deadletter.Failure{
+		Topic:   d.topic,
+		Key:     d.key,
+		Payload: d.value,
+		Attempt: d.attempt,
+		Err:     err,
+	}); err != nil {
+		logger.Error("Failed to schedule Kafka message retry, message will be redelivered", "topic", d.topic, "attempt", d.attempt, "error", err)
+		return err
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// handleReminderDue отправляет напоминание о платеже
+func handleReminderDue(ctx context.Context, envelope events.Envelope) error {
+	var payload events.ReminderDue
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		return fmt.Errorf("%w: %v", deadletter.ErrPermanent, err)
+	}
+
+	return ProcessKafkaMessage(ctx, models.Notification{
+		UserID:         payload.UserID,
+		SubscriptionID: payload.SubscriptionID,
+		Message:        payload.Message,
+		Missed:         payload.Missed,
+		IdempotencyKey: &payload.IdempotencyKey,
+	})
+}
+
+// handleLegacyNotification обрабатывает сообщение в прежнем формате (models.Notification в JSON)
+func handleLegacyNotification(ctx context.Context, value []byte) error {
+	var notification models.Notification
+	if err := json.Unmarshal(value, &notification); err != nil {
+		return fmt.Errorf("%w: %v", deadletter.ErrPermanent, err)
+	}
+
+	if notification.UserID == 0 || notification.SubscriptionID == 0 {
+		return fmt.Errorf("%w: user_id or subscription_id is zero", deadletter.ErrPermanent)
+	}
+
+	return ProcessKafkaMessage(ctx, notification)
+}
@@ -1,78 +1,203 @@
 package kafka
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/SergeyMilch/pay_aware/internal/deadletter"
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
 	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/internal/realtime"
+	"github.com/SergeyMilch/pay_aware/pkg/auth"
 	"github.com/SergeyMilch/pay_aware/pkg/db"
 	"github.com/SergeyMilch/pay_aware/pkg/models"
-	"golang.org/x/exp/rand"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// ProcessKafkaMessage обрабатывает сообщения из Kafka и отправляет уведомления
-func ProcessKafkaMessage(notification models.Notification) {
+// actionTokenTTL -- сколько действуют кнопки в уведомлении (до следующего платежа обычно меньше месяца)
+const actionTokenTTL = 30 * 24 * time.Hour
+
+// sendingLease -- сколько запись истории может оставаться в статусе "sending". Дольше -- значит,
+// экземпляр упал посреди отправки, и повтор сообщения отправит напоминание заново
+const sendingLease = 5 * time.Minute
+
+// ProcessKafkaMessage обрабатывает сообщения из Kafka и отправляет уведомления.
+// Возвращает ошибку, если сообщение нужно обработать повторно.
+func ProcessKafkaMessage(_ context.Context, notification models.Notification) error {
     // Проверка обязательных полей
     if notification.SubscriptionID == 0 {
-        logger.Error("Invalid Kafka message: missing required fields", "notification", notification)
-        return
+        return fmt.Errorf("%w: missing subscription_id", deadletter.ErrPermanent)
+    }
+
+    // Kafka доставляет сообщения "хотя бы раз": напоминание за период, уже сохранённое в истории, повторно не отправляем
+    if isDuplicateReminder(notification) {
+        logger.Info("Duplicate reminder message, skipping", "subscriptionID", notification.SubscriptionID, "idempotencyKey", *notification.IdempotencyKey)
+        return nil
     }
 
     // Найти подписку по `subscription_id`
     var subscription models.Subscription
     if err := db.GormDB.First(&subscription, notification.SubscriptionID).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            // Подписку удалили после постановки напоминания -- напоминать не о чем
+            logger.Warn("Subscription for notification not found, skipping", "subscriptionID", notification.SubscriptionID)
+            return nil
+        }
         logger.Error("Не удалось найти подписку для отправки уведомления", "subscriptionID", notification.SubscriptionID, "error", err)
-        return
+        return err
     }
 
     // Найти пользователя, связанного с подпиской
     var user models.User
     if err := db.GormDB.First(&user, subscription.UserID).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            logger.Warn("User for notification not found, skipping", "userID", subscription.UserID)
+            return nil
+        }
         logger.Error("Не удалось найти пользователя для отправки уведомления", "userID", subscription.UserID, "error", err)
-        return
+        return err
     }
 
-    // Проверить наличие DeviceToken
-    if user.DeviceToken == "" {
-        logger.Warn("Device token is missing for user", "userID", user.ID)
-        return
+    // Сформировать сообщение на языке пользователя
+    titleKey, bodyKey := "reminder.title", "reminder.body"
+    if subscription.HighPriority {
+        titleKey, bodyKey = "reminder.title_high_priority", "reminder.body_high_priority"
+    }
+    if notification.Missed {
+        // Напоминание не ушло вовремя (сервис был недоступен) -- честно говорим, что оно опоздало
+        titleKey, bodyKey = "reminder.missed_title", "reminder.missed_body"
     }
+    title := i18n.T(user.Locale, titleKey, nil)
+    message := i18n.T(user.Locale, bodyKey, map[string]interface{}{
+        "Service": strings.ToUpper(subscription.ServiceName),
+        "Cost":    i18n.FormatCurrency(user.Locale, subscription.Cost, i18n.DefaultCurrency),
+    })
 
-    // Сформировать сообщение с учетом предпочтений пользователя
-    var message string
-    if subscription.HighPriority {
-        message = fmt.Sprintf("Не забудьте оплатить❗\n• Сервис: «%s»\n• Стоимость: %v ₽", 
-            strings.ToUpper(subscription.ServiceName), 
-            subscription.Cost)
-    } else {
-        message = fmt.Sprintf("Не забудьте оплатить\n• Сервис: «%s»\n• Стоимость: %v ₽", 
-            strings.ToUpper(subscription.ServiceName), 
-            subscription.Cost)
-    }
-
-    // Добавляем случайную задержку (джиттер) перед отправкой уведомления
-    jitter := time.Duration(rand.Intn(120)) * time.Second
-    logger.Debug("Adding jitter before sending notification", "subscriptionID", subscription.ID, "jitter", jitter)
-
-    // Используем time.AfterFunc для вызова функции с задержкой
-    time.AfterFunc(jitter, func() {
-        // Отправка push-уведомления
-        if err := SendPushNotification(user.DeviceToken, message, subscription.HighPriority); err != nil {
-            logger.Error("Не удалось отправить уведомление", "userID", user.ID, "error", err)
-            // Сохраняем неудачную отправку
-            notification.Status = "failed"
+    // Настройки каналов (nil -- пользователь их не менял, действуют значения по умолчанию)
+    prefs, err := notifier.LoadPreferences(int(user.ID))
+    if err != nil {
+        logger.Error("Не удалось загрузить настройки уведомлений", "userID", user.ID, "error", err)
+    }
+
+    // Сообщение подтверждается только после отправки, поэтому при перезапуске сервиса оно не теряется.
+    // Джиттер, разносящий одновременные напоминания, заложен во время задачи при постановке в очередь.
+
+    // Запись истории создаётся до отправки, чтобы к ней можно было привязать тикет доставки push
+    notification.Status = "sending"
+    notification.SentAt = time.Now().UTC()
+    // Уникальный ключ идемпотентности: из параллельных доставок одного сообщения запись создаст только одна
+    result := db.GormDB.Clauses(clause.OnConflict{DoNothing: true}).Create(&notification)
+    if result.Error != nil {
+        // Без записи истории повтор нельзя отличить от первой отправки -- отправим при повторе сообщения
+        logger.Error("Не удалось сохранить уведомление в БД", "userID", user.ID, "error", result.Error)
+        return result.Error
+    }
+    if result.RowsAffected == 0 && notification.IdempotencyKey != nil && !reclaimFailedReminder(&notification) {
+        logger.Info("Duplicate reminder message, skipping", "subscriptionID", subscription.ID, "idempotencyKey", *notification.IdempotencyKey)
+        return nil
+    }
+
+    msg := notifier.Message{
+        Event:          notifier.EventReminderDue,
+        Title:          title,
+        Body:           message,
+        HighPriority:   subscription.HighPriority,
+        Subscription:   subscription,
+        NotificationID: notification.ID,
+    }
+
+    // Токен для кнопок "Оплачено", "Отложить", "Пропустить" прямо в уведомлении
+    if notification.ID != 0 {
+        actionToken, err := auth.GenerateActionToken(int(user.ID), notification.ID, os.Getenv("JWT_SECRET"), actionTokenTTL)
+        if err != nil {
+            logger.Warn("Failed to generate notification action token", "notificationID", notification.ID, "error", err)
         } else {
-            logger.Info("Push notification sent successfully", "userID", user.ID, "subscriptionID", subscription.ID)
-            // Сохраняем успешную отправку
-            notification.Status = "success"
-            notification.SentAt = time.Now().UTC()
+            msg.ActionToken = actionToken
         }
+    }
 
-        // Сохраняем факт отправки уведомления в базу данных
-        if err := db.GormDB.Create(&notification).Error; err != nil {
-            logger.Error("Не удалось сохранить уведомление в БД", "userID", user.ID, "error", err)
-        }
-    })
+    // Отправка уведомления в каналы из настроек пользователя (с фолбэком на остальные)
+    updates := map[string]interface{}{}
+    channels, dispatchErr := notifier.DispatchWithPreferences(context.Background(), user, prefs, msg)
+    if dispatchErr != nil {
+        logger.Error("Не удалось отправить уведомление", "userID", user.ID, "error", dispatchErr)
+        // Сохраняем неудачную отправку; сообщение уйдёт на повтор, и повтор заберёт эту же запись
+        updates["status"] = "failed"
+    } else {
+        logger.Info("Notification sent successfully", "userID", user.ID, "subscriptionID", subscription.ID, "channels", channels)
+        // Сохраняем успешную отправку
+        updates["status"] = "success"
+        updates["channel"] = strings.Join(channels, ",")
+        updates["sent_at"] = time.Now().UTC()
+    }
+
+    // Сохраняем результат отправки уведомления в базу данных
+    if notification.ID == 0 {
+        return dispatchErr
+    }
+    if err := db.GormDB.Model(&models.Notification{}).Where("id = ?", notification.ID).Updates(updates).Error; err != nil {
+        logger.Error("Не удалось обновить статус уведомления", "notificationID", notification.ID, "error", err)
+    }
+
+    // Открытые приложения получают уведомление и новый счётчик непрочитанных без опроса.
+    // Неудачную отправку не показываем: в истории она появится, только когда повтор её доставит.
+    if dispatchErr != nil {
+        return dispatchErr
+    }
+    var created models.Notification
+    if err := db.GormDB.Preload("Subscription").First(&created, notification.ID).Error; err == nil {
+        realtime.Publish(context.Background(), created.UserID, realtime.EventNotificationCreated, created)
+        realtime.PublishUnreadCount(context.Background(), created.UserID)
+    }
+    return nil
 }
 
+// isDuplicateReminder проверяет, есть ли в истории уведомление с тем же ключом идемпотентности
+func isDuplicateReminder(notification models.Notification) bool {
+    if notification.IdempotencyKey == nil {
+        return false
+    }
+
+    // Дубликат -- только успешная отправка или отправка, которая идёт прямо сейчас. Неудачную повторяет
+    // топик повторов, а зависшую в "sending" (экземпляр упал посреди отправки) забирает reclaimFailedReminder
+    var count int64
+    if err := db.GormDB.Model(&models.Notification{}).
+        Where("idempotency_key = ? AND (status = ? OR (status = ? AND sent_at >= ?))",
+            *notification.IdempotencyKey, "success", "sending", time.Now().UTC().Add(-sendingLease)).
+        Count(&count).Error; err != nil {
+        logger.Error("Failed to check reminder idempotency key", "subscriptionID", notification.SubscriptionID, "error", err)
+        return false
+    }
+    return count > 0
+}
+
+// reclaimFailedReminder забирает для повторной отправки запись истории, отправка которой не удалась
+// или так и не завершилась за sendingLease (экземпляр упал после создания записи).
+// Из параллельных повторов запись заберёт только один.
+func reclaimFailedReminder(notification *models.Notification) bool {
+    result := db.GormDB.Model(&models.Notification{}).
+        Where("idempotency_key = ? AND (status = ? OR (status = ? AND sent_at < ?))",
+            *notification.IdempotencyKey, "failed", "sending", time.Now().UTC().Add(-sendingLease)).
+        Updates(map[string]interface{}{"status": "sending", "sent_at": notification.SentAt})
+    if result.Error != nil {
+        logger.Error("Failed to reclaim failed reminder", "subscriptionID", notification.SubscriptionID, "error", result.Error)
+        return false
+    }
+    if result.RowsAffected == 0 {
+        return false
+    }
+
+    var existing models.Notification
+    if err := db.GormDB.Where("idempotency_key = ?", *notification.IdempotencyKey).First(&existing).Error; err != nil {
+        logger.Error("Failed to load reclaimed reminder", "subscriptionID", notification.SubscriptionID, "error", err)
+        return false
+    }
+    notification.ID = existing.ID
+    return true
+}
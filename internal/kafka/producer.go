@@ -1,32 +1,39 @@
 package kafka
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/IBM/sarama"
+	"github.com/SergeyMilch/pay_aware/internal/bus"
 	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/outbox"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
 )
 
-// SendMessage отправляет сообщение в Kafka с использованием KafkaProducer
-func (kp *KafkaProducer) SendMessage(message string) error {
-	if kp.producer == nil {
-		logger.Warn("Kafka producer is not initialized")
-		return fmt.Errorf("kafka producer is not initialized")
+// PublishOutbox отправляет в шину сообщение из outbox (используется relay)
+func (p *Producer) PublishOutbox(ctx context.Context, message models.OutboxMessage) error {
+	topic := message.Topic
+	if topic == "" {
+		topic = p.topic
 	}
-
-	msg := &sarama.ProducerMessage{
-		Topic: kp.topic,
-		Value: sarama.StringEncoder(message),
+	headers, err := outbox.Headers(message)
+	if err != nil {
+		return fmt.Errorf("invalid outbox message headers: %w", err)
 	}
 
-	_, _, err := kp.producer.SendMessage(msg)
-	if err != nil {
-		logger.Error("Failed to send Kafka message", "error", err, "topic", kp.topic)
+	if err := p.bus.Publish(ctx, bus.Message{
+		Topic:   topic,
+		Key:     message.MessageKey,
+		Value:   []byte(message.Payload),
+		Headers: headers,
+	}); err != nil {
 		return err
 	}
-
-	logger.Info("Message sent to Kafka", "topic", kp.topic)
-
-	logger.Debug("Message content", "topic", kp.topic, "message", message)
+	logger.Debug("Outbox message published", "topic", topic, "messageID", message.ID)
 	return nil
 }
+
+// StartOutboxRelay запускает отправку сообщений outbox в шину
+func (p *Producer) StartOutboxRelay(ctx context.Context) {
+	outbox.RunRelay(ctx, p.PublishOutbox)
+}
@@ -2,146 +2,570 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/SergeyMilch/pay_aware/internal/events"
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
+	"github.com/SergeyMilch/pay_aware/internal/leader"
+	"github.com/SergeyMilch/pay_aware/internal/lifecycle"
 	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/internal/outbox"
+	"github.com/SergeyMilch/pay_aware/internal/realtime"
+	"github.com/SergeyMilch/pay_aware/internal/reminderqueue"
 	"github.com/SergeyMilch/pay_aware/pkg/db"
 	"github.com/SergeyMilch/pay_aware/pkg/models"
-	"github.com/go-redis/redis/v8"
+	"github.com/SergeyMilch/pay_aware/pkg/utils"
 	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
 )
 
 const workerCount = 10 // Количество параллельных воркеров
 
-// StartNotificationScheduler инициализирует CRON-задачу для уведомлений
-func (kp *KafkaProducer) StartNotificationScheduler() {
+// overdueLookback -- как далеко в прошлое ищем неоплаченные разовые платежи
+const overdueLookback = 7 * 24 * time.Hour
+
+// schedulerLease -- имя аренды лидерства: планировщик работает только на одном экземпляре сервиса
+const schedulerLease = "notification-scheduler"
+
+const (
+    reminderVisibilityTimeout = 5 * time.Minute        // Столько задача невидима для других воркеров после захвата
+    reminderPollInterval      = time.Second            // Как часто проверяем очередь, если ближайшая задача ещё не скоро
+    reminderMinPollInterval   = 100 * time.Millisecond // Пауза, если подошедшие задачи уже забрали другие экземпляры
+)
+
+// defaultMaxReminderLateness -- насколько напоминание может опоздать (например, после простоя),
+// чтобы уйти обычным; более позднее уходит как "пропущенное"
+const defaultMaxReminderLateness = 6 * time.Hour
+
+// maxReminderLateness задаётся REMINDER_MAX_LATENESS (например, "6h")
+var maxReminderLateness = defaultMaxReminderLateness
+
+// reminderJob -- задача для отправки: подписка и признак повтора отложенного напоминания
+type reminderJob struct {
+    subscription models.Subscription
+    snoozed      bool // Повтор по snoozed_until: дату платежа не сдвигаем
+    missed       bool // Время напоминания прошло больше maxReminderLateness назад
+}
+
+// StartNotificationScheduler запускает разбор очереди напоминаний и CRON-задачи планировщика и работает до отмены ctx.
+// После отмены новые задачи не забираются, а уже начатые доделываются.
+func (p *Producer) StartNotificationScheduler(ctx context.Context) {
     c := cron.New()
-    ctx := context.Background()
+    // Контекст начатой работы: отмена ctx не обрывает отправку посередине
+    workCtx := context.WithoutCancel(ctx)
 
-    // Создаём канал для уведомлений
-    notificationChan := make(chan models.Subscription, 100)
+    if value := os.Getenv("REMINDER_MAX_LATENESS"); value != "" {
+        lateness, err := time.ParseDuration(value)
+        if err != nil || lateness <= 0 {
+            logger.Warn("Invalid REMINDER_MAX_LATENESS, using default", "value", value, "default", defaultMaxReminderLateness)
+        } else {
+            maxReminderLateness = lateness
+        }
+    }
 
-    // Запускаем воркеры
+    // Очередь разбирают все экземпляры сервиса: захват задачи не даёт отправить её дважды.
+    // Канал без буфера: пока воркеры заняты, новые задачи остаются в очереди, а не теряются
+    jobs := make(chan models.ReminderJob)
+    var workers sync.WaitGroup
     for i := 0; i < workerCount; i++ {
-        go kp.notificationWorker(ctx, notificationChan)
-    }
-
-    // Добавляем CRON-функцию, выполняющуюся каждую минуту
-    _, err := c.AddFunc("* * * * *", func() {
-        var subscriptions []models.Subscription
-        currentTime := time.Now().UTC()
-        nextCheckTime := currentTime.Add(2 * time.Minute) // Сокращенное окно проверки
-
-        // Ищем подписки, для которых необходимо отправить уведомление в ближайшие 2 минуты
-        db.GormDB.Where("notification_date BETWEEN ? AND ?", currentTime, nextCheckTime).Find(&subscriptions)
-
-        for _, subscription := range subscriptions {
-            // Вычисляем NotificationTime
-            notificationTime := subscription.NextPaymentDate.Add(-time.Duration(subscription.NotificationOffset) * time.Minute)
-
-            // Если NotificationOffset == 0, то notificationTime == NextPaymentDate
-            if (notificationTime.Before(nextCheckTime) && notificationTime.After(currentTime)) ||
-                notificationTime.Equal(currentTime) || notificationTime.Equal(nextCheckTime) {
-                
-                cacheKey := fmt.Sprintf("notification_sent:subscription:%d", subscription.ID)
-                // Проверяем, не отправлено ли уже уведомление для этой подписки
-                if _, err := db.RedisClient.Get(ctx, cacheKey).Result(); err == redis.Nil {
-                    if subscription.ID == 0 {
-                        logger.Error("Invalid subscription ID, skipping notification", "subscription", subscription)
-                        continue
-                    }
-
-                    // Отправляем подписку в канал для обработки воркерами
-                    select {
-                    case notificationChan <- subscription:
-                        logger.Debug("Subscription sent to notification channel", "subscriptionID", subscription.ID)
-                    default:
-                        logger.Warn("Notification channel is full, skipping subscription", "subscriptionID", subscription.ID)
-                    }
-                }
+        workers.Add(1)
+        go func() {
+            defer workers.Done()
+            p.notificationWorker(workCtx, jobs)
+        }()
+    }
+    go func() {
+        dispatchReminders(ctx, jobs)
+        close(jobs)
+    }()
+
+    // Сверку очереди и проверки по расписанию выполняет только держатель аренды в Redis;
+    // если он умрёт, аренду через её срок заберёт другой экземпляр
+    elector := leader.New(schedulerLease)
+    elector.Tick(ctx)
+    electorDone := make(chan struct{})
+    go func() {
+        // При остановке аренда освобождается, чтобы другой экземпляр не ждал её истечения
+        elector.Run(ctx)
+        close(electorDone)
+    }()
+    if elector.IsLeader() {
+        syncReminderQueue(ctx)
+        rollForwardStaleSubscriptions(ctx)
+    }
+
+    // Раз в час ищем просроченные платежи для события payment.overdue, ставим в очередь
+    // потерявшиеся напоминания и сдвигаем повторяющиеся подписки, напоминание по которым так и не ушло
+    if _, err := c.AddFunc("@hourly", func() {
+        if elector.IsLeader() {
+            checkOverduePayments(workCtx)
+            syncReminderQueue(workCtx)
+            rollForwardStaleSubscriptions(workCtx)
+        }
+    }); err != nil {
+        logger.Error("Failed to schedule overdue payments check", "error", err)
+    }
+
+    logger.Info("Notification scheduler started")
+    lifecycle.RunCron(ctx, c)
+    workers.Wait()
+    <-electorDone
+    logger.Info("Notification scheduler stopped")
+}
+
+// dispatchReminders забирает из очереди задачи, время которых подошло, и передаёт их воркерам.
+// За раз забирается не больше задач, чем воркеров, и следующая пачка -- только когда воркеры разобрали предыдущую.
+func dispatchReminders(ctx context.Context, jobs chan<- models.ReminderJob) {
+    for {
+        claimed, err := reminderqueue.Claim(ctx, workerCount, reminderVisibilityTimeout)
+        if err != nil {
+            logger.Error("Failed to claim reminder jobs", "error", err)
+        }
+        for _, job := range claimed {
+            select {
+            case jobs <- job:
+            case <-ctx.Done():
+                return
             }
         }
-    })
+        // Забрали полную пачку -- вероятно, подошли и другие задачи
+        if len(claimed) == workerCount {
+            continue
+        }
 
-    if err != nil {
-        logger.Error("Failed to schedule notification task", "error", err)
+        // Ждём ближайшую задачу, но не дольше reminderPollInterval: задачи ставят и другие экземпляры
+        wait := reminderPollInterval
+        if next, ok, err := reminderqueue.NextRunAt(ctx); err != nil {
+            logger.Error("Failed to load next reminder job", "error", err)
+        } else if ok && time.Until(next) < wait {
+            wait = time.Until(next)
+        }
+        if wait < reminderMinPollInterval {
+            wait = reminderMinPollInterval
+        }
+
+        select {
+        case <-time.After(wait):
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// Воркер для обработки уведомлений
+func (p *Producer) notificationWorker(ctx context.Context, jobs <-chan models.ReminderJob) {
+    for job := range jobs {
+        p.handleReminderJob(ctx, job)
+    }
+}
+
+// handleReminderJob выполняет задачу очереди: снимает её с очереди после отправки
+// или возвращает для повтора, если отправить не удалось
+func (p *Producer) handleReminderJob(ctx context.Context, queued models.ReminderJob) {
+    if queued.Attempts > reminderqueue.MaxAttempts {
+        logger.Error("Reminder job exceeded max attempts, dropping", "subscriptionID", queued.SubscriptionID, "kind", queued.Kind, "lastError", queued.LastError)
+        completeReminderJob(ctx, queued)
         return
     }
 
-    c.Start()
-    logger.Info("Notification scheduler started")
+    var subscription models.Subscription
+    if err := db.GormDB.First(&subscription, queued.SubscriptionID).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            // Подписку удалили -- напоминать не о чем
+            completeReminderJob(ctx, queued)
+            return
+        }
+        logger.Error("Failed to load subscription for reminder job", "subscriptionID", queued.SubscriptionID, "error", err)
+        retryReminderJob(ctx, queued, err)
+        return
+    }
+
+    now := time.Now().UTC()
+    job := reminderJob{subscription: subscription}
+    switch queued.Kind {
+    case reminderqueue.KindSnooze:
+        if subscription.SnoozedUntil == nil {
+            // Повтор отменили (оплачено, пропущено или подписку изменили)
+            completeReminderJob(ctx, queued)
+            return
+        }
+        if subscription.SnoozedUntil.After(now) {
+            enqueueReminder(subscription.ID, reminderqueue.KindSnooze, *subscription.SnoozedUntil)
+            return
+        }
+        job.snoozed = true
+
+    default:
+        if subscription.NotificationDate.After(now) {
+            // Дату напоминания перенесли позже, чем задача была поставлена
+            enqueueReminder(subscription.ID, reminderqueue.KindReminder, subscription.NotificationDate)
+            return
+        }
+
+        job.missed = now.Sub(subscription.NotificationDate) > maxReminderLateness
+        if job.missed {
+            logger.Info("Sending missed reminder", "subscriptionID", subscription.ID, "notificationDate", subscription.NotificationDate)
+        }
+    }
+
+    if err := p.processSubscription(ctx, job); err != nil {
+        retryReminderJob(ctx, queued, err)
+        return
+    }
+    completeReminderJob(ctx, queued)
 }
 
-// Воркер для обработки уведомлений
-func (kp *KafkaProducer) notificationWorker(ctx context.Context, notificationChan <-chan models.Subscription) {
-    for subscription := range notificationChan {
-        kp.processSubscription(ctx, subscription)
+// enqueueReminder переносит задачу подписки на срок dueAt (с джиттером)
+func enqueueReminder(subscriptionID uint, kind string, dueAt time.Time) {
+    if err := reminderqueue.Enqueue(db.GormDB, subscriptionID, kind, reminderqueue.WithJitter(dueAt)); err != nil {
+        logger.Error("Failed to enqueue reminder job", "subscriptionID", subscriptionID, "kind", kind, "error", err)
     }
 }
 
-// Функция обработки подписки
-func (kp *KafkaProducer) processSubscription(ctx context.Context, subscription models.Subscription) {
-    if subscription.ID == 0 {
-        logger.Error("Invalid subscription ID, skipping notification", "subscription", subscription)
+// completeReminderJob снимает выполненную задачу с очереди
+func completeReminderJob(ctx context.Context, job models.ReminderJob) {
+    if err := reminderqueue.Complete(ctx, job); err != nil {
+        logger.Error("Failed to complete reminder job", "jobID", job.ID, "error", err)
+    }
+}
+
+// retryReminderJob возвращает задачу в очередь с экспоненциальной задержкой
+func retryReminderJob(ctx context.Context, job models.ReminderJob, cause error) {
+    delay := reminderqueue.RetryDelay(job.Attempts)
+    if err := reminderqueue.Retry(ctx, job, delay, cause.Error()); err != nil {
+        // Задача вернётся сама, когда истечёт захват
+        logger.Error("Failed to reschedule reminder job", "jobID", job.ID, "error", err)
         return
     }
+    logger.Warn("Reminder job will be retried", "subscriptionID", job.SubscriptionID, "kind", job.Kind, "attempt", job.Attempts, "delay", delay, "error", cause)
+}
 
-    message := models.Notification{
-        UserID:         subscription.UserID,
-        SubscriptionID: int(subscription.ID),
-        Message:        fmt.Sprintf("Не забудьте оплатить подписку на %s!", subscription.ServiceName),
+// syncReminderQueue ставит в очередь будущие напоминания и отложенные повторы, которых в ней нет:
+// подписки, созданные до появления очереди, и те, для которых постановка в очередь не удалась
+func syncReminderQueue(ctx context.Context) {
+    now := time.Now().UTC()
+    missingJob := "NOT EXISTS (SELECT 1 FROM reminder_jobs WHERE reminder_jobs.subscription_id = subscriptions.id AND reminder_jobs.kind = ?)"
+
+    var upcoming []models.Subscription
+    if err := db.GormDB.WithContext(ctx).Where("notification_date > ?", now).Where(missingJob, reminderqueue.KindReminder).Find(&upcoming).Error; err != nil {
+        logger.Error("Failed to load subscriptions missing from reminder queue", "error", err)
+        return
+    }
+    for _, subscription := range upcoming {
+        enqueueReminder(subscription.ID, reminderqueue.KindReminder, subscription.NotificationDate)
     }
 
-    // Сериализуем уведомление в JSON и отправляем в Kafka
-    messageBytes, err := json.Marshal(message)
-    if err != nil {
-        logger.Error("Failed to marshal notification", "error", err)
+    var snoozed []models.Subscription
+    if err := db.GormDB.WithContext(ctx).Where("snoozed_until IS NOT NULL").Where(missingJob, reminderqueue.KindSnooze).Find(&snoozed).Error; err != nil {
+        logger.Error("Failed to load snoozed subscriptions missing from reminder queue", "error", err)
         return
     }
+    for _, subscription := range snoozed {
+        enqueueReminder(subscription.ID, reminderqueue.KindSnooze, *subscription.SnoozedUntil)
+    }
+
+    if len(upcoming)+len(snoozed) > 0 {
+        logger.Info("Reminder queue synchronized", "reminders", len(upcoming), "snoozed", len(snoozed))
+    }
+}
+
+// rollForwardStaleSubscriptions сдвигает на будущее повторяющиеся подписки, дата платежа которых прошла,
+// а напоминания в очереди нет (например, отправка в Kafka так и не удалась).
+// Напоминание за прошедший платёж не отправляется -- подписка просто переходит к следующему.
+func rollForwardStaleSubscriptions(ctx context.Context) {
+    now := time.Now().UTC()
 
-    if err := kp.SendMessage(string(messageBytes)); err != nil {
-        logger.Error("Failed to send message to Kafka", "error", err, "subscriptionID", subscription.ID)
+    var stale []models.Subscription
+    if err := db.GormDB.Where("recurrence_type IN ? AND next_payment_date < ?", []string{"monthly", "yearly"}, now).
+        Where("NOT EXISTS (SELECT 1 FROM reminder_jobs WHERE reminder_jobs.subscription_id = subscriptions.id AND reminder_jobs.kind = ?)", reminderqueue.KindReminder).
+        Find(&stale).Error; err != nil {
+        logger.Error("Failed to load stale recurring subscriptions", "error", err)
         return
     }
 
-    // Ставим флаг в Redis, чтобы уведомление не отправлялось повторно
-    cacheKey := fmt.Sprintf("notification_sent:subscription:%d", subscription.ID)
-    err = db.RedisClient.Set(ctx, cacheKey, "sent", time.Until(subscription.NextPaymentDate)).Err()
+    for _, subscription := range stale {
+        var user models.User
+        if err := db.GormDB.First(&user, subscription.UserID).Error; err != nil {
+            logger.Error("User not found for stale subscription", "userID", subscription.UserID, "error", err)
+            continue
+        }
+
+        previous := subscription.NextPaymentDate
+        shifted := false
+        err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+            var err error
+            shifted, err = shiftRecurring(tx, &subscription, now, utils.LoadUserLocation(user.TimeZone))
+            return err
+        })
+        if err != nil {
+            logger.Error("Failed to roll stale subscription forward", "subscriptionID", subscription.ID, "error", err)
+            continue
+        }
+        if shifted {
+            announceShift(ctx, subscription, previous)
+        }
+    }
+}
+
+// rollRecurringForward сдвигает дату платежа по календарю пользователя, пока она не окажется в будущем
+// (после долгого простоя одного сдвига может не хватить), и пересчитывает дату напоминания
+func rollRecurringForward(subscription *models.Subscription, now time.Time, loc *time.Location) {
+    subscription.NextPaymentDate = utils.AddRecurrence(subscription.NextPaymentDate, subscription.RecurrenceType, loc)
+    for !subscription.NextPaymentDate.After(now) {
+        subscription.NextPaymentDate = utils.AddRecurrence(subscription.NextPaymentDate, subscription.RecurrenceType, loc)
+    }
+    subscription.NotificationDate = subscription.NextPaymentDate.Add(
+        -time.Duration(subscription.NotificationOffset) * time.Minute,
+    )
+}
+
+// Функция обработки подписки. Ошибка возвращается, только если отправку стоит повторить.
+func (p *Producer) processSubscription(ctx context.Context, job reminderJob) error {
+    subscription, snoozed := job.subscription, job.snoozed
+    if subscription.ID == 0 {
+        logger.Error("Invalid subscription ID, skipping notification", "subscription", subscription)
+        return nil
+    }
+
+    var user models.User
+    if err := db.GormDB.First(&user, subscription.UserID).Error; err != nil {
+        logger.Error("User not found for subscription", "userID", subscription.UserID, "error", err)
+        return nil
+    }
+    loc := utils.LoadUserLocation(user.TimeZone)
+
+    // Обычные напоминания не отправляем в тихие часы, а переносим на их окончание
+    if !subscription.HighPriority && deferForQuietHours(ctx, subscription, snoozed, loc) {
+        return nil
+    }
+
+    // Ключ считаем после возможного переноса на конец тихих часов: у перенесённого напоминания он свой
+    kind, dueAt := reminderqueue.KindReminder, subscription.NotificationDate
+    if snoozed {
+        kind, dueAt = reminderqueue.KindSnooze, *subscription.SnoozedUntil
+    }
+    idempotencyKey := reminderqueue.IdempotencyKey(subscription.ID, kind, dueAt)
+
+    payload, err := reminderPayload(job, user, idempotencyKey)
+    if err != nil {
+        logger.Error("Failed to build reminder event", "subscriptionID", subscription.ID, "error", err)
+        return nil
+    }
+
+    // Сообщение для Kafka записываем в outbox в одной транзакции со сдвигом подписки:
+    // при падении сервиса не теряется ни сдвиг, ни напоминание, а отправит его relay после коммита.
+    // Уникальный ключ идемпотентности в outbox не даёт записать напоминание за период дважды,
+    // даже если задачу после истечения захвата забрал второй воркер
+    previous := subscription.NextPaymentDate
+    queued, shifted := false, false
+    err = db.GormDB.Transaction(func(tx *gorm.DB) error {
+        inserted, err := outbox.Add(tx, outbox.Message{
+            Topic:          p.topic,
+            Key:            strconv.FormatUint(uint64(subscription.ID), 10),
+            Payload:        payload,
+            IdempotencyKey: idempotencyKey,
+        })
+        if err != nil {
+            return err
+        }
+        queued = inserted
+
+        // Повтор отложенного напоминания не трогает дату платежа, только снимает отметку повтора.
+        // Условие на прежнее значение: если пользователь успел отложить ещё раз, новый повтор сохраняется
+        if snoozed {
+            return tx.Model(&models.Subscription{}).
+                Where("id = ? AND snoozed_until = ?", subscription.ID, subscription.SnoozedUntil).
+                Update("snoozed_until", nil).Error
+        }
+
+        // === ВАЖНО: если подписка повторяющаяся — сдвигаем дату. ===
+        if subscription.RecurrenceType == "monthly" || subscription.RecurrenceType == "yearly" {
+            shifted, err = shiftRecurring(tx, &subscription, time.Now().UTC(), loc)
+            return err
+        }
+        return nil
+    })
     if err != nil {
-        logger.Warn("Failed to set cache for notification", "subscriptionID", subscription.ID, "error", err)
+        logger.Error("Failed to store reminder in outbox", "subscriptionID", subscription.ID, "error", err)
+        return err
+    }
+
+    if queued {
+        outbox.Notify()
+        logger.Info("Notification queued for sending", "subscriptionID", subscription.ID, "idempotencyKey", idempotencyKey, "snoozed", snoozed)
     } else {
-        logger.Debug("Notification cached successfully", "subscriptionID", subscription.ID)
+        logger.Info("Reminder already dispatched, skipping", "subscriptionID", subscription.ID, "idempotencyKey", idempotencyKey)
     }
-    logger.Info("Notification sent and cached", "subscriptionID", subscription.ID)
+    if shifted {
+        announceShift(ctx, subscription, previous)
+    }
+    return nil
+}
 
-    // === ВАЖНО: если подписка повторяющаяся — сдвигаем дату. ===
-    if subscription.RecurrenceType == "monthly" || subscription.RecurrenceType == "yearly" {
-        // Сдвигаем NextPaymentDate на 1 месяц / 1 год вперёд
-        if subscription.RecurrenceType == "monthly" {
-            subscription.NextPaymentDate = subscription.NextPaymentDate.AddDate(0, 1, 0)
-        } else if subscription.RecurrenceType == "yearly" {
-            subscription.NextPaymentDate = subscription.NextPaymentDate.AddDate(1, 0, 0)
+// reminderPayload формирует событие reminder.due. Ключ идемпотентности идёт в событии,
+// по нему потребитель отбрасывает повторные доставки.
+func reminderPayload(job reminderJob, user models.User, idempotencyKey string) ([]byte, error) {
+    subscription := job.subscription
+
+    historyKey := "reminder.history"
+    if job.missed {
+        // Напоминание безнадёжно опоздало (сервис был недоступен): сообщаем, что оно пропущено
+        historyKey = "reminder.missed_history"
+    }
+    return events.Marshal(events.TypeReminderDue, events.ReminderDueVersion, events.ReminderDue{
+        UserID:         subscription.UserID,
+        SubscriptionID: int(subscription.ID),
+        Message:        i18n.T(user.Locale, historyKey, map[string]interface{}{"Service": subscription.ServiceName}),
+        Missed:         job.missed,
+        IdempotencyKey: idempotencyKey,
+    })
+}
+
+// shiftRecurring сдвигает повторяющуюся подписку на следующий период в транзакции tx
+// и ставит в очередь напоминание о нём. Условие на прежнюю дату платежа:
+// если подписку уже сдвинули, второй раз не сдвигаем (возвращается false).
+func shiftRecurring(tx *gorm.DB, subscription *models.Subscription, now time.Time, loc *time.Location) (bool, error) {
+    previous := subscription.NextPaymentDate
+    // Сдвигаем NextPaymentDate на 1 месяц / 1 год вперёд по календарю пользователя
+    // (после долгого простоя -- до первой даты в будущем) и пересчитываем NotificationDate
+    rollRecurringForward(subscription, now, loc)
+
+    result := tx.Model(&models.Subscription{}).
+        Where("id = ? AND next_payment_date = ?", subscription.ID, previous).
+        Updates(map[string]interface{}{
+            "next_payment_date": subscription.NextPaymentDate,
+            "notification_date": subscription.NotificationDate,
+        })
+    if result.Error != nil || result.RowsAffected == 0 {
+        return false, result.Error
+    }
+    return true, reminderqueue.Enqueue(tx, subscription.ID, reminderqueue.KindReminder, reminderqueue.WithJitter(subscription.NotificationDate))
+}
+
+// announceShift сообщает о сдвиге подписки на следующий период
+func announceShift(ctx context.Context, subscription models.Subscription, previous time.Time) {
+    // Удаляем кэш с подписками пользователя, чтобы при следующем запросе фронт знал о новой дате
+    redisKey := fmt.Sprintf("subscriptions:user:%d", subscription.UserID)
+    db.RedisClient.Del(ctx, redisKey)
+    realtime.PublishSubscriptionChanged(ctx, subscription.UserID, realtime.SubscriptionUpdated, subscription)
+    logger.Info("Subscription nextPaymentDate shifted for recurring subscription",
+        "subscriptionID", subscription.ID,
+        "recurrenceType", subscription.RecurrenceType,
+        "previousPaymentDate", previous,
+        "nextPaymentDate", subscription.NextPaymentDate)
+}
+
+// overdueDays возвращает число полных дней просрочки (не меньше 1)
+func overdueDays(paymentDate, now time.Time) int {
+    days := int(now.Sub(paymentDate).Hours() / 24)
+    if days < 1 {
+        days = 1
+    }
+    return days
+}
+
+// deferForQuietHours переносит напоминание, попавшее в тихие часы пользователя, на их окончание.
+// Возвращает true, если отправка отложена.
+func deferForQuietHours(ctx context.Context, subscription models.Subscription, snoozed bool, loc *time.Location) bool {
+    prefs, err := notifier.LoadPreferences(subscription.UserID)
+    if err != nil {
+        logger.Error("Failed to load notification preferences", "userID", subscription.UserID, "error", err)
+        return false
+    }
+    if prefs == nil {
+        return false
+    }
+
+    now := time.Now().UTC()
+    allowedAt := utils.NextAllowedTime(now, loc, prefs.QuietHoursStart, prefs.QuietHoursEnd)
+    if !allowedAt.After(now) {
+        return false
+    }
+
+    // Повтор отложенного напоминания переносим через snoozed_until, обычное -- через notification_date
+    column := "notification_date"
+    if snoozed {
+        column = "snoozed_until"
+    }
+    if err := db.GormDB.WithContext(ctx).Model(&models.Subscription{}).Where("id = ?", subscription.ID).Update(column, allowedAt).Error; err != nil {
+        logger.Error("Failed to defer notification for quiet hours", "subscriptionID", subscription.ID, "error", err)
+        return false
+    }
+
+    // Переносим и задачу в очереди; текущая задача после этого не снимется с очереди как выполненная
+    kind := reminderqueue.KindReminder
+    if snoozed {
+        kind = reminderqueue.KindSnooze
+    }
+    enqueueReminder(subscription.ID, kind, allowedAt)
+
+    logger.Info("Notification deferred until end of quiet hours", "subscriptionID", subscription.ID, "allowedAt", allowedAt)
+    return true
+}
+
+// checkOverduePayments отправляет payment.overdue для разовых платежей, дата которых прошла,
+// а напоминание по ним так и не было отмечено оплаченным
+func checkOverduePayments(ctx context.Context) {
+    now := time.Now().UTC()
+
+    var subscriptions []models.Subscription
+    if err := db.GormDB.Where("recurrence_type = ? AND next_payment_date BETWEEN ? AND ?", "", now.Add(-overdueLookback), now).
+        Find(&subscriptions).Error; err != nil {
+        logger.Error("Failed to load subscriptions for overdue check", "error", err)
+        return
+    }
+
+    for _, subscription := range subscriptions {
+        var paid int64
+        if err := db.GormDB.Model(&models.Notification{}).
+            Where("subscription_id = ? AND paid_at IS NOT NULL", subscription.ID).
+            Count(&paid).Error; err != nil || paid > 0 {
+            continue
         }
 
-        // Пересчитываем NotificationDate
-        subscription.NotificationDate = subscription.NextPaymentDate.Add(
-            -time.Duration(subscription.NotificationOffset) * time.Minute,
-        )
+        // Событие о просрочке отправляем один раз
+        cacheKey := fmt.Sprintf("payment_overdue_sent:subscription:%d", subscription.ID)
+        firstTime, err := db.RedisClient.SetNX(ctx, cacheKey, "sent", overdueLookback+24*time.Hour).Result()
+        if err != nil || !firstTime {
+            continue
+        }
 
-        // Сохраняем обновлённую подписку
-        if err := db.GormDB.Save(&subscription).Error; err != nil {
-            logger.Error("Failed to update subscription date in cron", "error", err)
-            return
+        var user models.User
+        if err := db.GormDB.First(&user, subscription.UserID).Error; err != nil {
+            logger.Error("User not found for overdue payment", "userID", subscription.UserID, "error", err)
+            continue
         }
 
-        // Удаляем кэш с подписками пользователя, чтобы при следующем запросе фронт знал о новой дате
-        redisKey := fmt.Sprintf("subscriptions:user:%d", subscription.UserID)
-        db.RedisClient.Del(ctx, redisKey)
-        logger.Info("Subscription nextPaymentDate shifted for recurring subscription",
-            "subscriptionID", subscription.ID,
-            "recurrenceType", subscription.RecurrenceType)
+        prefs, err := notifier.LoadPreferences(subscription.UserID)
+        if err != nil {
+            logger.Error("Failed to load notification preferences", "userID", subscription.UserID, "error", err)
+            continue
+        }
+
+        // По умолчанию событие уходит только на webhook'и, но пользователь может направить его в любой канал
+        msg := notifier.Message{
+            Event:        notifier.EventPaymentOverdue,
+            Title:        i18n.T(user.Locale, "overdue.title", nil),
+            Body: i18n.T(user.Locale, "overdue.body", map[string]interface{}{
+                "Service": strings.ToUpper(subscription.ServiceName),
+                "Cost":    i18n.FormatCurrency(user.Locale, subscription.Cost, i18n.DefaultCurrency),
+                "Days":    overdueDays(subscription.NextPaymentDate, now),
+            }),
+            HighPriority: subscription.HighPriority,
+            Subscription: subscription,
+        }
+        channels, err := notifier.DispatchWithPreferences(ctx, user, prefs, msg)
+        if err != nil {
+            logger.Debug("Payment overdue notification was not delivered", "subscriptionID", subscription.ID, "error", err)
+            continue
+        }
+        logger.Info("Payment overdue notification sent", "subscriptionID", subscription.ID, "channels", channels)
     }
-    // === Конец блока сдвига дат ===
-}
\ No newline at end of file
+}
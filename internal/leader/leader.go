@@ -0,0 +1,230 @@
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	keyPrefix  = "leader:"        // Ключ аренды в Redis: leader:<имя>
+	defaultTTL = 15 * time.Second // Через сколько аренда умершего лидера освобождается
+)
+
+// renewScript продлевает аренду, только если она всё ещё принадлежит этому экземпляру
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript освобождает аренду, только если она принадлежит этому экземпляру
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Elector -- аренда лидерства в Redis: из всех экземпляров сервиса задачу выполняет только держатель аренды.
+// Лидер продлевает аренду каждые ttl/3; если он умер или потерял связь с Redis,
+// аренда истекает и её забирает другой экземпляр.
+type Elector struct {
+	name       string
+	instanceID string
+	ttl        time.Duration
+	client     *redis.Client
+
+	mu          sync.RWMutex
+	isLeader    bool
+	acquiredAt  time.Time
+	renewedAt   time.Time
+	transitions int // Сколько раз этот экземпляр становился лидером
+}
+
+// Status -- состояние аренды для /internal/leader
+type Status struct {
+	Name        string     `json:"name"`
+	InstanceID  string     `json:"instance_id"`
+	IsLeader    bool       `json:"is_leader"`
+	Holder      string     `json:"holder"`       // Кто держит аренду сейчас (по данным Redis)
+	LeaseTTLMs  int64      `json:"lease_ttl_ms"` // Сколько осталось до истечения аренды
+	AcquiredAt  *time.Time `json:"acquired_at,omitempty"`
+	RenewedAt   *time.Time `json:"renewed_at,omitempty"`
+	Transitions int        `json:"transitions"`
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*Elector
+)
+
+// New создаёт участника выборов за аренду name с общим клиентом Redis
+func New(name string) *Elector {
+	return NewWithClient(name, db.RedisClient, defaultTTL)
+}
+
+// NewWithClient создаёт участника выборов с заданными клиентом Redis и сроком аренды
+func NewWithClient(name string, client *redis.Client, ttl time.Duration) *Elector {
+	e := &Elector{
+		name:       name,
+		instanceID: instanceID(),
+		ttl:        ttl,
+		client:     client,
+	}
+
+	registryMu.Lock()
+	registry = append(registry, e)
+	registryMu.Unlock()
+	return e
+}
+
+// instanceID -- имя хоста и случайный суффикс: под с тем же именем после перезапуска -- другой участник
+func instanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+func (e *Elector) key() string {
+	return keyPrefix + e.name
+}
+
+// IsLeader сообщает, держит ли этот экземпляр аренду
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.isLeader
+}
+
+// InstanceID возвращает идентификатор этого экземпляра в выборах
+func (e *Elector) InstanceID() string {
+	return e.instanceID
+}
+
+// Run участвует в выборах до отмены ctx, после чего освобождает аренду, чтобы другой экземпляр не ждал её истечения
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		e.Tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick выполняет один шаг выборов: лидер продлевает аренду, остальные пытаются её захватить
+func (e *Elector) Tick(ctx context.Context) {
+	now := time.Now().UTC()
+
+	if e.IsLeader() {
+		renewed, err := renewScript.Run(ctx, e.client, []string{e.key()}, e.instanceID, e.ttl.Milliseconds()).Int()
+		if err != nil || renewed == 0 {
+			// Не смогли подтвердить аренду -- сразу перестаём выполнять задачи, иначе лидеров может стать двое
+			e.setLeader(false, now)
+			logger.Warn("Leader lease lost", "lease", e.name, "instanceID", e.instanceID, "error", err)
+			return
+		}
+		e.mu.Lock()
+		e.renewedAt = now
+		e.mu.Unlock()
+		return
+	}
+
+	acquired, err := e.client.SetNX(ctx, e.key(), e.instanceID, e.ttl).Result()
+	if err != nil {
+		logger.Warn("Failed to acquire leader lease", "lease", e.name, "error", err)
+		return
+	}
+	if !acquired {
+		// Аренда могла остаться за нами после сбоя продления: тогда возвращаем её, не дожидаясь истечения
+		renewed, err := renewScript.Run(ctx, e.client, []string{e.key()}, e.instanceID, e.ttl.Milliseconds()).Int()
+		acquired = err == nil && renewed == 1
+	}
+	if acquired {
+		e.setLeader(true, now)
+		logger.Info("Leader lease acquired", "lease", e.name, "instanceID", e.instanceID)
+	}
+}
+
+func (e *Elector) setLeader(isLeader bool, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.isLeader = isLeader
+	if isLeader {
+		e.acquiredAt = now
+		e.renewedAt = now
+		e.transitions++
+	}
+}
+
+// release освобождает аренду при остановке экземпляра
+func (e *Elector) release() {
+	if !e.IsLeader() {
+		return
+	}
+	e.setLeader(false, time.Now().UTC())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := releaseScript.Run(ctx, e.client, []string{e.key()}, e.instanceID).Err(); err != nil {
+		logger.Warn("Failed to release leader lease", "lease", e.name, "error", err)
+		return
+	}
+	logger.Info("Leader lease released", "lease", e.name, "instanceID", e.instanceID)
+}
+
+// Status возвращает состояние аренды: локальное и текущего держателя по данным Redis
+func (e *Elector) Status(ctx context.Context) Status {
+	e.mu.RLock()
+	status := Status{
+		Name:        e.name,
+		InstanceID:  e.instanceID,
+		IsLeader:    e.isLeader,
+		Transitions: e.transitions,
+	}
+	if e.isLeader {
+		acquiredAt, renewedAt := e.acquiredAt, e.renewedAt
+		status.AcquiredAt, status.RenewedAt = &acquiredAt, &renewedAt
+	}
+	e.mu.RUnlock()
+
+	if holder, err := e.client.Get(ctx, e.key()).Result(); err == nil {
+		status.Holder = holder
+	}
+	if ttl, err := e.client.PTTL(ctx, e.key()).Result(); err == nil && ttl > 0 {
+		status.LeaseTTLMs = ttl.Milliseconds()
+	}
+	return status
+}
+
+// Statuses возвращает состояние всех аренд этого экземпляра
+func Statuses(ctx context.Context) []Status {
+	registryMu.Lock()
+	electors := append([]*Elector(nil), registry...)
+	registryMu.Unlock()
+
+	statuses := make([]Status, 0, len(electors))
+	for _, e := range electors {
+		statuses = append(statuses, e.Status(ctx))
+	}
+	return statuses
+}
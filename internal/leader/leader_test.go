@@ -0,0 +1,112 @@
+package leader_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/leader"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTTL = 300 * time.Millisecond
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+// redisClient подключается к Redis из REDIS_ADDR; без него тесты выборов пропускаются
+func redisClient(t *testing.T) *redis.Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// leaseName возвращает уникальное имя аренды, чтобы тесты не мешали друг другу
+func leaseName(t *testing.T) string {
+	return fmt.Sprintf("test-%s-%d", t.Name(), time.Now().UnixNano())
+}
+
+func TestOnlyOneInstanceBecomesLeader(t *testing.T) {
+	client := redisClient(t)
+	name := leaseName(t)
+	first := leader.NewWithClient(name, client, testTTL)
+	second := leader.NewWithClient(name, client, testTTL)
+
+	first.Tick(context.Background())
+	second.Tick(context.Background())
+
+	assert.True(t, first.IsLeader())
+	assert.False(t, second.IsLeader())
+
+	status := second.Status(context.Background())
+	assert.Equal(t, first.InstanceID(), status.Holder)
+	assert.Greater(t, status.LeaseTTLMs, int64(0))
+}
+
+func TestLeaderRenewsLease(t *testing.T) {
+	client := redisClient(t)
+	name := leaseName(t)
+	first := leader.NewWithClient(name, client, testTTL)
+	second := leader.NewWithClient(name, client, testTTL)
+
+	first.Tick(context.Background())
+	for i := 0; i < 4; i++ {
+		time.Sleep(testTTL / 3)
+		first.Tick(context.Background())
+		second.Tick(context.Background())
+	}
+
+	assert.True(t, first.IsLeader())
+	assert.False(t, second.IsLeader())
+}
+
+func TestFailoverAfterLeaderDies(t *testing.T) {
+	client := redisClient(t)
+	name := leaseName(t)
+	first := leader.NewWithClient(name, client, testTTL)
+	second := leader.NewWithClient(name, client, testTTL)
+
+	first.Tick(context.Background())
+	assert.True(t, first.IsLeader())
+
+	// Лидер перестал продлевать аренду -- после её истечения лидером становится другой экземпляр
+	time.Sleep(testTTL + 50*time.Millisecond)
+	second.Tick(context.Background())
+	assert.True(t, second.IsLeader())
+
+	// Бывший лидер при следующем продлении узнаёт, что аренда уже не его
+	first.Tick(context.Background())
+	assert.False(t, first.IsLeader())
+}
+
+func TestRunReleasesLeaseOnShutdown(t *testing.T) {
+	client := redisClient(t)
+	name := leaseName(t)
+	first := leader.NewWithClient(name, client, time.Minute)
+	second := leader.NewWithClient(name, client, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		first.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, first.IsLeader, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	// Аренда освобождена сразу, ждать минуту не нужно
+	second.Tick(context.Background())
+	assert.True(t, second.IsLeader())
+}
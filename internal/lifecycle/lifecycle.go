@@ -0,0 +1,118 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/robfig/cron/v3"
+)
+
+// StopFunc останавливает компонент, укладываясь в срок ctx
+type StopFunc func(ctx context.Context) error
+
+// component -- зарегистрированная часть сервиса и способ её остановить
+type component struct {
+	name string
+	stop StopFunc
+}
+
+// Manager запускает фоновые задачи сервиса и при остановке завершает компоненты в порядке,
+// обратном регистрации: сначала то, что принимает работу (HTTP, планировщики), в конце -- подключения.
+type Manager struct {
+	mu         sync.Mutex
+	components []component
+	stopping   chan struct{} // Закрывается, когда запрошена остановка
+	stopOnce   sync.Once
+}
+
+// New создаёт пустой Manager
+func New() *Manager {
+	return &Manager{stopping: make(chan struct{})}
+}
+
+// OnStop регистрирует функцию остановки компонента
+func (m *Manager) OnStop(name string, stop StopFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, component{name: name, stop: stop})
+}
+
+// Go запускает фоновую задачу с собственным контекстом. При остановке контекст отменяется,
+// и Manager ждёт возврата run (например, пока завершатся уже начатые задачи cron).
+func (m *Manager) Go(name string, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+
+	m.OnStop(name, func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	})
+}
+
+// Stop запрашивает остановку сервиса (например, если HTTP-сервер не смог запуститься)
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stopping) })
+}
+
+// Wait ждёт сигнала остановки процесса (SIGINT, SIGTERM и т.п.) или вызова Stop
+func (m *Manager) Wait(signals ...os.Signal) {
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	defer signal.Stop(received)
+
+	select {
+	case sig := <-received:
+		logger.Info("Shutdown signal received", "signal", sig.String())
+	case <-m.stopping:
+		logger.Info("Shutdown requested")
+	}
+}
+
+// Shutdown останавливает компоненты в порядке, обратном регистрации. На всю остановку даётся timeout:
+// компонент, не успевший остановиться, пропускается, и остановка продолжается со следующего.
+func (m *Manager) Shutdown(timeout time.Duration) error {
+	m.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	m.mu.Lock()
+	components := append([]component(nil), m.components...)
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		started := time.Now()
+		if err := c.stop(ctx); err != nil {
+			logger.Error("Failed to stop component", "component", c.name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+		logger.Info("Component stopped", "component", c.name, "duration", time.Since(started))
+	}
+	return errors.Join(errs...)
+}
+
+// RunCron запускает планировщик c и работает, пока не отменён ctx. После отмены новые запуски
+// не начинаются, а уже начатые задачи доделываются.
+func RunCron(ctx context.Context, c *cron.Cron) {
+	c.Start()
+	<-ctx.Done()
+	<-c.Stop().Done()
+}
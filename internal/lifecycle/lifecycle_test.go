@@ -0,0 +1,93 @@
+package lifecycle_test
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/lifecycle"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+func TestShutdownStopsComponentsInReverseOrder(t *testing.T) {
+	app := lifecycle.New()
+	var stopped []string
+	for _, name := range []string{"postgres", "message bus", "http server"} {
+		name := name
+		app.OnStop(name, func(context.Context) error {
+			stopped = append(stopped, name)
+			return nil
+		})
+	}
+
+	assert.NoError(t, app.Shutdown(time.Second))
+	assert.Equal(t, []string{"http server", "message bus", "postgres"}, stopped)
+}
+
+func TestGoCancelsContextAndWaitsForReturn(t *testing.T) {
+	app := lifecycle.New()
+	var finished atomic.Bool
+	app.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond) // Доделываем начатую работу
+		finished.Store(true)
+	})
+
+	assert.NoError(t, app.Shutdown(time.Second))
+	assert.True(t, finished.Load())
+}
+
+func TestShutdownContinuesAfterTimeout(t *testing.T) {
+	app := lifecycle.New()
+	closed := false
+	app.OnStop("postgres", func(context.Context) error {
+		closed = true
+		return nil
+	})
+	app.Go("stuck worker", func(context.Context) {
+		select {} // Не реагирует на отмену
+	})
+
+	err := app.Shutdown(20 * time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "stuck worker")
+	// Подключения закрываются, даже если какой-то компонент не успел остановиться
+	assert.True(t, closed)
+}
+
+func TestRunCronFinishesRunningJob(t *testing.T) {
+	c := cron.New(cron.WithSeconds())
+	started := make(chan struct{}, 1)
+	var finished atomic.Bool
+	_, err := c.AddFunc("* * * * * *", func() {
+		select {
+		case started <- struct{}{}:
+		default:
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		lifecycle.RunCron(ctx, c)
+		close(done)
+	}()
+
+	<-started
+	cancel()
+	<-done
+	assert.True(t, finished.Load())
+}
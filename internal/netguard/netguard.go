@@ -0,0 +1,117 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress -- адрес назначения находится во внутренней сети (loopback, частные, link-local и т.п.)
+var ErrPrivateAddress = errors.New("destination address is not public")
+
+// blockedNetworks -- служебные диапазоны, не покрытые методами net.IP
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // "Этот" хост
+	"100.64.0.0/10", // CGNAT
+	"192.0.0.0/24",  // Служебные адреса IETF
+	"198.18.0.0/15", // Тестирование сетевого оборудования
+	"240.0.0.0/4",   // Зарезервировано, в т.ч. 255.255.255.255
+	"64:ff9b::/96",  // NAT64: за ним может быть любой IPv4-адрес
+)
+
+// IsPublicIP сообщает, что ip -- публичный адрес, на который можно отправлять запросы пользователей
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckHost разрешает host и возвращает ErrPrivateAddress, если хотя бы один его адрес не публичный.
+// Проверка при регистрации URL; при отправке адрес ещё раз проверяет клиент из NewHTTPClient.
+func CheckHost(ctx context.Context, host string) error {
+	if allowPrivate() {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublicIP(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// NewHTTPClient создаёт HTTP-клиент для запросов на адреса, заданные пользователями (webhook, Web Push).
+// Адрес проверяется при каждом подключении, уже после разрешения имени: ни редирект,
+// ни подмена DNS-ответа (DNS rebinding) не приведут запрос во внутреннюю сеть.
+// Прокси из окружения не используется: иначе проверялся бы адрес прокси, а не получателя.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// control отклоняет подключение к непубличному адресу
+func control(_, address string, _ syscall.RawConn) error {
+	if allowPrivate() {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// allowPrivate отключает проверку для локальной разработки и тестов (ALLOW_PRIVATE_NETWORK_TARGETS=true)
+func allowPrivate() bool {
+	return os.Getenv("ALLOW_PRIVATE_NETWORK_TARGETS") == "true"
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,51 @@
+package netguard_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/netguard"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for _, address := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"0.0.0.0", "100.64.0.1", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1",
+	} {
+		assert.False(t, netguard.IsPublicIP(net.ParseIP(address)), address)
+	}
+	for _, address := range []string{"8.8.8.8", "140.82.112.3", "2a00:1450:4010:c05::71"} {
+		assert.True(t, netguard.IsPublicIP(net.ParseIP(address)), address)
+	}
+}
+
+func TestCheckHostRejectsPrivateAddresses(t *testing.T) {
+	ctx := context.Background()
+	assert.ErrorIs(t, netguard.CheckHost(ctx, "169.254.169.254"), netguard.ErrPrivateAddress)
+	assert.ErrorIs(t, netguard.CheckHost(ctx, "localhost"), netguard.ErrPrivateAddress)
+	assert.NoError(t, netguard.CheckHost(ctx, "8.8.8.8"))
+}
+
+func TestHTTPClientRefusesPrivateAddressAtDialTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := netguard.NewHTTPClient(time.Second)
+	_, err := client.Get(server.URL)
+	assert.ErrorIs(t, err, netguard.ErrPrivateAddress)
+
+	// Для локальной разработки проверку можно отключить
+	t.Setenv("ALLOW_PRIVATE_NETWORK_TARGETS", "true")
+	resp, err := client.Get(server.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+}
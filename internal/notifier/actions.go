@@ -0,0 +1,40 @@
+package notifier
+
+import (
+	"strconv"
+)
+
+// Действия, доступные прямо из уведомления (POST /notifications/:id/actions)
+const (
+	ActionPaid   = "paid"
+	ActionSnooze = "snooze"
+	ActionSkip   = "skip"
+)
+
+// ActionCategoryReminder -- категория уведомления с кнопками "Оплачено", "Отложить" и "Пропустить".
+// Кнопки категории регистрирует мобильное приложение (Notifications.setNotificationCategoryAsync)
+// и service worker веб-версии.
+const ActionCategoryReminder = "payment_reminder"
+
+// actionCategory возвращает категорию действий для сообщения (пусто -- уведомление без кнопок)
+func actionCategory(msg Message) string {
+	if msg.ActionToken == "" || msg.NotificationID == 0 || msg.event() != EventReminderDue {
+		return ""
+	}
+	return ActionCategoryReminder
+}
+
+// pushData -- данные, которые приложение получает вместе с уведомлением и передаёт обратно при нажатии кнопки
+func pushData(msg Message) map[string]string {
+	data := map[string]string{"event": msg.event()}
+	if msg.Subscription.ID != 0 {
+		data["subscription_id"] = strconv.FormatUint(uint64(msg.Subscription.ID), 10)
+	}
+	if msg.NotificationID != 0 {
+		data["notification_id"] = strconv.FormatUint(uint64(msg.NotificationID), 10)
+	}
+	if actionCategory(msg) != "" {
+		data["action_token"] = msg.ActionToken
+	}
+	return data
+}
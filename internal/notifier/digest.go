@@ -0,0 +1,321 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
+	"github.com/SergeyMilch/pay_aware/internal/lifecycle"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/auth"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/SergeyMilch/pay_aware/pkg/utils"
+	"github.com/robfig/cron/v3"
+)
+
+// Периодичность email-сводки
+const (
+	DigestWeekly  = "weekly"
+	DigestMonthly = "monthly"
+)
+
+const (
+	digestHour            = 9                    // Сводка уходит не раньше 9:00 по времени пользователя
+	digestOverdueLookback = 30 * 24 * time.Hour  // Более старые неоплаченные разовые платежи в сводку не попадают
+	digestUnsubscribeTTL  = 365 * 24 * time.Hour // Ссылка отписки должна работать и в старых письмах
+)
+
+var textEmailTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+
+// DigestItem -- платёж в сводке
+type DigestItem struct {
+	SubscriptionID uint
+	ServiceName    string
+	Cost           float64
+	PaymentDate    time.Time
+}
+
+// Digest -- сводка по платежам пользователя до конца недели или месяца
+type Digest struct {
+	Frequency     string
+	PeriodEnd     time.Time    // Предстоящие платежи берутся с момента отправки до PeriodEnd
+	Upcoming      []DigestItem // Платежи до конца периода
+	UpcomingTotal float64
+	Overdue       []DigestItem // Разовые платежи, дата которых прошла, а оплата не отмечена
+	MonthToDate   float64      // Сумма подписок, отмеченных оплаченными с начала месяца
+}
+
+// IsEmpty сообщает, что в сводке не о чем писать
+func (d Digest) IsEmpty() bool {
+	return len(d.Upcoming) == 0 && len(d.Overdue) == 0 && d.MonthToDate == 0
+}
+
+// DigestPeriodStart возвращает начало текущего периода сводки по времени пользователя:
+// понедельник 9:00 для еженедельной и 1-е число 9:00 для ежемесячной
+func DigestPeriodStart(now time.Time, loc *time.Location, frequency string) time.Time {
+	local := now.In(loc)
+
+	if frequency == DigestMonthly {
+		start := time.Date(local.Year(), local.Month(), 1, digestHour, 0, 0, 0, loc)
+		if start.After(now) {
+			start = start.AddDate(0, -1, 0)
+		}
+		return start
+	}
+
+	daysSinceMonday := (int(local.Weekday()) + 6) % 7
+	start := time.Date(local.Year(), local.Month(), local.Day()-daysSinceMonday, digestHour, 0, 0, 0, loc)
+	if start.After(now) {
+		start = start.AddDate(0, 0, -7)
+	}
+	return start
+}
+
+// digestPeriodEnd возвращает начало следующего периода сводки
+func digestPeriodEnd(periodStart time.Time, frequency string) time.Time {
+	if frequency == DigestMonthly {
+		return periodStart.AddDate(0, 1, 0)
+	}
+	return periodStart.AddDate(0, 0, 7)
+}
+
+// BuildDigest собирает сводку для пользователя на момент now
+func BuildDigest(user models.User, frequency string, now time.Time) (Digest, error) {
+	loc := utils.LoadUserLocation(user.TimeZone)
+	digest := Digest{
+		Frequency: frequency,
+		PeriodEnd: digestPeriodEnd(DigestPeriodStart(now, loc, frequency), frequency),
+	}
+
+	var upcoming []models.Subscription
+	if err := db.GormDB.Where("user_id = ? AND next_payment_date >= ? AND next_payment_date < ?", user.ID, now, digest.PeriodEnd).
+		Order("next_payment_date").
+		Find(&upcoming).Error; err != nil {
+		return Digest{}, fmt.Errorf("failed to load upcoming payments: %w", err)
+	}
+	for _, subscription := range upcoming {
+		digest.Upcoming = append(digest.Upcoming, digestItem(subscription))
+		digest.UpcomingTotal += subscription.Cost
+	}
+
+	paidSubscriptions := db.GormDB.Model(&models.Notification{}).Select("subscription_id").Where("paid_at IS NOT NULL")
+	var overdue []models.Subscription
+	if err := db.GormDB.Where("user_id = ? AND recurrence_type = ? AND next_payment_date BETWEEN ? AND ?", user.ID, "", now.Add(-digestOverdueLookback), now).
+		Where("id NOT IN (?)", paidSubscriptions).
+		Order("next_payment_date").
+		Find(&overdue).Error; err != nil {
+		return Digest{}, fmt.Errorf("failed to load overdue payments: %w", err)
+	}
+	for _, subscription := range overdue {
+		digest.Overdue = append(digest.Overdue, digestItem(subscription))
+	}
+
+	// Каждую подписку считаем один раз, даже если оплата отмечена в нескольких напоминаниях.
+	// Удалённые подписки тоже учитываем: деньги за них уже потрачены.
+	local := now.In(loc)
+	monthStart := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+	paidThisMonth := db.GormDB.Model(&models.Notification{}).Select("subscription_id").
+		Where("user_id = ? AND paid_at >= ? AND paid_at <= ?", user.ID, monthStart, now)
+	if err := db.GormDB.Unscoped().Model(&models.Subscription{}).
+		Where("id IN (?)", paidThisMonth).
+		Select("COALESCE(SUM(cost), 0)").
+		Scan(&digest.MonthToDate).Error; err != nil {
+		return Digest{}, fmt.Errorf("failed to calculate month-to-date spend: %w", err)
+	}
+
+	return digest, nil
+}
+
+func digestItem(subscription models.Subscription) DigestItem {
+	return DigestItem{
+		SubscriptionID: subscription.ID,
+		ServiceName:    subscription.ServiceName,
+		Cost:           subscription.Cost,
+		PaymentDate:    subscription.NextPaymentDate,
+	}
+}
+
+// digestLine -- строка списка платежей в письме, уже отформатированная для локали
+type digestLine struct {
+	Date        string
+	ServiceName string
+	Cost        string
+}
+
+// RenderDigest формирует тему, HTML- и текстовую версии письма со сводкой на языке пользователя
+func RenderDigest(user models.User, digest Digest, unsubscribeLink string) (string, string, string, error) {
+	locale := i18n.Normalize(user.Locale)
+	loc := utils.LoadUserLocation(user.TimeZone)
+
+	lines := func(items []DigestItem) []digestLine {
+		result := make([]digestLine, 0, len(items))
+		for _, item := range items {
+			result = append(result, digestLine{
+				Date:        i18n.FormatDate(locale, item.PaymentDate.In(loc)),
+				ServiceName: item.ServiceName,
+				Cost:        i18n.FormatCurrency(locale, item.Cost, i18n.DefaultCurrency),
+			})
+		}
+		return result
+	}
+
+	subject := i18n.T(locale, "digest.subject_"+digest.Frequency, nil)
+	data := struct {
+		Lang             string
+		Name             string
+		Title            string
+		Greeting         string
+		Summary          string
+		UpcomingLabel    string
+		Upcoming         []digestLine
+		NothingUpcoming  string
+		OverdueLabel     string
+		Overdue          []digestLine
+		MonthToDate      string
+		Footer           string
+		UnsubscribeHint  string
+		UnsubscribeLabel string
+		UnsubscribeLink  string
+	}{
+		Lang:     locale,
+		Name:     user.Name,
+		Title:    subject,
+		Greeting: i18n.T(locale, "email.reminder.greeting", map[string]interface{}{"Name": user.Name}),
+		Summary: i18n.T(locale, "digest.summary_"+digest.Frequency, map[string]interface{}{
+			"Total": i18n.FormatCurrency(locale, digest.UpcomingTotal, i18n.DefaultCurrency),
+			"Count": len(digest.Upcoming),
+		}),
+		UpcomingLabel:   i18n.T(locale, "digest.upcoming", nil),
+		Upcoming:        lines(digest.Upcoming),
+		NothingUpcoming: i18n.T(locale, "digest.nothing_upcoming", nil),
+		OverdueLabel:    i18n.T(locale, "digest.overdue", nil),
+		Overdue:         lines(digest.Overdue),
+		MonthToDate: i18n.T(locale, "digest.month_to_date", map[string]interface{}{
+			"Amount": i18n.FormatCurrency(locale, digest.MonthToDate, i18n.DefaultCurrency),
+		}),
+		Footer:           i18n.T(locale, "email.footer", nil),
+		UnsubscribeHint:  i18n.T(locale, "digest.unsubscribe_hint", nil),
+		UnsubscribeLabel: i18n.T(locale, "digest.unsubscribe", nil),
+		UnsubscribeLink:  unsubscribeLink,
+	}
+
+	var html bytes.Buffer
+	if err := emailTemplates.ExecuteTemplate(&html, "digest.html", data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render digest email: %w", err)
+	}
+	var text bytes.Buffer
+	if err := textEmailTemplates.ExecuteTemplate(&text, "digest.txt", data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render digest text email: %w", err)
+	}
+	return subject, html.String(), text.String(), nil
+}
+
+// SendDigest отправляет сводку письмом со ссылкой отписки в тексте и в заголовке List-Unsubscribe
+func (n *EmailNotifier) SendDigest(user models.User, digest Digest) error {
+	if user.Email == "" {
+		return ErrUnavailable
+	}
+
+	token, err := auth.GenerateUnsubscribeToken(int(user.ID), os.Getenv("JWT_SECRET"), digestUnsubscribeTTL)
+	if err != nil {
+		return fmt.Errorf("failed to generate unsubscribe token: %w", err)
+	}
+	unsubscribeLink := fmt.Sprintf("%s/digest/unsubscribe?token=%s", os.Getenv("PUBLIC_BASE_URL"), token)
+
+	subject, html, text, err := RenderDigest(user, digest, unsubscribeLink)
+	if err != nil {
+		return err
+	}
+
+	// Почтовые клиенты показывают кнопку "Отписаться" и отписывают одним POST-запросом (RFC 8058)
+	headers := map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeLink + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+	if err := utils.SendMultipartEmail(user.Email, subject, html, text, headers); err != nil {
+		return fmt.Errorf("failed to send digest email: %w", err)
+	}
+	return nil
+}
+
+// StartDigestScheduler запускает CRON-задачу, рассылающую еженедельные и ежемесячные сводки, и работает до отмены ctx
+func StartDigestScheduler(ctx context.Context) {
+	c := cron.New()
+
+	_, err := c.AddFunc("@hourly", func() { SendDigests(time.Now().UTC()) })
+	if err != nil {
+		logger.Error("Failed to schedule digest emails", "error", err)
+		return
+	}
+
+	logger.Info("Digest scheduler started")
+	lifecycle.RunCron(ctx, c)
+}
+
+// SendDigests отправляет сводки пользователям, у которых начался новый период.
+// Пропущенные запуски (например, при остановке сервиса) наверстываются в течение периода.
+func SendDigests(now time.Time) {
+	var subscribers []models.NotificationPreference
+	if err := db.GormDB.Where("digest_frequency IN ?", []string{DigestWeekly, DigestMonthly}).Find(&subscribers).Error; err != nil {
+		logger.Error("Failed to load digest subscribers", "error", err)
+		return
+	}
+
+	emailNotifier := NewEmailNotifier()
+	for i := range subscribers {
+		prefs := &subscribers[i]
+		if !channelEnabled(prefs, ChannelEmail) {
+			continue
+		}
+
+		var user models.User
+		if err := db.GormDB.First(&user, prefs.UserID).Error; err != nil {
+			logger.Warn("User not found for digest", "userID", prefs.UserID, "error", err)
+			continue
+		}
+
+		periodStart := DigestPeriodStart(now, utils.LoadUserLocation(user.TimeZone), prefs.DigestFrequency)
+		if prefs.LastDigestAt != nil && !prefs.LastDigestAt.Before(periodStart) {
+			continue
+		}
+
+		// Атомарно отмечаем отправку: при нескольких экземплярах сервиса сводку отправит только один
+		result := db.GormDB.Model(&models.NotificationPreference{}).
+			Where("id = ? AND (last_digest_at IS NULL OR last_digest_at < ?)", prefs.ID, periodStart).
+			Update("last_digest_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		digest, err := BuildDigest(user, prefs.DigestFrequency, now)
+		if err != nil {
+			logger.Error("Failed to build digest", "userID", user.ID, "error", err)
+			restoreLastDigestAt(prefs)
+			continue
+		}
+		if digest.IsEmpty() {
+			logger.Debug("Digest is empty, skipping", "userID", user.ID)
+			continue
+		}
+
+		if err := emailNotifier.SendDigest(user, digest); err != nil {
+			logger.Warn("Failed to send digest", "userID", user.ID, "error", err)
+			restoreLastDigestAt(prefs)
+			continue
+		}
+		logger.Info("Digest sent", "userID", user.ID, "frequency", prefs.DigestFrequency, "upcoming", len(digest.Upcoming))
+	}
+}
+
+// restoreLastDigestAt возвращает прежнюю отметку, чтобы неотправленную сводку повторил следующий запуск
+func restoreLastDigestAt(prefs *models.NotificationPreference) {
+	if err := db.GormDB.Model(&models.NotificationPreference{}).Where("id = ?", prefs.ID).
+		Update("last_digest_at", prefs.LastDigestAt).Error; err != nil {
+		logger.Error("Failed to restore digest timestamp", "userID", prefs.UserID, "error", err)
+	}
+}
@@ -0,0 +1,96 @@
+package notifier_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigestPeriodStart(t *testing.T) {
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+
+	// Среда -> понедельник той же недели, 9:00 по местному времени
+	wednesday := time.Date(2026, 10, 14, 12, 0, 0, 0, moscow)
+	assert.Equal(t, time.Date(2026, 10, 12, 9, 0, 0, 0, moscow), notifier.DigestPeriodStart(wednesday, moscow, notifier.DigestWeekly))
+
+	// До 9:00 понедельника ещё идёт прошлая неделя
+	earlyMonday := time.Date(2026, 10, 12, 8, 0, 0, 0, moscow)
+	assert.Equal(t, time.Date(2026, 10, 5, 9, 0, 0, 0, moscow), notifier.DigestPeriodStart(earlyMonday, moscow, notifier.DigestWeekly))
+
+	// То же для месяца
+	earlyFirst := time.Date(2026, 10, 1, 8, 0, 0, 0, moscow)
+	assert.Equal(t, time.Date(2026, 9, 1, 9, 0, 0, 0, moscow), notifier.DigestPeriodStart(earlyFirst, moscow, notifier.DigestMonthly))
+}
+
+func TestBuildDigestCollectsUpcomingOverdueAndMonthToDate(t *testing.T) {
+	initReceiptsDB(t)
+
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC) // Среда
+	user := models.User{Email: "user@example.com", TimeZone: "UTC"}
+	assert.NoError(t, db.GormDB.Create(&user).Error)
+	userID := int(user.ID)
+
+	createSubscription := func(name string, cost float64, date time.Time, recurrence string) models.Subscription {
+		subscription := models.Subscription{UserID: userID, ServiceName: name, Cost: cost, NextPaymentDate: date, RecurrenceType: recurrence}
+		assert.NoError(t, db.GormDB.Create(&subscription).Error)
+		return subscription
+	}
+	markPaid := func(subscription models.Subscription, paidAt time.Time) {
+		assert.NoError(t, db.GormDB.Create(&models.Notification{UserID: userID, SubscriptionID: int(subscription.ID), SentAt: paidAt, PaidAt: &paidAt}).Error)
+	}
+
+	createSubscription("Music", 300, now.Add(48*time.Hour), "monthly")
+	createSubscription("Cloud", 100, now.Add(96*time.Hour), "")
+	createSubscription("Next week", 999, time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC), "monthly")
+	createSubscription("Forgotten", 500, now.Add(-72*time.Hour), "")
+	paid := createSubscription("Paid", 50, now.Add(-48*time.Hour), "")
+	markPaid(paid, now.Add(-24*time.Hour))
+	markPaid(paid, now.Add(-12*time.Hour)) // Повторная отметка не удваивает сумму
+	deleted := createSubscription("Deleted", 25, now.Add(-240*time.Hour), "")
+	markPaid(deleted, now.Add(-240*time.Hour))
+	assert.NoError(t, db.GormDB.Delete(&deleted).Error)
+
+	digest, err := notifier.BuildDigest(user, notifier.DigestWeekly, now)
+
+	assert.NoError(t, err)
+	if assert.Len(t, digest.Upcoming, 2) {
+		assert.Equal(t, "Music", digest.Upcoming[0].ServiceName)
+		assert.Equal(t, "Cloud", digest.Upcoming[1].ServiceName)
+	}
+	assert.Equal(t, 400.0, digest.UpcomingTotal)
+	if assert.Len(t, digest.Overdue, 1) {
+		assert.Equal(t, "Forgotten", digest.Overdue[0].ServiceName)
+	}
+	assert.Equal(t, 75.0, digest.MonthToDate)
+}
+
+func TestRenderDigestIncludesSummaryAndUnsubscribeLink(t *testing.T) {
+	user := models.User{Name: "Alex", Locale: "en", TimeZone: "UTC"}
+	digest := notifier.Digest{
+		Frequency: notifier.DigestWeekly,
+		Upcoming: []notifier.DigestItem{
+			{ServiceName: "Music", Cost: 300, PaymentDate: time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)},
+			{ServiceName: "Cloud", Cost: 100, PaymentDate: time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		},
+		UpcomingTotal: 400,
+		MonthToDate:   75,
+	}
+
+	subject, html, text, err := notifier.RenderDigest(user, digest, "https://example.com/digest/unsubscribe?token=abc")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Your payments for the week", subject)
+	for _, body := range []string{html, text} {
+		assert.Contains(t, body, "pay ₽400 across 2 subscriptions.")
+		assert.Contains(t, body, "Oct 16, 2026")
+		assert.Contains(t, body, "Paid since the start of the month: ₽75")
+		assert.Contains(t, body, "https://example.com/digest/unsubscribe?token=abc")
+	}
+	assert.NotContains(t, html, "Overdue payments")
+	assert.False(t, strings.Contains(text, "<"), "text version must not contain HTML")
+}
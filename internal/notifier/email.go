@@ -0,0 +1,88 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/SergeyMilch/pay_aware/pkg/utils"
+)
+
+//go:embed templates/*.html templates/*.txt
+var templateFS embed.FS
+
+var emailTemplates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// EmailNotifier доставляет уведомления по электронной почте через SMTP
+type EmailNotifier struct{}
+
+// NewEmailNotifier создаёт email-канал
+func NewEmailNotifier() *EmailNotifier {
+	return &EmailNotifier{}
+}
+
+// Channel возвращает имя канала
+func (n *EmailNotifier) Channel() string {
+	return ChannelEmail
+}
+
+// Send отправляет письмо-напоминание на email пользователя
+func (n *EmailNotifier) Send(_ context.Context, user models.User, msg Message) error {
+	if user.Email == "" {
+		return ErrUnavailable
+	}
+
+	body, err := renderReminderEmail(user, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := utils.SendEmail(user.Email, msg.Title, body); err != nil {
+		return fmt.Errorf("failed to send reminder email: %w", err)
+	}
+	return nil
+}
+
+// renderReminderEmail формирует HTML-тело письма с напоминанием об оплате на языке пользователя
+func renderReminderEmail(user models.User, msg Message) (string, error) {
+	locale := i18n.Normalize(user.Locale)
+	data := struct {
+		Lang             string
+		Name             string
+		Title            string
+		Greeting         string
+		CallToAction     string
+		ServiceLabel     string
+		ServiceName      string
+		CostLabel        string
+		Cost             string
+		PaymentDateLabel string
+		NextPaymentDate  string
+		Footer           string
+		HighPriority     bool
+	}{
+		Lang:             locale,
+		Name:             user.Name,
+		Title:            msg.Title,
+		Greeting:         i18n.T(locale, "email.reminder.greeting", map[string]interface{}{"Name": user.Name}),
+		CallToAction:     i18n.T(locale, "email.reminder.call_to_action", nil),
+		ServiceLabel:     i18n.T(locale, "email.reminder.service", nil),
+		ServiceName:      msg.Subscription.ServiceName,
+		CostLabel:        i18n.T(locale, "email.reminder.cost", nil),
+		Cost:             i18n.FormatCurrency(locale, msg.Subscription.Cost, i18n.DefaultCurrency),
+		PaymentDateLabel: i18n.T(locale, "email.reminder.payment_date", nil),
+		NextPaymentDate:  i18n.FormatDate(locale, msg.Subscription.NextPaymentDate.In(utils.LoadUserLocation(user.TimeZone))),
+		Footer:           i18n.T(locale, "email.footer", nil),
+		HighPriority:     msg.HighPriority,
+	}
+
+	var buf bytes.Buffer
+	if err := emailTemplates.ExecuteTemplate(&buf, "reminder.html", data); err != nil {
+		return "", fmt.Errorf("failed to render reminder email: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,179 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+)
+
+// Статусы доставки push-уведомления по квитанции Expo (models.PushTicket.Status, models.Notification.DeliveryStatus)
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// ExpoNotifier доставляет push-уведомления через Expo Push API
+type ExpoNotifier struct{}
+
+// NewExpoNotifier создаёт канал push-уведомлений Expo
+func NewExpoNotifier() *ExpoNotifier {
+	return &ExpoNotifier{}
+}
+
+// Channel возвращает имя канала
+func (n *ExpoNotifier) Channel() string {
+	return ChannelPush
+}
+
+// Send отправляет push-уведомление на все устройства пользователя. Тикет каждого устройства
+// сохраняется, чтобы позже получить по нему квитанцию о доставке.
+// Ошибка возвращается, только если уведомление не приняли ни для одного устройства.
+func (n *ExpoNotifier) Send(ctx context.Context, user models.User, msg Message) error {
+	var devices []models.Device
+	if err := db.GormDB.Where("user_id = ?", user.ID).Find(&devices).Error; err != nil {
+		return fmt.Errorf("failed to load devices: %w", err)
+	}
+	if len(devices) == 0 {
+		return ErrUnavailable
+	}
+
+	// Отправляем параллельно, чтобы сообщения всех устройств попали в одну пачку ExpoBatcher
+	ticketIDs := make([]string, len(devices))
+	errs := make([]error, len(devices))
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		go func(i int, device models.Device) {
+			defer wg.Done()
+			ticketIDs[i], errs[i] = SendPushNotification(ctx, device.Token, msg)
+		}(i, device)
+	}
+	wg.Wait()
+
+	var lastErr error
+	accepted := 0
+	for i, device := range devices {
+		if errs[i] != nil {
+			logger.Warn("Failed to send push notification to device", "userID", user.ID, "deviceID", device.ID, "error", errs[i])
+			lastErr = errs[i]
+			continue
+		}
+		accepted++
+
+		if msg.NotificationID != 0 && ticketIDs[i] != "" {
+			ticket := models.PushTicket{
+				NotificationID: msg.NotificationID,
+				DeviceID:       device.ID,
+				Token:          device.Token,
+				TicketID:       ticketIDs[i],
+				Status:         DeliveryPending,
+			}
+			if err := db.GormDB.Create(&ticket).Error; err != nil {
+				logger.Warn("Failed to save push ticket", "notificationID", msg.NotificationID, "deviceID", device.ID, "error", err)
+			}
+		}
+	}
+
+	if accepted == 0 {
+		return lastErr
+	}
+	if msg.NotificationID != 0 {
+		if err := db.GormDB.Model(&models.Notification{}).Where("id = ?", msg.NotificationID).Update("delivery_status", DeliveryPending).Error; err != nil {
+			logger.Warn("Failed to update notification delivery status", "notificationID", msg.NotificationID, "error", err)
+		}
+	}
+	return nil
+}
+
+// expoHost возвращает адрес Expo API (EXPO_API_URL позволяет подставить локальную заглушку)
+func expoHost() string {
+	if host := os.Getenv("EXPO_API_URL"); host != "" {
+		return strings.TrimRight(host, "/")
+	}
+	return expo.DefaultHost
+}
+
+// SendPushNotification отправляет push-уведомление с использованием Expo Push API.
+// Сообщение уходит в составе пачки через общий ExpoBatcher.
+// Возвращает ID тикета, по которому позже запрашивается квитанция о доставке.
+func SendPushNotification(ctx context.Context, deviceToken string, msg Message) (string, error) {
+	// Создаем сообщение для отправки
+	pushToken := expo.ExponentPushToken(deviceToken)
+
+	pushMessage := PushMessage{
+		PushMessage: expo.PushMessage{
+			To:        []expo.ExponentPushToken{pushToken},
+			Sound:     "default",
+			Title:     msg.Title,
+			Body:      msg.Body,
+			Data:      pushData(msg),
+			ChannelID: "payment-reminders", // <--- добавляем channelId
+		},
+		CategoryID: actionCategory(msg), // Кнопки "Оплачено", "Отложить", "Пропустить"
+	}
+
+	// Отправляем уведомление
+	response, err := sharedExpoBatcher().Send(ctx, pushMessage)
+	if err != nil {
+		logger.Error("Failed to send push notification", "error", err)
+		return "", fmt.Errorf("failed to send push notification: %v", err)
+	}
+
+	// Тикет с ошибкой: код ошибки Expo лежит в details.error
+	if err := response.ValidateResponse(); err != nil {
+		reason := response.Details["error"]
+		handleExpoError(reason, deviceToken)
+		logger.Warn("Push notification request failed", "error", err, "reason", reason)
+		return "", fmt.Errorf("push notification request failed: %v", err)
+	}
+
+	logger.Info("Push notification sent successfully")
+	logger.Debug("Push notification sent with content", "deviceToken", deviceToken, "message", msg.Body, "ticketID", response.ID)
+	return response.ID, nil
+}
+
+// handleExpoError реагирует на код ошибки Expo из тикета или квитанции
+func handleExpoError(reason, deviceToken string) {
+	switch reason {
+	case expo.ErrorDeviceNotRegistered, "InvalidToken":
+		logger.Warn("Invalid device token. Removing from DB", "token", deviceToken)
+		// Удаляем/обнуляем токен в БД
+		removeDeviceTokenByValue(deviceToken)
+	case expo.ErrorMessageTooBig:
+		logger.Error("Message too big", "token", deviceToken)
+	case expo.ErrorMessageRateExceeded:
+		logger.Error("Message rate exceeded", "token", deviceToken)
+	case "InvalidCredentials":
+		logger.Error("Invalid Expo credentials provided")
+		// Возможно, требуется обновить токены или проверить конфигурацию
+	case "":
+	default:
+		logger.Warn("Unhandled error from Expo", "error", reason)
+	}
+}
+
+// removeDeviceTokenByValue удаляет устройство с токеном, который Expo больше не принимает
+func removeDeviceTokenByValue(token string) {
+	if token == "" {
+		return
+	}
+
+	result := db.GormDB.Unscoped().Where("token = ?", token).Delete(&models.Device{})
+	if result.Error != nil {
+		logger.Error("Failed to remove device", "error", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		logger.Warn("No device found with this token", "token", token)
+		return
+	}
+	logger.Info("Device removed successfully", "token", token)
+}
@@ -0,0 +1,287 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+)
+
+const (
+	expoMaxBatchSize  = 100                    // Максимум сообщений в одном запросе к Expo
+	expoDefaultRate   = 600                    // Лимит Expo: 600 уведомлений в секунду на проект
+	expoFlushInterval = 100 * time.Millisecond // Сколько ждать, пока наберётся пачка
+	expoQueueCapacity = 1000
+)
+
+// ErrBatcherClosed возвращается при отправке через остановленный ExpoBatcher
+var ErrBatcherClosed = errors.New("expo batcher is closed")
+
+// PushMessage -- сообщение Expo Push API. В структуре SDK нет categoryId (кнопки действий),
+// поэтому пачки отправляются своим запросом, а ответы разбираются типами SDK.
+type PushMessage struct {
+	expo.PushMessage
+	CategoryID string `json:"categoryId,omitempty"`
+}
+
+// ExpoBatcher собирает push-сообщения со всех воркеров в пачки до batchSize штук
+// и отправляет их одним запросом, соблюдая ограничение скорости отправки
+type ExpoBatcher struct {
+	host        string
+	accessToken string
+	httpClient  *http.Client
+	batchSize   int
+	interval    time.Duration // Минимальный интервал на одно сообщение (0 -- без ограничения)
+
+	queue    chan *pushRequest
+	done     chan struct{}
+	mu       sync.RWMutex
+	closed   bool
+	nextSend time.Time
+}
+
+// pushRequest -- сообщение в очереди и канал для результата его отправки
+type pushRequest struct {
+	message PushMessage
+	result  chan pushResult
+}
+
+type pushResult struct {
+	response expo.PushResponse
+	err      error
+}
+
+var (
+	sharedBatcher     *ExpoBatcher
+	sharedBatcherOnce sync.Once
+)
+
+// sharedExpoBatcher возвращает общий для всех воркеров отправщик.
+// Скорость задаётся EXPO_PUSH_RATE (уведомлений в секунду).
+func sharedExpoBatcher() *ExpoBatcher {
+	sharedBatcherOnce.Do(func() {
+		rate := expoDefaultRate
+		if value := os.Getenv("EXPO_PUSH_RATE"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				logger.Warn("Invalid EXPO_PUSH_RATE, using default", "value", value, "default", expoDefaultRate)
+			} else {
+				rate = parsed
+			}
+		}
+		sharedBatcher = NewExpoBatcher(expoHost(), os.Getenv("EXPO_ACCESS_TOKEN"), expoMaxBatchSize, rate)
+	})
+	return sharedBatcher
+}
+
+// CloseExpoBatcher останавливает общий отправщик при остановке сервиса: пачки, уже поставленные
+// в очередь, отправляются. Send после этого возвращает ErrBatcherClosed.
+func CloseExpoBatcher(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		sharedExpoBatcher().Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewExpoBatcher создаёт и запускает отправщик для Expo API по адресу host.
+// ratePerSecond <= 0 отключает ограничение скорости.
+func NewExpoBatcher(host, accessToken string, batchSize, ratePerSecond int) *ExpoBatcher {
+	if batchSize <= 0 || batchSize > expoMaxBatchSize {
+		batchSize = expoMaxBatchSize
+	}
+
+	b := &ExpoBatcher{
+		host:        host,
+		accessToken: accessToken,
+		httpClient:  &http.Client{Timeout: 15 * time.Second},
+		batchSize:   batchSize,
+		queue:       make(chan *pushRequest, expoQueueCapacity),
+		done:        make(chan struct{}),
+	}
+	if ratePerSecond > 0 {
+		b.interval = time.Second / time.Duration(ratePerSecond)
+	}
+
+	go b.run()
+	return b
+}
+
+// Send ставит сообщение в очередь и ждёт ответа Expo именно по нему.
+// Ошибка возвращается, только если не удалось отправить запрос целиком;
+// статус отдельного сообщения нужно проверять через response.ValidateResponse().
+func (b *ExpoBatcher) Send(ctx context.Context, message PushMessage) (expo.PushResponse, error) {
+	// Сообщение без получателя испортило бы весь запрос, поэтому проверяем заранее
+	if len(message.To) == 0 {
+		return expo.PushResponse{}, errors.New("no recipients")
+	}
+	for _, recipient := range message.To {
+		if recipient == "" {
+			return expo.PushResponse{}, errors.New("invalid push token")
+		}
+	}
+
+	req := &pushRequest{message: message, result: make(chan pushResult, 1)}
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return expo.PushResponse{}, ErrBatcherClosed
+	}
+	select {
+	case b.queue <- req:
+		b.mu.RUnlock()
+	case <-ctx.Done():
+		b.mu.RUnlock()
+		return expo.PushResponse{}, ctx.Err()
+	}
+
+	select {
+	case res := <-req.result:
+		return res.response, res.err
+	case <-ctx.Done():
+		return expo.PushResponse{}, ctx.Err()
+	}
+}
+
+// Close отправляет сообщения, оставшиеся в очереди, и останавливает отправщик
+func (b *ExpoBatcher) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	<-b.done
+}
+
+// run собирает пачки: до batchSize сообщений или всё, что пришло за expoFlushInterval
+func (b *ExpoBatcher) run() {
+	defer close(b.done)
+
+	for {
+		first, ok := <-b.queue
+		if !ok {
+			return
+		}
+
+		batch := []*pushRequest{first}
+		timer := time.NewTimer(expoFlushInterval)
+	collect:
+		for len(batch) < b.batchSize {
+			select {
+			case req, ok := <-b.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		b.flush(batch)
+	}
+}
+
+// flush отправляет пачку одним запросом и раздаёт ответы отправителям
+func (b *ExpoBatcher) flush(batch []*pushRequest) {
+	b.throttle(len(batch))
+
+	messages := make([]PushMessage, len(batch))
+	for i, req := range batch {
+		messages[i] = req.message
+	}
+
+	responses, err := b.publish(messages)
+	if err != nil {
+		logger.Error("Failed to send push notification batch", "size", len(batch), "error", err)
+		for _, req := range batch {
+			req.result <- pushResult{err: err}
+		}
+		return
+	}
+
+	// Ответы приходят в порядке сообщений; ошибка одного сообщения не затрагивает остальные
+	for i, req := range batch {
+		req.result <- pushResult{response: responses[i]}
+	}
+	logger.Debug("Push notification batch sent", "size", len(batch))
+}
+
+// publish отправляет пачку в Expo и возвращает ответы в порядке сообщений
+func (b *ExpoBatcher) publish(messages []PushMessage) ([]expo.PushResponse, error) {
+	body, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, b.host+expo.DefaultBaseAPIURL+"/push/send", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+b.accessToken)
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("push request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("expo responded with status %d", resp.StatusCode)
+	}
+
+	var result expo.Response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode push response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("expo returned errors: %v", result.Errors)
+	}
+	if len(result.Data) != len(messages) {
+		return nil, fmt.Errorf("expo returned %d tickets for %d messages", len(result.Data), len(messages))
+	}
+
+	for i := range result.Data {
+		result.Data[i].PushMessage = messages[i].PushMessage
+	}
+	return result.Data, nil
+}
+
+// throttle выдерживает паузу так, чтобы в среднем отправлялось не больше заданного числа сообщений в секунду
+func (b *ExpoBatcher) throttle(n int) {
+	if b.interval == 0 {
+		return
+	}
+
+	now := time.Now()
+	if b.nextSend.After(now) {
+		time.Sleep(b.nextSend.Sub(now))
+		now = b.nextSend
+	}
+	b.nextSend = now.Add(time.Duration(n) * b.interval)
+}
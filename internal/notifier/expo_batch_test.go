@@ -0,0 +1,139 @@
+package notifier_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeExpoSend поднимает заглушку /push/send: токены из invalid получают ошибку DeviceNotRegistered.
+// Возвращает адрес заглушки и функцию, отдающую размеры полученных пачек.
+func fakeExpoSend(t *testing.T, invalid map[string]bool) (string, func() []int) {
+	var mu sync.Mutex
+	var batches []int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/--/api/v2/push/send", r.URL.Path)
+
+		var messages []expo.PushMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&messages))
+
+		mu.Lock()
+		batches = append(batches, len(messages))
+		mu.Unlock()
+
+		data := make([]map[string]interface{}, 0, len(messages))
+		for i, message := range messages {
+			if invalid[string(message.To[0])] {
+				data = append(data, map[string]interface{}{
+					"status":  "error",
+					"message": "device not registered",
+					"details": map[string]string{"error": "DeviceNotRegistered"},
+				})
+				continue
+			}
+			data = append(data, map[string]interface{}{"status": "ok", "id": fmt.Sprintf("ticket-%d", i)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), batches...)
+	}
+}
+
+// sendConcurrently отправляет сообщения на токены параллельно, как это делают воркеры
+func sendConcurrently(b *notifier.ExpoBatcher, tokens []string) ([]expo.PushResponse, []error) {
+	responses := make([]expo.PushResponse, len(tokens))
+	errs := make([]error, len(tokens))
+
+	var wg sync.WaitGroup
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+			responses[i], errs[i] = b.Send(context.Background(), notifier.PushMessage{
+				PushMessage: expo.PushMessage{
+					To:    []expo.ExponentPushToken{expo.ExponentPushToken(token)},
+					Title: "Test",
+				},
+			})
+		}(i, token)
+	}
+	wg.Wait()
+	return responses, errs
+}
+
+func TestExpoBatcherGroupsMessagesIntoBatches(t *testing.T) {
+	host, batches := fakeExpoSend(t, nil)
+	b := notifier.NewExpoBatcher(host, "", 100, 0)
+	defer b.Close()
+
+	tokens := make([]string, 150)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("ExponentPushToken[%d]", i)
+	}
+
+	responses, errs := sendConcurrently(b, tokens)
+
+	for i := range tokens {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, expo.SuccessStatus, responses[i].Status)
+		assert.NotEmpty(t, responses[i].ID)
+	}
+	assert.ElementsMatch(t, []int{100, 50}, batches())
+}
+
+func TestExpoBatcherReportsPartialFailuresPerMessage(t *testing.T) {
+	host, _ := fakeExpoSend(t, map[string]bool{"ExponentPushToken[gone]": true})
+	b := notifier.NewExpoBatcher(host, "", 100, 0)
+	defer b.Close()
+
+	responses, errs := sendConcurrently(b, []string{"ExponentPushToken[ok]", "ExponentPushToken[gone]"})
+
+	assert.NoError(t, errs[0])
+	assert.NoError(t, responses[0].ValidateResponse())
+
+	assert.NoError(t, errs[1])
+	assert.IsType(t, &expo.DeviceNotRegisteredError{}, responses[1].ValidateResponse())
+}
+
+func TestExpoBatcherEnforcesSendRate(t *testing.T) {
+	host, batches := fakeExpoSend(t, nil)
+	b := notifier.NewExpoBatcher(host, "", 2, 20) // 20 сообщений в секунду: пачка из 2 -- раз в 100мс
+	defer b.Close()
+
+	start := time.Now()
+	_, errs := sendConcurrently(b, []string{"a", "b", "c", "d", "e", "f"})
+	elapsed := time.Since(start)
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []int{2, 2, 2}, batches())
+	assert.GreaterOrEqual(t, elapsed, 200*time.Millisecond)
+}
+
+func TestExpoBatcherRejectsSendAfterClose(t *testing.T) {
+	host, _ := fakeExpoSend(t, nil)
+	b := notifier.NewExpoBatcher(host, "", 100, 0)
+	b.Close()
+
+	_, err := b.Send(context.Background(), notifier.PushMessage{
+		PushMessage: expo.PushMessage{To: []expo.ExponentPushToken{"ExponentPushToken[x]"}},
+	})
+
+	assert.ErrorIs(t, err, notifier.ErrBatcherClosed)
+}
@@ -0,0 +1,253 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/leader"
+	"github.com/SergeyMilch/pay_aware/internal/lifecycle"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	expo "github.com/oliveroneill/exponent-server-sdk-golang/sdk"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	receiptBatchSize = 1000             // Максимум ID в одном запросе getReceipts
+	receiptDelay     = 15 * time.Minute // Expo рекомендует запрашивать квитанции не раньше чем через 15 минут
+	receiptTTL       = 24 * time.Hour   // Дольше Expo квитанции не хранит
+	receiptsLease    = "push-receipts"  // Аренда в Redis: квитанции проверяет один экземпляр
+)
+
+// PushReceipt -- квитанция Expo о доставке push-уведомления в APNs/FCM
+type PushReceipt struct {
+	Status  string                 `json:"status"` // "ok" или "error"
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details"`
+}
+
+// reason возвращает код ошибки из квитанции (например, "DeviceNotRegistered")
+func (r PushReceipt) reason() string {
+	if r.Details != nil {
+		if code, ok := r.Details["error"].(string); ok && code != "" {
+			return code
+		}
+	}
+	if r.Message != "" {
+		return r.Message
+	}
+	return "UnknownError"
+}
+
+var receiptsHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// GetPushReceipts запрашивает квитанции по ID тикетов. Квитанций, которые ещё не готовы, в ответе нет.
+func GetPushReceipts(ctx context.Context, ticketIDs []string) (map[string]PushReceipt, error) {
+	body, err := json.Marshal(map[string][]string{"ids": ticketIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s%s/push/getReceipts", expoHost(), expo.DefaultBaseAPIURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create receipts request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("EXPO_ACCESS_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := receiptsHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("receipts request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("expo responded with status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data   map[string]PushReceipt `json:"data"`
+		Errors []map[string]string    `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode receipts response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("expo returned errors: %v", result.Errors)
+	}
+	return result.Data, nil
+}
+
+// StartReceiptPoller запускает CRON-задачу, проверяющую квитанции о доставке push-уведомлений, и работает до отмены ctx.
+// Квитанции проверяет только держатель аренды receiptsLease: иначе экземпляры запрашивали бы одни и те же
+// квитанции и параллельно обновляли бы одни и те же тикеты и токены устройств.
+func StartReceiptPoller(ctx context.Context) {
+	c := cron.New()
+	elector := leader.New(receiptsLease)
+
+	_, err := c.AddFunc("@every 5m", func() {
+		if elector.IsLeader() {
+			CheckPushReceipts(ctx)
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule push receipts poller", "error", err)
+		return
+	}
+
+	electorDone := make(chan struct{})
+	go func() {
+		// При остановке аренда освобождается, чтобы другой экземпляр не ждал её истечения
+		elector.Run(ctx)
+		close(electorDone)
+	}()
+
+	logger.Info("Push receipts poller started")
+	lifecycle.RunCron(ctx, c)
+	<-electorDone
+}
+
+// CheckPushReceipts обновляет статусы тикетов, ждущих квитанции, и итоговый статус доставки уведомлений.
+// Токены устройств, которые Expo больше не принимает, удаляются.
+func CheckPushReceipts(ctx context.Context) {
+	now := time.Now().UTC()
+
+	// Квитанции, которые так и не появились за время хранения, уже не придут
+	var expired []uint
+	if err := db.GormDB.Model(&models.PushTicket{}).
+		Where("status = ? AND created_at < ?", DeliveryPending, now.Add(-receiptTTL)).
+		Pluck("DISTINCT notification_id", &expired).Error; err != nil {
+		logger.Error("Failed to load expired push tickets", "error", err)
+	} else if len(expired) > 0 {
+		if err := db.GormDB.Model(&models.PushTicket{}).
+			Where("status = ? AND created_at < ?", DeliveryPending, now.Add(-receiptTTL)).
+			Updates(map[string]interface{}{"status": DeliveryFailed, "failure_reason": "ReceiptExpired"}).Error; err != nil {
+			logger.Error("Failed to expire push tickets", "error", err)
+		}
+		refreshDeliveryStatus(expired)
+	}
+
+	// Идём по тикетам по возрастанию id: неготовые квитанции в начале не мешают проверить более новые
+	var lastID uint
+	for ctx.Err() == nil {
+		var tickets []models.PushTicket
+		if err := db.GormDB.
+			Where("status = ? AND created_at <= ? AND id > ?", DeliveryPending, now.Add(-receiptDelay), lastID).
+			Order("id").
+			Limit(receiptBatchSize).
+			Find(&tickets).Error; err != nil {
+			logger.Error("Failed to load pending push tickets", "error", err)
+			return
+		}
+		if len(tickets) == 0 {
+			return
+		}
+		lastID = tickets[len(tickets)-1].ID
+
+		resolved, err := applyPushReceipts(ctx, tickets)
+		if err != nil {
+			// Expo недоступен: остальные пачки проверим в следующий запуск
+			logger.Warn("Failed to fetch push receipts", "error", err)
+			return
+		}
+		logger.Debug("Push receipts processed", "tickets", len(tickets), "resolved", resolved)
+
+		if len(tickets) < receiptBatchSize {
+			return
+		}
+	}
+}
+
+// applyPushReceipts запрашивает квитанции для пачки тикетов и возвращает число обработанных
+func applyPushReceipts(ctx context.Context, tickets []models.PushTicket) (int, error) {
+	ticketIDs := make([]string, 0, len(tickets))
+	for _, ticket := range tickets {
+		ticketIDs = append(ticketIDs, ticket.TicketID)
+	}
+
+	receipts, err := GetPushReceipts(ctx, ticketIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	resolved := 0
+	var notificationIDs []uint
+	for _, ticket := range tickets {
+		receipt, ok := receipts[ticket.TicketID]
+		if !ok {
+			continue
+		}
+		resolved++
+
+		updates := map[string]interface{}{"status": DeliveryDelivered, "failure_reason": ""}
+		if receipt.Status != expo.SuccessStatus {
+			reason := receipt.reason()
+			updates = map[string]interface{}{"status": DeliveryFailed, "failure_reason": reason}
+			logger.Warn("Push notification was not delivered", "notificationID", ticket.NotificationID, "deviceID", ticket.DeviceID, "reason", reason)
+			handleExpoError(reason, ticket.Token)
+		}
+
+		if err := db.GormDB.Model(&models.PushTicket{}).Where("id = ?", ticket.ID).Updates(updates).Error; err != nil {
+			logger.Error("Failed to update push ticket status", "ticketID", ticket.ID, "error", err)
+			continue
+		}
+		notificationIDs = append(notificationIDs, ticket.NotificationID)
+	}
+
+	refreshDeliveryStatus(notificationIDs)
+	return resolved, nil
+}
+
+// refreshDeliveryStatus пересчитывает статус доставки уведомлений по их тикетам:
+// "delivered" -- доставлено хотя бы на одно устройство, "failed" -- не доставлено ни на одно
+func refreshDeliveryStatus(notificationIDs []uint) {
+	seen := map[uint]bool{}
+	for _, notificationID := range notificationIDs {
+		if notificationID == 0 || seen[notificationID] {
+			continue
+		}
+		seen[notificationID] = true
+
+		var tickets []models.PushTicket
+		if err := db.GormDB.Where("notification_id = ?", notificationID).Find(&tickets).Error; err != nil {
+			logger.Error("Failed to load push tickets", "notificationID", notificationID, "error", err)
+			continue
+		}
+		if len(tickets) == 0 {
+			continue
+		}
+
+		status, reason := DeliveryFailed, ""
+		for _, ticket := range tickets {
+			if ticket.Status == DeliveryDelivered {
+				status = DeliveryDelivered
+				break
+			}
+			if ticket.Status == DeliveryPending {
+				status = DeliveryPending
+			}
+			if reason == "" {
+				reason = ticket.FailureReason
+			}
+		}
+		if status != DeliveryFailed {
+			reason = ""
+		}
+
+		if err := db.GormDB.Model(&models.Notification{}).Where("id = ?", notificationID).Updates(map[string]interface{}{
+			"delivery_status": status,
+			"failure_reason":  reason,
+		}).Error; err != nil {
+			logger.Error("Failed to update push delivery status", "notificationID", notificationID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package notifier_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// initReceiptsDB создаёт чистую базу в памяти с пользователями, устройствами и историей уведомлений
+func initReceiptsDB(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal("Failed to initialize mock database", err)
+	}
+	tables := []interface{}{&models.User{}, &models.Subscription{}, &models.Notification{}, &models.Device{}, &models.PushTicket{}}
+	gormDB.Migrator().DropTable(tables...)
+	gormDB.AutoMigrate(tables...)
+
+	// SQLite не разбирает колонки timestamptz обратно в time.Time, пересоздаём их с datetime
+	for _, table := range []string{"users", "subscriptions", "notifications", "devices", "push_tickets"} {
+		var ddl string
+		gormDB.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&ddl)
+		gormDB.Exec("DROP TABLE " + table)
+		gormDB.Exec(strings.ReplaceAll(ddl, "timestamptz", "datetime"))
+	}
+	db.GormDB = gormDB
+}
+
+// fakeExpo поднимает заглушку Expo API, отвечающую на getReceipts заданными квитанциями
+func fakeExpo(t *testing.T, receipts map[string]notifier.PushReceipt) *[]string {
+	requested := &[]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/--/api/v2/push/getReceipts", r.URL.Path)
+
+		var body struct {
+			IDs []string `json:"ids"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		*requested = append(*requested, body.IDs...)
+
+		data := map[string]notifier.PushReceipt{}
+		for _, id := range body.IDs {
+			if receipt, ok := receipts[id]; ok {
+				data[id] = receipt
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("EXPO_API_URL", server.URL)
+	return requested
+}
+
+// createTicket создаёт тикет устройства для уведомления
+func createTicket(t *testing.T, notificationID uint, token, ticketID string, createdAt time.Time) models.PushTicket {
+	ticket := models.PushTicket{NotificationID: notificationID, Token: token, TicketID: ticketID, Status: notifier.DeliveryPending}
+	ticket.CreatedAt = createdAt
+	assert.NoError(t, db.GormDB.Create(&ticket).Error)
+	return ticket
+}
+
+// reloadNotification перечитывает уведомление из базы
+func reloadNotification(id uint) models.Notification {
+	var n models.Notification
+	db.GormDB.First(&n, id)
+	return n
+}
+
+func TestCheckPushReceiptsUpdatesDeliveryStatus(t *testing.T) {
+	initReceiptsDB(t)
+
+	device := models.Device{UserID: 1, Token: "ExponentPushToken[stale]"}
+	assert.NoError(t, db.GormDB.Create(&device).Error)
+
+	notifications := make([]models.Notification, 4)
+	for i := range notifications {
+		notifications[i] = models.Notification{UserID: 1, SentAt: time.Now().UTC(), DeliveryStatus: notifier.DeliveryPending}
+		assert.NoError(t, db.GormDB.Create(&notifications[i]).Error)
+	}
+	delivered, failed, notReady, tooFresh := notifications[0], notifications[1], notifications[2], notifications[3]
+
+	old := time.Now().UTC().Add(-30 * time.Minute)
+	createTicket(t, delivered.ID, "ExponentPushToken[phone]", "ticket-ok", old)
+	createTicket(t, delivered.ID, device.Token, "ticket-gone-1", old) // Второе устройство не получило, но первое -- да
+	createTicket(t, failed.ID, device.Token, "ticket-gone-2", old)
+	createTicket(t, notReady.ID, "ExponentPushToken[phone]", "ticket-later", old)
+	createTicket(t, tooFresh.ID, "ExponentPushToken[phone]", "ticket-fresh", time.Now().UTC())
+
+	gone := notifier.PushReceipt{Status: "error", Message: "device not registered", Details: map[string]interface{}{"error": "DeviceNotRegistered"}}
+	requested := fakeExpo(t, map[string]notifier.PushReceipt{
+		"ticket-ok":     {Status: "ok"},
+		"ticket-gone-1": gone,
+		"ticket-gone-2": gone,
+	})
+
+	notifier.CheckPushReceipts(context.Background())
+
+	assert.ElementsMatch(t, []string{"ticket-ok", "ticket-gone-1", "ticket-gone-2", "ticket-later"}, *requested)
+
+	assert.Equal(t, notifier.DeliveryDelivered, reloadNotification(delivered.ID).DeliveryStatus)
+	assert.Equal(t, notifier.DeliveryFailed, reloadNotification(failed.ID).DeliveryStatus)
+	assert.Equal(t, "DeviceNotRegistered", reloadNotification(failed.ID).FailureReason)
+	assert.Equal(t, notifier.DeliveryPending, reloadNotification(notReady.ID).DeliveryStatus)
+	assert.Equal(t, notifier.DeliveryPending, reloadNotification(tooFresh.ID).DeliveryStatus)
+
+	// Устройство, токен которого Expo больше не принимает, удалено
+	var count int64
+	db.GormDB.Model(&models.Device{}).Where("id = ?", device.ID).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestCheckPushReceiptsExpiresOldTickets(t *testing.T) {
+	initReceiptsDB(t)
+
+	notification := models.Notification{UserID: 1, SentAt: time.Now().UTC().Add(-25 * time.Hour), DeliveryStatus: notifier.DeliveryPending}
+	assert.NoError(t, db.GormDB.Create(&notification).Error)
+	createTicket(t, notification.ID, "ExponentPushToken[phone]", "ticket-old", time.Now().UTC().Add(-25*time.Hour))
+
+	requested := fakeExpo(t, nil)
+
+	notifier.CheckPushReceipts(context.Background())
+
+	assert.Empty(t, *requested)
+
+	got := reloadNotification(notification.ID)
+	assert.Equal(t, notifier.DeliveryFailed, got.DeliveryStatus)
+	assert.Equal(t, "ReceiptExpired", got.FailureReason)
+}
+
+func TestCheckPushReceiptsReachesTicketsBehindUnresolvedBatch(t *testing.T) {
+	initReceiptsDB(t)
+
+	// Полная пачка старых тикетов, квитанции по которым ещё не готовы
+	old := time.Now().UTC().Add(-30 * time.Minute)
+	stuck := make([]models.PushTicket, 1000)
+	for i := range stuck {
+		stuck[i] = models.PushTicket{Token: "ExponentPushToken[phone]", TicketID: fmt.Sprintf("ticket-later-%d", i), Status: notifier.DeliveryPending}
+		stuck[i].CreatedAt = old
+	}
+	assert.NoError(t, db.GormDB.CreateInBatches(stuck, 200).Error)
+
+	notification := models.Notification{UserID: 1, SentAt: time.Now().UTC(), DeliveryStatus: notifier.DeliveryPending}
+	assert.NoError(t, db.GormDB.Create(&notification).Error)
+	createTicket(t, notification.ID, "ExponentPushToken[phone]", "ticket-ok", old)
+
+	requested := fakeExpo(t, map[string]notifier.PushReceipt{"ticket-ok": {Status: "ok"}})
+
+	notifier.CheckPushReceipts(context.Background())
+
+	assert.Len(t, *requested, 1001)
+	assert.Equal(t, notifier.DeliveryDelivered, reloadNotification(notification.ID).DeliveryStatus)
+}
@@ -0,0 +1,144 @@
+package notifier_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var (
+	expoSendOnce sync.Once
+	expoSentMu   sync.Mutex
+	expoSent     []notifier.PushMessage // Все сообщения, полученные заглушкой
+)
+
+// sentPushMessages возвращает сообщения, полученные заглушкой для токена
+func sentPushMessages(token string) []notifier.PushMessage {
+	expoSentMu.Lock()
+	defer expoSentMu.Unlock()
+
+	var result []notifier.PushMessage
+	for _, message := range expoSent {
+		if string(message.To[0]) == token {
+			result = append(result, message)
+		}
+	}
+	return result
+}
+
+// useFakeExpoSend направляет общий ExpoBatcher на заглушку /push/send.
+// Батчер создаётся один раз на процесс, поэтому и заглушка живёт до конца тестов.
+// Токены, содержащие "gone", получают ошибку DeviceNotRegistered.
+func useFakeExpoSend() {
+	expoSendOnce.Do(func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var messages []notifier.PushMessage
+			json.NewDecoder(r.Body).Decode(&messages)
+
+			expoSentMu.Lock()
+			expoSent = append(expoSent, messages...)
+			expoSentMu.Unlock()
+
+			data := make([]map[string]interface{}, 0, len(messages))
+			for _, message := range messages {
+				token := string(message.To[0])
+				if strings.Contains(token, "gone") {
+					data = append(data, map[string]interface{}{
+						"status":  "error",
+						"message": "device not registered",
+						"details": map[string]string{"error": "DeviceNotRegistered"},
+					})
+					continue
+				}
+				data = append(data, map[string]interface{}{"status": "ok", "id": "ticket-" + token})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+		}))
+		os.Setenv("EXPO_API_URL", server.URL)
+	})
+}
+
+func TestExpoNotifierFansOutToAllDevices(t *testing.T) {
+	initReceiptsDB(t)
+	useFakeExpoSend()
+
+	user := models.User{Email: "user@example.com"}
+	assert.NoError(t, db.GormDB.Create(&user).Error)
+	for _, token := range []string{"phone", "tablet", "gone"} {
+		assert.NoError(t, db.GormDB.Create(&models.Device{UserID: int(user.ID), Token: token, LastSeenAt: time.Now().UTC()}).Error)
+	}
+	notification := models.Notification{UserID: int(user.ID), SentAt: time.Now().UTC()}
+	assert.NoError(t, db.GormDB.Create(&notification).Error)
+
+	err := notifier.NewExpoNotifier().Send(context.Background(), user, notifier.Message{
+		Title:          "Test",
+		Body:           "Body",
+		NotificationID: notification.ID,
+	})
+	assert.NoError(t, err)
+
+	var tickets []models.PushTicket
+	db.GormDB.Where("notification_id = ?", notification.ID).Order("ticket_id").Find(&tickets)
+	if assert.Len(t, tickets, 2) {
+		assert.Equal(t, "ticket-phone", tickets[0].TicketID)
+		assert.Equal(t, "ticket-tablet", tickets[1].TicketID)
+	}
+	assert.Equal(t, notifier.DeliveryPending, reloadNotification(notification.ID).DeliveryStatus)
+
+	// Устройство с недействительным токеном удалено, остальные остались
+	var tokens []string
+	db.GormDB.Model(&models.Device{}).Order("token").Pluck("token", &tokens)
+	assert.Equal(t, []string{"phone", "tablet"}, tokens)
+}
+
+func TestExpoNotifierUnavailableWithoutDevices(t *testing.T) {
+	initReceiptsDB(t)
+
+	user := models.User{Email: "user@example.com"}
+	assert.NoError(t, db.GormDB.Create(&user).Error)
+
+	err := notifier.NewExpoNotifier().Send(context.Background(), user, notifier.Message{Title: "Test"})
+
+	assert.ErrorIs(t, err, notifier.ErrUnavailable)
+}
+
+func TestExpoNotifierAddsActionCategoryToReminders(t *testing.T) {
+	initReceiptsDB(t)
+	useFakeExpoSend()
+
+	user := models.User{Email: "user@example.com"}
+	assert.NoError(t, db.GormDB.Create(&user).Error)
+	assert.NoError(t, db.GormDB.Create(&models.Device{UserID: int(user.ID), Token: "actions-phone"}).Error)
+
+	expoSentMu.Lock()
+	expoSent = nil
+	expoSentMu.Unlock()
+
+	err := notifier.NewExpoNotifier().Send(context.Background(), user, notifier.Message{
+		Title:          "Test",
+		Subscription:   models.Subscription{Model: gorm.Model{ID: 7}},
+		NotificationID: 42,
+		ActionToken:    "signed-token",
+	})
+	assert.NoError(t, err)
+
+	sent := sentPushMessages("actions-phone")
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, notifier.ActionCategoryReminder, sent[0].CategoryID)
+		assert.Equal(t, "42", sent[0].Data["notification_id"])
+		assert.Equal(t, "7", sent[0].Data["subscription_id"])
+		assert.Equal(t, "signed-token", sent[0].Data["action_token"])
+	}
+}
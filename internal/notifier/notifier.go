@@ -0,0 +1,156 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+)
+
+// Каналы доставки уведомлений
+const (
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+)
+
+// ErrUnavailable возвращается, если канал не может доставить уведомление пользователю
+// (например, нет токена устройства). В этом случае Dispatch пробует следующий канал.
+var ErrUnavailable = errors.New("notification channel is unavailable for user")
+
+// Message -- уведомление, независимое от канала доставки
+type Message struct {
+	Event        string // Тип события для маршрутизации, по умолчанию EventReminderDue
+	Title        string
+	Body         string
+	HighPriority bool
+	Subscription models.Subscription
+
+	NotificationID uint   // Запись истории, к которой привязывается тикет доставки push (0 -- без записи)
+	ActionToken    string // Подписанный токен для кнопок действий в уведомлении (пусто -- без кнопок)
+}
+
+// event возвращает тип события сообщения
+func (m Message) event() string {
+	if m.Event == "" {
+		return EventReminderDue
+	}
+	return m.Event
+}
+
+// Notifier -- канал доставки уведомлений
+type Notifier interface {
+	Channel() string
+	Send(ctx context.Context, user models.User, msg Message) error
+}
+
+// fallbackOrder -- порядок перебора каналов, если предпочтительный недоступен
+var fallbackOrder = []string{ChannelPush, ChannelWebPush, ChannelTelegram, ChannelEmail}
+
+var notifiers = map[string]Notifier{}
+
+// Init регистрирует все поддерживаемые каналы доставки
+func Init() {
+	Register(NewExpoNotifier())
+	Register(NewEmailNotifier())
+	Register(NewWebhookNotifier())
+
+	// Telegram подключается, только если задан токен бота
+	if telegramBot = newTelegramBotFromEnv(); telegramBot != nil {
+		Register(NewTelegramNotifier(telegramBot))
+	}
+
+	// Web Push подключается, только если заданы VAPID-ключи
+	if vapidKeys = newVAPIDKeysFromEnv(); vapidKeys != nil {
+		Register(NewWebPushNotifier(vapidKeys))
+	}
+	logger.Info("Notification channels initialized", "channels", len(notifiers))
+}
+
+// Register добавляет канал доставки (или заменяет уже зарегистрированный с тем же именем)
+func Register(n Notifier) {
+	notifiers[n.Channel()] = n
+}
+
+// IsSupported проверяет, зарегистрирован ли канал с указанным именем
+func IsSupported(channel string) bool {
+	_, ok := notifiers[channel]
+	return ok
+}
+
+// Dispatch отправляет уведомление без учёта сохранённых настроек пользователя
+// (в предпочтительный канал с фолбэком на остальные).
+// Возвращает каналы, через которые уведомление было доставлено, через запятую.
+func Dispatch(ctx context.Context, user models.User, msg Message) (string, error) {
+	channels, err := DispatchWithPreferences(ctx, user, nil, msg)
+	return strings.Join(channels, ","), err
+}
+
+// DispatchWithPreferences отправляет уведомление во все каналы, выбранные настройками prefs
+// (nil -- настройки по умолчанию). Если ни один из личных каналов (push, webpush, telegram, email)
+// не сработал, пробует остальные включённые личные каналы по порядку fallbackOrder.
+// Возвращает каналы, через которые уведомление было доставлено.
+func DispatchWithPreferences(ctx context.Context, user models.User, prefs *models.NotificationPreference, msg Message) ([]string, error) {
+	var delivered []string
+	var lastErr error
+	attempted := map[string]bool{}
+
+	send := func(channel string) bool {
+		attempted[channel] = true
+		n, ok := notifiers[channel]
+		if !ok {
+			return false
+		}
+
+		err := n.Send(ctx, user, msg)
+		if err == nil {
+			delivered = append(delivered, channel)
+			return true
+		}
+
+		if errors.Is(err, ErrUnavailable) {
+			logger.Debug("Notification channel unavailable", "userID", user.ID, "channel", channel)
+		} else {
+			logger.Warn("Failed to send notification", "userID", user.ID, "channel", channel, "error", err)
+		}
+		lastErr = err
+		return false
+	}
+
+	routedPersonal, deliveredPersonal := false, false
+	for _, channel := range resolveChannels(user, prefs, msg) {
+		personal := IsPersonalChannel(channel)
+		routedPersonal = routedPersonal || personal
+		if send(channel) && personal {
+			deliveredPersonal = true
+		}
+	}
+
+	// Фолбэк только если пользователь ждал уведомление лично, а не только на webhook
+	if routedPersonal && !deliveredPersonal {
+		for _, channel := range fallbackOrder {
+			if attempted[channel] || !channelEnabled(prefs, channel) {
+				continue
+			}
+			logger.Debug("Trying fallback notification channel", "userID", user.ID, "channel", channel)
+			if send(channel) {
+				break
+			}
+		}
+	}
+
+	if len(delivered) > 0 {
+		return delivered, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no notification channels registered")
+	}
+	return nil, lastErr
+}
+
+// IsPersonalChannel проверяет, что канал доставляет уведомление самому пользователю
+func IsPersonalChannel(channel string) bool {
+	return contains(fallbackOrder, channel)
+}
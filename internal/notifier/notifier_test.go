@@ -0,0 +1,76 @@
+package notifier_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNotifier -- канал для тестов, запоминающий отправленные сообщения
+type fakeNotifier struct {
+	channel string
+	err     error
+	sent    []notifier.Message
+}
+
+func (f *fakeNotifier) Channel() string { return f.channel }
+
+func (f *fakeNotifier) Send(_ context.Context, _ models.User, msg notifier.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	// Тестовые push-сервисы -- httptest-серверы на 127.0.0.1
+	os.Setenv("ALLOW_PRIVATE_NETWORK_TARGETS", "true")
+	os.Exit(m.Run())
+}
+
+func TestDispatchUsesPreferredChannel(t *testing.T) {
+	push := &fakeNotifier{channel: notifier.ChannelPush}
+	email := &fakeNotifier{channel: notifier.ChannelEmail}
+	notifier.Register(push)
+	notifier.Register(email)
+
+	user := models.User{NotificationChannel: notifier.ChannelEmail}
+	channel, err := notifier.Dispatch(context.Background(), user, notifier.Message{Title: "Test"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, notifier.ChannelEmail, channel)
+	assert.Len(t, email.sent, 1)
+	assert.Empty(t, push.sent)
+}
+
+func TestDispatchFallsBackWhenPushUnavailable(t *testing.T) {
+	push := &fakeNotifier{channel: notifier.ChannelPush, err: notifier.ErrUnavailable}
+	email := &fakeNotifier{channel: notifier.ChannelEmail}
+	notifier.Register(push)
+	notifier.Register(email)
+
+	user := models.User{NotificationChannel: notifier.ChannelPush}
+	channel, err := notifier.Dispatch(context.Background(), user, notifier.Message{Title: "Test"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, notifier.ChannelEmail, channel)
+	assert.Len(t, email.sent, 1)
+}
+
+func TestDispatchReturnsLastErrorWhenAllChannelsFail(t *testing.T) {
+	sendErr := errors.New("smtp is down")
+	notifier.Register(&fakeNotifier{channel: notifier.ChannelPush, err: notifier.ErrUnavailable})
+	notifier.Register(&fakeNotifier{channel: notifier.ChannelEmail, err: sendErr})
+
+	_, err := notifier.Dispatch(context.Background(), models.User{}, notifier.Message{Title: "Test"})
+
+	assert.ErrorIs(t, err, sendErr)
+}
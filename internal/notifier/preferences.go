@@ -0,0 +1,155 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SergeyMilch/pay_aware/internal/webhook"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/SergeyMilch/pay_aware/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// События, доставку которых пользователь может направить в нужные каналы
+const (
+	EventReminderDue    = webhook.EventReminderDue
+	EventPaymentOverdue = webhook.EventPaymentOverdue
+)
+
+// RoutableEvents -- события, для которых можно настроить каналы
+var RoutableEvents = []string{EventReminderDue, EventPaymentOverdue}
+
+// LoadPreferences возвращает настройки пользователя или nil, если он их ещё не задавал
+func LoadPreferences(userID int) (*models.NotificationPreference, error) {
+	var prefs models.NotificationPreference
+	if err := db.GormDB.Where("user_id = ?", userID).First(&prefs).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// DefaultPreferences -- настройки, которые действуют, пока пользователь их не изменил:
+// все каналы включены, напоминания идут в предпочтительный канал и на webhook'и, просрочки -- только на webhook'и
+func DefaultPreferences(user models.User) models.NotificationPreference {
+	preferred := user.NotificationChannel
+	if preferred == "" {
+		preferred = ChannelPush
+	}
+
+	return models.NotificationPreference{
+		UserID:          int(user.ID),
+		EnabledChannels: RoutableChannels(),
+		EventChannels: map[string][]string{
+			EventReminderDue:    {preferred, ChannelWebhook},
+			EventPaymentOverdue: {ChannelWebhook},
+		},
+		HighPriorityChannels: []string{},
+	}
+}
+
+// RoutableChannels возвращает зарегистрированные каналы в порядке fallbackOrder, затем webhook
+func RoutableChannels() []string {
+	channels := make([]string, 0, len(fallbackOrder)+1)
+	for _, channel := range append(append([]string{}, fallbackOrder...), ChannelWebhook) {
+		if IsSupported(channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// ValidatePreferences проверяет, что в настройках указаны только известные каналы и события
+func ValidatePreferences(prefs models.NotificationPreference) error {
+	if err := ValidateChannels(prefs.EnabledChannels); err != nil {
+		return err
+	}
+	if err := ValidateChannels(prefs.HighPriorityChannels); err != nil {
+		return err
+	}
+	if (prefs.QuietHoursStart == "") != (prefs.QuietHoursEnd == "") {
+		return errors.New("both quiet_hours_start and quiet_hours_end must be set")
+	}
+	if prefs.QuietHoursStart != "" {
+		if _, err := utils.ParseClock(prefs.QuietHoursStart); err != nil {
+			return err
+		}
+		if _, err := utils.ParseClock(prefs.QuietHoursEnd); err != nil {
+			return err
+		}
+	}
+	if prefs.DigestFrequency != "" && prefs.DigestFrequency != DigestWeekly && prefs.DigestFrequency != DigestMonthly {
+		return fmt.Errorf("unsupported digest_frequency: %s", prefs.DigestFrequency)
+	}
+	for event, channels := range prefs.EventChannels {
+		if !isRoutableEvent(event) {
+			return fmt.Errorf("unsupported event: %s", event)
+		}
+		if err := ValidateChannels(channels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateChannels проверяет, что все каналы зарегистрированы
+func ValidateChannels(channels []string) error {
+	for _, channel := range channels {
+		if !IsSupported(channel) {
+			return fmt.Errorf("unsupported channel: %s", channel)
+		}
+	}
+	return nil
+}
+
+// resolveChannels выбирает каналы для сообщения. Приоритет: каналы подписки,
+// затем каналы для HighPriority, затем каналы события, затем значения по умолчанию.
+// Выключенные в настройках каналы отбрасываются.
+func resolveChannels(user models.User, prefs *models.NotificationPreference, msg Message) []string {
+	event := msg.event()
+
+	var channels []string
+	switch {
+	case len(msg.Subscription.NotificationChannels) > 0:
+		channels = msg.Subscription.NotificationChannels
+	case prefs != nil && msg.HighPriority && len(prefs.HighPriorityChannels) > 0:
+		channels = prefs.HighPriorityChannels
+	case prefs != nil && len(prefs.EventChannels[event]) > 0:
+		channels = prefs.EventChannels[event]
+	default:
+		channels = DefaultPreferences(user).EventChannels[event]
+	}
+
+	resolved := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if channelEnabled(prefs, channel) && !contains(resolved, channel) {
+			resolved = append(resolved, channel)
+		}
+	}
+	return resolved
+}
+
+// channelEnabled проверяет, включён ли канал. Без настроек включены все каналы.
+func channelEnabled(prefs *models.NotificationPreference, channel string) bool {
+	if prefs == nil || prefs.EnabledChannels == nil {
+		return true
+	}
+	return contains(prefs.EnabledChannels, channel)
+}
+
+// isRoutableEvent проверяет, можно ли настраивать каналы для события
+func isRoutableEvent(event string) bool {
+	return contains(RoutableEvents, event)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
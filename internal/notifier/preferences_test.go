@@ -0,0 +1,91 @@
+package notifier_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchSendsHighPriorityToAllConfiguredChannels(t *testing.T) {
+	push := &fakeNotifier{channel: notifier.ChannelPush}
+	email := &fakeNotifier{channel: notifier.ChannelEmail}
+	notifier.Register(push)
+	notifier.Register(email)
+
+	prefs := &models.NotificationPreference{
+		HighPriorityChannels: []string{notifier.ChannelPush, notifier.ChannelEmail},
+	}
+	msg := notifier.Message{Title: "Test", HighPriority: true}
+
+	channels, err := notifier.DispatchWithPreferences(context.Background(), models.User{}, prefs, msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{notifier.ChannelPush, notifier.ChannelEmail}, channels)
+	assert.Len(t, push.sent, 1)
+	assert.Len(t, email.sent, 1)
+}
+
+func TestDispatchPrefersSubscriptionChannels(t *testing.T) {
+	push := &fakeNotifier{channel: notifier.ChannelPush}
+	email := &fakeNotifier{channel: notifier.ChannelEmail}
+	notifier.Register(push)
+	notifier.Register(email)
+
+	prefs := &models.NotificationPreference{
+		EventChannels: map[string][]string{notifier.EventReminderDue: {notifier.ChannelPush}},
+	}
+	msg := notifier.Message{
+		Title:        "Test",
+		Subscription: models.Subscription{NotificationChannels: []string{notifier.ChannelEmail}},
+	}
+
+	channels, err := notifier.DispatchWithPreferences(context.Background(), models.User{}, prefs, msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{notifier.ChannelEmail}, channels)
+	assert.Empty(t, push.sent)
+}
+
+func TestDispatchSkipsDisabledChannels(t *testing.T) {
+	push := &fakeNotifier{channel: notifier.ChannelPush, err: notifier.ErrUnavailable}
+	email := &fakeNotifier{channel: notifier.ChannelEmail}
+	notifier.Register(push)
+	notifier.Register(email)
+
+	// Email выключен -- фолбэк на него не выполняется
+	prefs := &models.NotificationPreference{
+		EnabledChannels: []string{notifier.ChannelPush},
+		EventChannels:   map[string][]string{notifier.EventReminderDue: {notifier.ChannelPush}},
+	}
+
+	_, err := notifier.DispatchWithPreferences(context.Background(), models.User{}, prefs, notifier.Message{Title: "Test"})
+
+	assert.ErrorIs(t, err, notifier.ErrUnavailable)
+	assert.Empty(t, email.sent)
+}
+
+func TestDispatchDoesNotFallBackForWebhookOnlyEvents(t *testing.T) {
+	hook := &fakeNotifier{channel: notifier.ChannelWebhook, err: notifier.ErrUnavailable}
+	email := &fakeNotifier{channel: notifier.ChannelEmail}
+	notifier.Register(hook)
+	notifier.Register(email)
+
+	// По умолчанию payment.overdue уходит только на webhook'и
+	msg := notifier.Message{Event: notifier.EventPaymentOverdue, Title: "Test"}
+	_, err := notifier.DispatchWithPreferences(context.Background(), models.User{}, nil, msg)
+
+	assert.ErrorIs(t, err, notifier.ErrUnavailable)
+	assert.Empty(t, email.sent)
+}
+
+func TestValidatePreferencesRejectsUnknownEvent(t *testing.T) {
+	notifier.Register(&fakeNotifier{channel: notifier.ChannelPush})
+
+	err := notifier.ValidatePreferences(models.NotificationPreference{
+		EventChannels: map[string][]string{"subscription.created": {notifier.ChannelPush}},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+)
+
+// ChannelTelegram -- доставка через Telegram-бота
+const ChannelTelegram = "telegram"
+
+// Действия inline-кнопок под напоминанием. Формат callback_data: "<действие>:<ID подписки>"
+const (
+	TelegramActionPaid   = "paid"
+	TelegramActionSnooze = "snooze"
+)
+
+// defaultTelegramAPIURL -- адрес Bot API по умолчанию (переопределяется через TELEGRAM_API_URL)
+const defaultTelegramAPIURL = "https://api.telegram.org"
+
+// TelegramBot -- минимальный клиент Telegram Bot API
+type TelegramBot struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// InlineButton -- кнопка inline-клавиатуры
+type InlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+var telegramBot *TelegramBot
+
+// NewTelegramBot создаёт клиент Bot API. Пустой baseURL означает официальный адрес Telegram.
+func NewTelegramBot(baseURL, token string) *TelegramBot {
+	if baseURL == "" {
+		baseURL = defaultTelegramAPIURL
+	}
+	return &TelegramBot{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// newTelegramBotFromEnv создаёт клиент по TELEGRAM_BOT_TOKEN и TELEGRAM_API_URL.
+// Возвращает nil, если токен бота не задан.
+func newTelegramBotFromEnv() *TelegramBot {
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return nil
+	}
+	return NewTelegramBot(os.Getenv("TELEGRAM_API_URL"), token)
+}
+
+// Telegram возвращает настроенный клиент бота или nil, если Telegram не подключён
+func Telegram() *TelegramBot {
+	return telegramBot
+}
+
+// SendMessage отправляет сообщение в чат, при необходимости с inline-кнопками
+func (b *TelegramBot) SendMessage(ctx context.Context, chatID int64, text string, buttons []InlineButton) error {
+	payload := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	if len(buttons) > 0 {
+		payload["reply_markup"] = map[string]interface{}{
+			"inline_keyboard": [][]InlineButton{buttons},
+		}
+	}
+	return b.call(ctx, "sendMessage", payload)
+}
+
+// AnswerCallbackQuery подтверждает нажатие inline-кнопки и показывает пользователю короткий ответ
+func (b *TelegramBot) AnswerCallbackQuery(ctx context.Context, callbackQueryID, text string) error {
+	return b.call(ctx, "answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": callbackQueryID,
+		"text":              text,
+	})
+}
+
+// call выполняет метод Bot API и проверяет поле ok в ответе
+func (b *TelegramBot) call(ctx context.Context, method string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telegram request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/bot%s/%s", b.baseURL, b.token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create telegram request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("telegram request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode telegram response (status %d): %w", resp.StatusCode, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram %s failed (status %d): %s", method, resp.StatusCode, result.Description)
+	}
+	return nil
+}
+
+// TelegramNotifier доставляет напоминания в Telegram с кнопками "Оплачено" / "Отложить на 1 день"
+type TelegramNotifier struct {
+	bot *TelegramBot
+}
+
+// NewTelegramNotifier создаёт Telegram-канал поверх клиента бота
+func NewTelegramNotifier(bot *TelegramBot) *TelegramNotifier {
+	return &TelegramNotifier{bot: bot}
+}
+
+// Channel возвращает имя канала
+func (n *TelegramNotifier) Channel() string {
+	return ChannelTelegram
+}
+
+// Send отправляет напоминание в привязанный чат пользователя
+func (n *TelegramNotifier) Send(ctx context.Context, user models.User, msg Message) error {
+	if user.TelegramChatID == 0 {
+		return ErrUnavailable
+	}
+
+	text := msg.Title + "\n\n" + msg.Body
+
+	var buttons []InlineButton
+	if msg.Subscription.ID != 0 {
+		buttons = []InlineButton{
+			{Text: i18n.T(user.Locale, "telegram.button_paid", nil), CallbackData: fmt.Sprintf("%s:%d", TelegramActionPaid, msg.Subscription.ID)},
+			{Text: i18n.T(user.Locale, "telegram.button_snooze", nil), CallbackData: fmt.Sprintf("%s:%d", TelegramActionSnooze, msg.Subscription.ID)},
+		}
+	}
+
+	return n.bot.SendMessage(ctx, user.TelegramChatID, text, buttons)
+}
@@ -0,0 +1,68 @@
+package notifier_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTelegramNotifierSendsReminderWithButtons(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]interface{}
+
+	// Локальный фейковый Bot API
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer server.Close()
+
+	n := notifier.NewTelegramNotifier(notifier.NewTelegramBot(server.URL, "test-token"))
+	user := models.User{TelegramChatID: 42}
+	msg := notifier.Message{
+		Title:        "Напоминание об оплате!",
+		Body:         "Не забудьте оплатить",
+		Subscription: models.Subscription{Model: gorm.Model{ID: 7}},
+	}
+
+	err := n.Send(context.Background(), user, msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/bottest-token/sendMessage", gotPath)
+	assert.Equal(t, float64(42), gotBody["chat_id"])
+
+	keyboard := gotBody["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})
+	buttons := keyboard[0].([]interface{})
+	assert.Len(t, buttons, 2)
+	assert.Equal(t, "paid:7", buttons[0].(map[string]interface{})["callback_data"])
+	assert.Equal(t, "snooze:7", buttons[1].(map[string]interface{})["callback_data"])
+}
+
+func TestTelegramNotifierUnavailableWithoutLinkedChat(t *testing.T) {
+	n := notifier.NewTelegramNotifier(notifier.NewTelegramBot("http://127.0.0.1:0", "test-token"))
+
+	err := n.Send(context.Background(), models.User{}, notifier.Message{})
+
+	assert.ErrorIs(t, err, notifier.ErrUnavailable)
+}
+
+func TestTelegramBotReturnsAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"ok":false,"description":"Forbidden: bot was blocked by the user"}`))
+	}))
+	defer server.Close()
+
+	bot := notifier.NewTelegramBot(server.URL, "test-token")
+	err := bot.SendMessage(context.Background(), 42, "text", nil)
+
+	assert.ErrorContains(t, err, "bot was blocked")
+}
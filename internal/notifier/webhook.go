@@ -0,0 +1,48 @@
+package notifier
+
+import (
+	"context"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/webhook"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+)
+
+// ChannelWebhook -- доставка событий на webhook endpoint'ы пользователя
+const ChannelWebhook = "webhook"
+
+// WebhookNotifier передаёт уведомления интеграциям пользователя как webhook-события
+type WebhookNotifier struct{}
+
+// NewWebhookNotifier создаёт канал webhook-событий
+func NewWebhookNotifier() *WebhookNotifier {
+	return &WebhookNotifier{}
+}
+
+// Channel возвращает имя канала
+func (n *WebhookNotifier) Channel() string {
+	return ChannelWebhook
+}
+
+// Send ставит событие в очередь доставки. Если ни один endpoint не подписан на событие, канал недоступен.
+func (n *WebhookNotifier) Send(ctx context.Context, user models.User, msg Message) error {
+	if webhook.Publish(ctx, int(user.ID), msg.event(), webhook.SubscriptionData(msg.Subscription)) == 0 {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// PublishWebhookEvent отправляет служебное событие (например, subscription.created) на webhook'и,
+// если пользователь не отключил канал webhook в настройках
+func PublishWebhookEvent(ctx context.Context, userID int, event string, data interface{}) {
+	prefs, err := LoadPreferences(userID)
+	if err != nil {
+		logger.Error("Failed to load notification preferences", "userID", userID, "error", err)
+		return
+	}
+	if !channelEnabled(prefs, ChannelWebhook) {
+		return
+	}
+
+	webhook.Publish(ctx, userID, event, data)
+}
@@ -0,0 +1,403 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/netguard"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ChannelWebPush -- доставка в браузер через Web Push
+const ChannelWebPush = "webpush"
+
+const (
+	webPushRecordSize = 4096           // Размер записи aes128gcm (RFC 8188)
+	webPushTTL        = 24 * time.Hour // Сколько push-сервис хранит сообщение, если браузер офлайн
+	vapidTokenTTL     = 12 * time.Hour // Срок действия VAPID JWT (не больше 24 часов)
+	webPushSaltSize   = 16
+	webPushAuthSize   = 16
+)
+
+// webPushHosts -- push-сервисы браузеров. Подписку на другой адрес не принимаем: иначе сервер
+// отправлял бы запросы на любой указанный пользователем URL. Домен с точкой в начале -- все его поддомены.
+var webPushHosts = []string{
+	"fcm.googleapis.com",                // Chrome, Edge (Chromium), Opera
+	"updates.push.services.mozilla.com", // Firefox
+	".push.apple.com",                   // Safari
+	".notify.windows.com",               // Edge (legacy)
+}
+
+// ErrWebPushGone возвращается, если push-сервис сообщил, что подписка больше не существует (404/410)
+var ErrWebPushGone = errors.New("web push subscription is gone")
+
+// VAPIDKeys -- ключи сервера приложения для аутентификации в push-сервисах (RFC 8292)
+type VAPIDKeys struct {
+	PublicKey  string // Несжатая точка P-256 в base64url, передаётся браузеру как applicationServerKey
+	privateKey *ecdsa.PrivateKey
+	subject    string // "mailto:..." или https-адрес для связи с отправителем
+}
+
+var vapidKeys *VAPIDKeys
+
+// NewVAPIDKeys разбирает ключи в формате base64url: публичный -- 65 байт несжатой точки, приватный -- 32 байта скаляра
+func NewVAPIDKeys(publicKey, privateKey, subject string) (*VAPIDKeys, error) {
+	d, err := decodeBase64URL(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	ecdhKey, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	// Публичный ключ вычисляем из приватного и сверяем с заданным
+	point := ecdhKey.PublicKey().Bytes()
+	encodedPublic := base64.RawURLEncoding.EncodeToString(point)
+	if publicKey != "" && strings.TrimRight(publicKey, "=") != encodedPublic {
+		return nil, errors.New("VAPID public key does not match private key")
+	}
+
+	return &VAPIDKeys{
+		PublicKey: encodedPublic,
+		privateKey: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(point[1:33]),
+				Y:     new(big.Int).SetBytes(point[33:65]),
+			},
+			D: new(big.Int).SetBytes(d),
+		},
+		subject: subject,
+	}, nil
+}
+
+// newVAPIDKeysFromEnv создаёт ключи по VAPID_PUBLIC_KEY, VAPID_PRIVATE_KEY и VAPID_SUBJECT.
+// Возвращает nil, если ключи не заданы или некорректны.
+func newVAPIDKeysFromEnv() *VAPIDKeys {
+	privateKey := os.Getenv("VAPID_PRIVATE_KEY")
+	if privateKey == "" {
+		return nil
+	}
+
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		subject = "mailto:" + os.Getenv("EMAIL_FROM")
+	}
+
+	keys, err := NewVAPIDKeys(os.Getenv("VAPID_PUBLIC_KEY"), privateKey, subject)
+	if err != nil {
+		logger.Error("Failed to load VAPID keys, web push is disabled", "error", err)
+		return nil
+	}
+	return keys
+}
+
+// VAPIDPublicKey возвращает публичный ключ для подписки в браузере ("" если Web Push не настроен)
+func VAPIDPublicKey() string {
+	if vapidKeys == nil {
+		return ""
+	}
+	return vapidKeys.PublicKey
+}
+
+// authorization формирует заголовок Authorization для push-сервиса по адресу endpoint
+func (k *VAPIDKeys) authorization(endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid push endpoint: %w", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Audience:  jwt.ClaimStrings{parsed.Scheme + "://" + parsed.Host},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(vapidTokenTTL)),
+		Subject:   k.subject,
+	})
+	signed, err := token.SignedString(k.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+
+	return fmt.Sprintf("vapid t=%s, k=%s", signed, k.PublicKey), nil
+}
+
+// webPushPayload -- содержимое уведомления, которое получает service worker
+type webPushPayload struct {
+	Title          string `json:"title"`
+	Body           string `json:"body"`
+	SubscriptionID uint   `json:"subscription_id,omitempty"`
+	NotificationID uint   `json:"notification_id,omitempty"`
+	Category       string `json:"category,omitempty"`     // Категория кнопок действий, см. ActionCategoryReminder
+	ActionToken    string `json:"action_token,omitempty"` // Токен для POST /notifications/:id/actions
+}
+
+// WebPushNotifier доставляет уведомления во все браузеры, подписанные пользователем
+type WebPushNotifier struct {
+	keys       *VAPIDKeys
+	httpClient *http.Client
+}
+
+// NewWebPushNotifier создаёт канал Web Push
+func NewWebPushNotifier(keys *VAPIDKeys) *WebPushNotifier {
+	return &WebPushNotifier{
+		keys:       keys,
+		// Подписки, сохранённые до проверки webPushHosts, тоже не уведут запрос во внутреннюю сеть
+		httpClient: netguard.NewHTTPClient(10 * time.Second),
+	}
+}
+
+// Channel возвращает имя канала
+func (n *WebPushNotifier) Channel() string {
+	return ChannelWebPush
+}
+
+// Send отправляет уведомление на все подписки пользователя.
+// Успешной считается доставка хотя бы в один браузер.
+func (n *WebPushNotifier) Send(ctx context.Context, user models.User, msg Message) error {
+	var subscriptions []models.WebPushSubscription
+	if err := db.GormDB.Where("user_id = ?", user.ID).Find(&subscriptions).Error; err != nil {
+		return fmt.Errorf("failed to load web push subscriptions: %w", err)
+	}
+	if len(subscriptions) == 0 {
+		return ErrUnavailable
+	}
+
+	payload, err := json.Marshal(webPushPayload{
+		Title:          msg.Title,
+		Body:           msg.Body,
+		SubscriptionID: msg.Subscription.ID,
+		NotificationID: msg.NotificationID,
+		Category:       actionCategory(msg),
+		ActionToken:    pushData(msg)["action_token"],
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal web push payload: %w", err)
+	}
+
+	delivered := 0
+	var lastErr error
+	for _, subscription := range subscriptions {
+		err := n.SendToSubscription(ctx, subscription, payload, msg.HighPriority)
+		if err == nil {
+			delivered++
+			continue
+		}
+
+		if errors.Is(err, ErrWebPushGone) {
+			logger.Info("Web push subscription expired. Removing from DB", "userID", user.ID, "subscriptionID", subscription.ID)
+			go removeWebPushSubscription(subscription.ID)
+		} else {
+			logger.Warn("Failed to send web push notification", "userID", user.ID, "subscriptionID", subscription.ID, "error", err)
+		}
+		lastErr = err
+	}
+
+	if delivered > 0 {
+		logger.Debug("Web push notification sent", "userID", user.ID, "browsers", delivered)
+		return nil
+	}
+	if errors.Is(lastErr, ErrWebPushGone) {
+		return ErrUnavailable
+	}
+	return lastErr
+}
+
+// SendToSubscription шифрует payload для одной подписки и отправляет его в push-сервис
+func (n *WebPushNotifier) SendToSubscription(ctx context.Context, subscription models.WebPushSubscription, payload []byte, highPriority bool) error {
+	body, err := EncryptWebPush(subscription.P256dh, subscription.Auth, payload)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := n.keys.authorization(subscription.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create web push request: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(webPushTTL.Seconds())))
+	if highPriority {
+		req.Header.Set("Urgency", "high")
+	} else {
+		req.Header.Set("Urgency", "normal")
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("web push request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrWebPushGone
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return fmt.Errorf("push service responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// EncryptWebPush шифрует сообщение для браузера по RFC 8291 (content coding aes128gcm, одна запись).
+// p256dh и auth -- ключи из PushSubscription в base64url.
+func EncryptWebPush(p256dh, auth string, plaintext []byte) ([]byte, error) {
+	uaPublicBytes, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := decodeBase64URL(auth)
+	if err != nil || len(authSecret) != webPushAuthSize {
+		return nil, errors.New("invalid auth secret")
+	}
+
+	// Запись: данные + разделитель 0x02 + тег GCM (16 байт) должны уместиться в webPushRecordSize
+	if len(plaintext) > webPushRecordSize-16-1 {
+		return nil, errors.New("web push payload is too large")
+	}
+
+	// Одноразовая пара ключей сервера для ECDH
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	salt := make([]byte, webPushSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	cek, nonce, err := deriveWebPushKeys(sharedSecret, authSecret, salt, uaPublicBytes, asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	record := append(append([]byte{}, plaintext...), 0x02) // 0x02 -- признак последней записи
+	ciphertext := gcm.Seal(nil, nonce, record, nil)
+
+	// Заголовок: salt (16) | rs (4) | idlen (1) | keyid (публичный ключ сервера)
+	header := make([]byte, 0, webPushSaltSize+5+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return append(header, ciphertext...), nil
+}
+
+// deriveWebPushKeys вычисляет ключ шифрования и nonce по RFC 8291, раздел 3.4
+func deriveWebPushKeys(sharedSecret, authSecret, salt, uaPublic, asPublic []byte) ([]byte, []byte, error) {
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, authSecret, keyInfo), ikm); err != nil {
+		return nil, nil, fmt.Errorf("failed to derive input keying material: %w", err)
+	}
+
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, nil, fmt.Errorf("failed to derive content encryption key: %w", err)
+	}
+
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to derive nonce: %w", err)
+	}
+
+	return cek, nonce, nil
+}
+
+// ValidateWebPushEndpoint проверяет, что endpoint подписки -- https-адрес известного push-сервиса
+func ValidateWebPushEndpoint(endpoint string) error {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return errors.New("endpoint must be a valid https URL")
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	for _, allowed := range webPushHosts {
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported push service: %s", host)
+}
+
+// ValidateWebPushKeys проверяет ключи подписки браузера до сохранения в БД
+func ValidateWebPushKeys(p256dh, auth string) error {
+	uaPublic, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	if _, err := ecdh.P256().NewPublicKey(uaPublic); err != nil {
+		return fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	if authSecret, err := decodeBase64URL(auth); err != nil || len(authSecret) != webPushAuthSize {
+		return errors.New("invalid auth secret")
+	}
+	return nil
+}
+
+// decodeBase64URL декодирует base64url с выравниванием "=" или без него
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// removeWebPushSubscription удаляет подписку браузера, которую push-сервис больше не принимает
+func removeWebPushSubscription(id uint) {
+	if err := db.GormDB.Unscoped().Delete(&models.WebPushSubscription{}, id).Error; err != nil {
+		logger.Error("Failed to remove web push subscription", "subscriptionID", id, "error", err)
+		return
+	}
+	logger.Info("Web push subscription removed", "subscriptionID", id)
+}
@@ -0,0 +1,195 @@
+package notifier_test
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/hkdf"
+)
+
+// browserKeys -- ключи, которые браузер создаёт при pushManager.subscribe
+type browserKeys struct {
+	private *ecdh.PrivateKey
+	auth    []byte
+}
+
+func newBrowserKeys(t *testing.T) browserKeys {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	auth := make([]byte, 16)
+	_, err = rand.Read(auth)
+	assert.NoError(t, err)
+	return browserKeys{private: private, auth: auth}
+}
+
+func (k browserKeys) subscription(endpoint string) models.WebPushSubscription {
+	return models.WebPushSubscription{
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(k.private.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(k.auth),
+	}
+}
+
+// decrypt расшифровывает сообщение так же, как это делает браузер (RFC 8291)
+func (k browserKeys) decrypt(t *testing.T, body []byte) []byte {
+	salt := body[:16]
+	recordSize := binary.BigEndian.Uint32(body[16:20])
+	keyIDLen := int(body[20])
+	asPublicBytes := body[21 : 21+keyIDLen]
+	ciphertext := body[21+keyIDLen:]
+	assert.Equal(t, uint32(4096), recordSize)
+
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	assert.NoError(t, err)
+	shared, err := k.private.ECDH(asPublic)
+	assert.NoError(t, err)
+
+	keyInfo := append([]byte("WebPush: info\x00"), k.private.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, asPublicBytes...)
+	ikm := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, shared, k.auth, keyInfo), ikm)
+
+	cek := make([]byte, 16)
+	io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek)
+	nonce := make([]byte, 12)
+	io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce)
+
+	block, err := aes.NewCipher(cek)
+	assert.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	assert.NoError(t, err)
+	record, err := gcm.Open(nil, nonce, ciphertext, nil)
+	assert.NoError(t, err)
+
+	// Последний байт -- разделитель последней записи
+	assert.Equal(t, byte(0x02), record[len(record)-1])
+	return record[:len(record)-1]
+}
+
+func newTestVAPIDKeys(t *testing.T) (*notifier.VAPIDKeys, *ecdh.PrivateKey) {
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	keys, err := notifier.NewVAPIDKeys("", base64.RawURLEncoding.EncodeToString(private.Bytes()), "mailto:admin@example.com")
+	assert.NoError(t, err)
+	return keys, private
+}
+
+func TestEncryptWebPushRoundTrip(t *testing.T) {
+	browser := newBrowserKeys(t)
+	sub := browser.subscription("https://push.example.com/send/1")
+
+	plaintext := []byte(`{"title":"Напоминание об оплате!","body":"Netflix"}`)
+	body, err := notifier.EncryptWebPush(sub.P256dh, sub.Auth, plaintext)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, browser.decrypt(t, body))
+}
+
+func TestEncryptWebPushRejectsInvalidKeys(t *testing.T) {
+	_, err := notifier.EncryptWebPush("bm90LWEta2V5", "c2hvcnQ", []byte("hello"))
+	assert.Error(t, err)
+}
+
+func TestNewVAPIDKeysRejectsMismatchedPublicKey(t *testing.T) {
+	private, _ := ecdh.P256().GenerateKey(rand.Reader)
+	other, _ := ecdh.P256().GenerateKey(rand.Reader)
+
+	_, err := notifier.NewVAPIDKeys(
+		base64.RawURLEncoding.EncodeToString(other.PublicKey().Bytes()),
+		base64.RawURLEncoding.EncodeToString(private.Bytes()),
+		"mailto:admin@example.com",
+	)
+	assert.Error(t, err)
+}
+
+func TestWebPushSendsVAPIDAuthorizedRequest(t *testing.T) {
+	keys, vapidPrivate := newTestVAPIDKeys(t)
+	vapidPublic := vapidPrivate.PublicKey().Bytes()
+	browser := newBrowserKeys(t)
+
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "aes128gcm", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "high", r.Header.Get("Urgency"))
+		assert.NotEmpty(t, r.Header.Get("TTL"))
+
+		// Authorization: vapid t=<JWT>, k=<публичный ключ>
+		authorization := strings.TrimPrefix(r.Header.Get("Authorization"), "vapid ")
+		parts := strings.Split(authorization, ", ")
+		assert.Len(t, parts, 2)
+		assert.Equal(t, "k="+keys.PublicKey, parts[1])
+
+		claims := jwt.RegisteredClaims{}
+		_, err := jwt.ParseWithClaims(strings.TrimPrefix(parts[0], "t="), &claims, func(token *jwt.Token) (interface{}, error) {
+			assert.Equal(t, jwt.SigningMethodES256, token.Method)
+			return &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(vapidPublic[1:33]),
+				Y:     new(big.Int).SetBytes(vapidPublic[33:65]),
+			}, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "mailto:admin@example.com", claims.Subject)
+		assert.True(t, claims.VerifyAudience("http://"+r.Host, true))
+
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	n := notifier.NewWebPushNotifier(keys)
+	err := n.SendToSubscription(context.Background(), browser.subscription(server.URL+"/send/1"), []byte("hello"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), browser.decrypt(t, received))
+}
+
+func TestWebPushReportsGoneSubscription(t *testing.T) {
+	keys, _ := newTestVAPIDKeys(t)
+	browser := newBrowserKeys(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	n := notifier.NewWebPushNotifier(keys)
+	err := n.SendToSubscription(context.Background(), browser.subscription(server.URL), []byte("hello"), false)
+	assert.ErrorIs(t, err, notifier.ErrWebPushGone)
+}
+
+func TestValidateWebPushEndpointAllowsOnlyPushServices(t *testing.T) {
+	for _, endpoint := range []string{
+		"https://fcm.googleapis.com/fcm/send/abc",
+		"https://updates.push.services.mozilla.com/wpush/v2/abc",
+		"https://web.push.apple.com/QGx",
+		"https://wns2-par02p.notify.windows.com/w/?token=abc",
+	} {
+		assert.NoError(t, notifier.ValidateWebPushEndpoint(endpoint), endpoint)
+	}
+	for _, endpoint := range []string{
+		"http://fcm.googleapis.com/fcm/send/abc",
+		"https://169.254.169.254/latest/meta-data",
+		"https://internal.service.local/send",
+		"https://push.apple.com.attacker.example/abc",
+		"https://evilpush.apple.com/abc",
+	} {
+		assert.Error(t, notifier.ValidateWebPushEndpoint(endpoint), endpoint)
+	}
+}
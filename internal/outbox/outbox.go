@@ -0,0 +1,237 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	relayBatchSize    = 100
+	relayPollInterval = time.Second        // Как часто relay проверяет outbox без сигнала Notify
+	claimTimeout      = time.Minute        // На это время сообщение "забирается" relay
+	baseRetryDelay    = time.Second        // Задержка перед первым повтором, дальше удваивается
+	maxRetryDelay     = 5 * time.Minute    // Сообщения не теряются: повторяем, пока брокер не примет
+	retention         = 7 * 24 * time.Hour // Столько хранятся отправленные сообщения (и их ключи идемпотентности)
+	cleanupInterval   = time.Hour
+)
+
+// Message -- сообщение, которое нужно отправить после коммита транзакции
+type Message struct {
+	Topic          string
+	Key            string
+	Payload        []byte
+	Headers        map[string]string
+	IdempotencyKey string // Пустой -- без проверки на повтор
+}
+
+// PublishFunc отправляет сообщение outbox в брокер
+type PublishFunc func(ctx context.Context, message models.OutboxMessage) error
+
+// wake будит relay сразу после коммита, не дожидаясь очередной проверки
+var wake = make(chan struct{}, 1)
+
+// Add записывает сообщение в outbox в транзакции tx. Возвращает false, если сообщение
+// с тем же ключом идемпотентности уже записано (и, значит, уже отправлено или будет отправлено).
+func Add(tx *gorm.DB, message Message) (bool, error) {
+	row := models.OutboxMessage{
+		Topic:         message.Topic,
+		MessageKey:    message.Key,
+		Payload:       string(message.Payload),
+		NextAttemptAt: time.Now().UTC(),
+	}
+	if message.IdempotencyKey != "" {
+		row.IdempotencyKey = &message.IdempotencyKey
+	}
+	if len(message.Headers) > 0 {
+		headers, err := json.Marshal(message.Headers)
+		if err != nil {
+			return false, err
+		}
+		row.Headers = string(headers)
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Notify сообщает relay, что в outbox появились сообщения. Вызывается после коммита транзакции.
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunRelay отправляет сообщения outbox, пока не отменён ctx. Relay можно запускать на всех экземплярах:
+// каждое сообщение забирает только один. Если экземпляр упадёт между отправкой и отметкой,
+// сообщение уйдёт повторно -- потребитель отбрасывает повторы по ключу идемпотентности.
+func RunRelay(ctx context.Context, publish PublishFunc) {
+	logger.Info("Outbox relay started")
+	lastCleanup := time.Time{}
+
+	for {
+		sent := RelayOnce(ctx, publish)
+
+		if time.Since(lastCleanup) >= cleanupInterval {
+			cleanup(ctx)
+			lastCleanup = time.Now()
+		}
+
+		// Забрали полную пачку -- вероятно, есть ещё
+		if sent == relayBatchSize {
+			continue
+		}
+
+		select {
+		case <-wake:
+		case <-time.After(relayPollInterval):
+		case <-ctx.Done():
+			logger.Info("Outbox relay stopped")
+			return
+		}
+	}
+}
+
+// RelayOnce забирает пачку готовых к отправке сообщений и отправляет их по порядку.
+// Возвращает число забранных сообщений.
+func RelayOnce(ctx context.Context, publish PublishFunc) int {
+	messages, err := claim(ctx)
+	if err != nil {
+		logger.Error("Failed to claim outbox messages", "error", err)
+		return 0
+	}
+
+	for _, message := range messages {
+		if err := publish(ctx, message); err != nil {
+			delay := RetryDelay(message.Attempts)
+			logger.Warn("Failed to publish outbox message", "messageID", message.ID, "attempt", message.Attempts, "retryIn", delay, "error", err)
+			if err := db.GormDB.WithContext(ctx).Model(&models.OutboxMessage{}).
+				Where("id = ? AND lease_token = ?", message.ID, message.LeaseToken).
+				Updates(map[string]interface{}{
+					"next_attempt_at": time.Now().UTC().Add(delay),
+					"lease_token":     "",
+					"last_error":      err.Error(),
+				}).Error; err != nil {
+				logger.Error("Failed to reschedule outbox message", "messageID", message.ID, "error", err)
+			}
+			continue
+		}
+
+		sentAt := time.Now().UTC()
+		if err := db.GormDB.WithContext(ctx).Model(&models.OutboxMessage{}).
+			Where("id = ? AND lease_token = ?", message.ID, message.LeaseToken).
+			Updates(map[string]interface{}{
+				"sent_at":     &sentAt,
+				"lease_token": "",
+				"last_error":  "",
+			}).Error; err != nil {
+			logger.Error("Failed to mark outbox message as sent", "messageID", message.ID, "error", err)
+		}
+	}
+	return len(messages)
+}
+
+// Headers возвращает заголовки сообщения outbox
+func Headers(message models.OutboxMessage) (map[string]string, error) {
+	headers := map[string]string{}
+	if message.Headers == "" {
+		return headers, nil
+	}
+	if err := json.Unmarshal([]byte(message.Headers), &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// RetryDelay возвращает задержку перед повтором: 1s, 2s, 4s, ... но не больше 5 минут
+func RetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 10 {
+		return maxRetryDelay
+	}
+	delay := baseRetryDelay * time.Duration(1<<uint(attempts-1))
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// claim забирает неотправленные сообщения, время которых подошло, в порядке записи
+func claim(ctx context.Context) ([]models.OutboxMessage, error) {
+	token, err := newLeaseToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+
+	var messages []models.OutboxMessage
+	err = db.GormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("sent_at IS NULL AND next_attempt_at <= ?", now).Order("id").Limit(relayBatchSize)
+		// Экземпляры сервиса забирают разные сообщения, не дожидаясь блокировок друг друга
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.Find(&messages).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+		}
+		return tx.Model(&models.OutboxMessage{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"next_attempt_at": now.Add(claimTimeout),
+			"lease_token":     token,
+			"attempts":        gorm.Expr("attempts + 1"),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range messages {
+		messages[i].LeaseToken = token
+		messages[i].Attempts++
+	}
+	return messages, nil
+}
+
+// cleanup удаляет давно отправленные сообщения
+func cleanup(ctx context.Context) {
+	result := db.GormDB.WithContext(ctx).
+		Where("sent_at IS NOT NULL AND sent_at < ?", time.Now().UTC().Add(-retention)).
+		Delete(&models.OutboxMessage{})
+	if result.Error != nil {
+		logger.Error("Failed to clean up outbox", "error", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		logger.Debug("Outbox cleaned up", "deleted", result.RowsAffected)
+	}
+}
+
+// newLeaseToken создаёт метку захвата сообщений
+func newLeaseToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
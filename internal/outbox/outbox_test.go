@@ -0,0 +1,112 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/outbox"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+// initOutboxDB создаёт таблицу outbox в SQLite в памяти
+func initOutboxDB(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open("file:outbox?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal("Failed to initialize mock database", err)
+	}
+	gormDB.Migrator().DropTable(&models.OutboxMessage{})
+	gormDB.AutoMigrate(&models.OutboxMessage{})
+
+	// SQLite не разбирает колонки timestamptz обратно в time.Time, пересоздаём их с datetime
+	var ddl string
+	gormDB.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", "outbox_messages").Scan(&ddl)
+	gormDB.Exec("DROP TABLE outbox_messages")
+	gormDB.Exec(strings.ReplaceAll(ddl, "timestamptz", "datetime"))
+	gormDB.Exec("CREATE UNIQUE INDEX idx_outbox_messages_idempotency_key ON outbox_messages (idempotency_key)")
+	db.GormDB = gormDB
+}
+
+func TestAddSkipsDuplicateIdempotencyKey(t *testing.T) {
+	initOutboxDB(t)
+
+	first, err := outbox.Add(db.GormDB, outbox.Message{Payload: []byte("a"), IdempotencyKey: "reminder:1:100"})
+	assert.NoError(t, err)
+	assert.True(t, first)
+
+	second, err := outbox.Add(db.GormDB, outbox.Message{Payload: []byte("b"), IdempotencyKey: "reminder:1:100"})
+	assert.NoError(t, err)
+	assert.False(t, second)
+
+	// Сообщения без ключа не конфликтуют друг с другом
+	for i := 0; i < 2; i++ {
+		inserted, err := outbox.Add(db.GormDB, outbox.Message{Payload: []byte("c")})
+		assert.NoError(t, err)
+		assert.True(t, inserted)
+	}
+
+	var count int64
+	db.GormDB.Model(&models.OutboxMessage{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestAddIsRolledBackWithTransaction(t *testing.T) {
+	initOutboxDB(t)
+
+	err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+		if _, err := outbox.Add(tx, outbox.Message{Payload: []byte("a")}); err != nil {
+			return err
+		}
+		return errors.New("subscription update failed")
+	})
+	assert.Error(t, err)
+
+	var count int64
+	db.GormDB.Model(&models.OutboxMessage{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestRelayPublishesInOrderAndRetriesFailures(t *testing.T) {
+	initOutboxDB(t)
+	for _, payload := range []string{"first", "broken", "third"} {
+		_, err := outbox.Add(db.GormDB, outbox.Message{Topic: "notifications", Payload: []byte(payload)})
+		assert.NoError(t, err)
+	}
+
+	var published []string
+	publish := func(_ context.Context, message models.OutboxMessage) error {
+		if message.Payload == "broken" {
+			return errors.New("broker unavailable")
+		}
+		published = append(published, message.Payload)
+		return nil
+	}
+
+	assert.Equal(t, 3, outbox.RelayOnce(context.Background(), publish))
+	assert.Equal(t, []string{"first", "third"}, published)
+
+	var broken models.OutboxMessage
+	db.GormDB.Where("payload = ?", "broken").First(&broken)
+	assert.Nil(t, broken.SentAt)
+	assert.Equal(t, 1, broken.Attempts)
+	assert.Equal(t, "broker unavailable", broken.LastError)
+
+	// Отправленные сообщения повторно не уходят, а неудачное ждёт задержки перед повтором
+	assert.Equal(t, 0, outbox.RelayOnce(context.Background(), publish))
+
+	var sent int64
+	db.GormDB.Model(&models.OutboxMessage{}).Where("sent_at IS NOT NULL").Count(&sent)
+	assert.Equal(t, int64(2), sent)
+}
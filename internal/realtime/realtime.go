@@ -0,0 +1,186 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+)
+
+// Типы событий, которые получают открытые клиенты
+const (
+	EventNotificationCreated = "notification.created" // Новое уведомление в истории
+	EventSubscriptionChanged = "subscription.changed" // Подписка изменена (в том числе с другого устройства)
+	EventUnreadCount         = "unread_count"         // Новое число непрочитанных уведомлений
+)
+
+// Действия над подпиской в событии subscription.changed
+const (
+	SubscriptionCreated = "created"
+	SubscriptionUpdated = "updated"
+	SubscriptionDeleted = "deleted"
+)
+
+const (
+	channelPrefix    = "realtime:user:" // Канал Redis для событий пользователя: realtime:user:<id>
+	subscriberBuffer = 16               // События сверх буфера медленному клиенту не доставляются
+)
+
+// Event -- событие для клиента. Data уже сериализовано, чтобы не кодировать его на каждое соединение.
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// SubscriptionChange -- данные события subscription.changed
+type SubscriptionChange struct {
+	Action         string               `json:"action"`
+	SubscriptionID uint                 `json:"subscription_id"`
+	Subscription   *models.Subscription `json:"subscription,omitempty"` // Нет для удалённой подписки
+}
+
+// Hub раздаёт события из Redis соединениям этого экземпляра сервиса.
+// Каждый экземпляр слушает все каналы пользователей, поэтому событие,
+// опубликованное любым экземпляром, доходит до всех устройств пользователя.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[int]map[chan Event]struct{}
+}
+
+// NewHub создаёт пустой Hub
+func NewHub() *Hub {
+	return &Hub{subscribers: map[int]map[chan Event]struct{}{}}
+}
+
+var defaultHub = NewHub()
+
+// Start подписывает экземпляр сервиса на события пользователей в Redis и работает до отмены ctx
+func Start(ctx context.Context) {
+	logger.Info("Realtime hub started")
+	defaultHub.Run(ctx)
+}
+
+// Subscribe регистрирует соединение пользователя. Вызывающий обязан вызвать функцию отписки.
+func Subscribe(userID int) (<-chan Event, func()) {
+	return defaultHub.Subscribe(userID)
+}
+
+// Subscribe регистрирует соединение пользователя и возвращает канал событий и функцию отписки
+func (h *Hub) Subscribe(userID int) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = map[chan Event]struct{}{}
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Deliver передаёт событие всем соединениям пользователя на этом экземпляре, не блокируясь на медленных
+func (h *Hub) Deliver(userID int, event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+			logger.Warn("Realtime subscriber is too slow, dropping event", "userID", userID, "type", event.Type)
+		}
+	}
+}
+
+// Run слушает каналы пользователей в Redis до отмены ctx. Переподключение выполняет go-redis.
+func (h *Hub) Run(ctx context.Context) {
+	pubsub := db.RedisClient.PSubscribe(ctx, channelPrefix+"*")
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			userID, err := strconv.Atoi(strings.TrimPrefix(message.Channel, channelPrefix))
+			if err != nil {
+				logger.Warn("Invalid realtime channel", "channel", message.Channel)
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				logger.Warn("Invalid realtime event", "channel", message.Channel, "error", err)
+				continue
+			}
+			h.Deliver(userID, event)
+		}
+	}
+}
+
+// Publish отправляет событие всем открытым соединениям пользователя на всех экземплярах сервиса.
+// Доставка не гарантируется: клиент после переподключения перечитывает состояние обычными запросами.
+func Publish(ctx context.Context, userID int, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Error("Failed to marshal realtime event", "type", eventType, "error", err)
+		return
+	}
+	message, err := json.Marshal(Event{Type: eventType, Data: payload})
+	if err != nil {
+		logger.Error("Failed to marshal realtime event", "type", eventType, "error", err)
+		return
+	}
+
+	if err := db.RedisClient.Publish(ctx, channelPrefix+strconv.Itoa(userID), message).Err(); err != nil {
+		logger.Warn("Failed to publish realtime event", "userID", userID, "type", eventType, "error", err)
+	}
+}
+
+// PublishSubscriptionChanged сообщает устройствам пользователя об изменении подписки
+func PublishSubscriptionChanged(ctx context.Context, userID int, action string, subscription models.Subscription) {
+	change := SubscriptionChange{Action: action, SubscriptionID: subscription.ID}
+	if action != SubscriptionDeleted {
+		change.Subscription = &subscription
+	}
+	Publish(ctx, userID, EventSubscriptionChanged, change)
+}
+
+// UnreadCount возвращает число непрочитанных уведомлений пользователя (без неотправленных)
+func UnreadCount(userID int) (int64, error) {
+	var count int64
+	err := db.GormDB.Model(&models.Notification{}).Scopes(models.VisibleNotifications).
+		Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// PublishUnreadCount пересчитывает и рассылает число непрочитанных уведомлений
+func PublishUnreadCount(ctx context.Context, userID int) {
+	count, err := UnreadCount(userID)
+	if err != nil {
+		logger.Warn("Failed to count unread notifications", "userID", userID, "error", err)
+		return
+	}
+	Publish(ctx, userID, EventUnreadCount, map[string]int64{"unread_count": count})
+}
@@ -0,0 +1,82 @@
+package realtime_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/realtime"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+func receive(t *testing.T, events <-chan realtime.Event) (realtime.Event, bool) {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		return event, ok
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+		return realtime.Event{}, false
+	}
+}
+
+func TestHubDeliversOnlyToUserConnections(t *testing.T) {
+	hub := realtime.NewHub()
+	phone, unsubscribePhone := hub.Subscribe(1)
+	defer unsubscribePhone()
+	tablet, unsubscribeTablet := hub.Subscribe(1)
+	defer unsubscribeTablet()
+	other, unsubscribeOther := hub.Subscribe(2)
+	defer unsubscribeOther()
+
+	event := realtime.Event{Type: realtime.EventUnreadCount, Data: json.RawMessage(`{"unread_count":3}`)}
+	hub.Deliver(1, event)
+
+	for _, events := range []<-chan realtime.Event{phone, tablet} {
+		received, ok := receive(t, events)
+		assert.True(t, ok)
+		assert.Equal(t, event, received)
+	}
+	assert.Empty(t, other)
+}
+
+func TestHubUnsubscribeClosesChannel(t *testing.T) {
+	hub := realtime.NewHub()
+	events, unsubscribe := hub.Subscribe(1)
+
+	unsubscribe()
+	unsubscribe() // Повторный вызов безопасен
+
+	_, ok := receive(t, events)
+	assert.False(t, ok)
+	hub.Deliver(1, realtime.Event{Type: realtime.EventUnreadCount}) // Не паникует после отписки
+}
+
+func TestHubDropsEventsForSlowSubscriber(t *testing.T) {
+	hub := realtime.NewHub()
+	events, unsubscribe := hub.Subscribe(1)
+	defer unsubscribe()
+
+	// Deliver не должен блокироваться, даже если клиент не читает события
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			hub.Deliver(1, realtime.Event{Type: realtime.EventUnreadCount})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Deliver blocked on a slow subscriber")
+	}
+	assert.Less(t, len(events), 100)
+}
@@ -0,0 +1,12 @@
+package reminderqueue
+
+import (
+	"fmt"
+	"time"
+)
+
+// IdempotencyKey возвращает ключ напоминания за один период: подписка, вид задачи и время, на которое оно назначено.
+// После переноса даты (изменение подписки, тихие часы, следующий период) ключ меняется.
+func IdempotencyKey(subscriptionID uint, kind string, dueAt time.Time) string {
+	return fmt.Sprintf("%s:%d:%d", kind, subscriptionID, dueAt.UTC().Unix())
+}
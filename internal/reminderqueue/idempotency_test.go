@@ -0,0 +1,20 @@
+package reminderqueue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/reminderqueue"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyKeyIsPerPeriod(t *testing.T) {
+	due := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, reminderqueue.IdempotencyKey(1, reminderqueue.KindReminder, due),
+		reminderqueue.IdempotencyKey(1, reminderqueue.KindReminder, due.In(time.FixedZone("MSK", 3*3600))))
+	assert.NotEqual(t, reminderqueue.IdempotencyKey(1, reminderqueue.KindReminder, due),
+		reminderqueue.IdempotencyKey(1, reminderqueue.KindReminder, due.AddDate(0, 1, 0)))
+	assert.NotEqual(t, reminderqueue.IdempotencyKey(1, reminderqueue.KindReminder, due),
+		reminderqueue.IdempotencyKey(1, reminderqueue.KindSnooze, due))
+}
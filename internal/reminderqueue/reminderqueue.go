@@ -0,0 +1,174 @@
+package reminderqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mathrand "math/rand"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Виды задач очереди
+const (
+	KindReminder = "reminder" // Напоминание по notification_date
+	KindSnooze   = "snooze"   // Повтор отложенного напоминания по snoozed_until
+)
+
+const (
+	MaxAttempts    = 8                // После стольких захватов задача снимается с очереди
+	baseRetryDelay = 30 * time.Second // Задержка перед первым повтором, дальше удваивается
+	maxRetryDelay  = 30 * time.Minute
+)
+
+// MaxJitter -- на сколько самое большее задача сдвигается позже своего времени, чтобы напоминания,
+// назначенные на одно время (например, 09:00), не уходили одной пачкой
+const MaxJitter = 120 * time.Second
+
+// Enqueue ставит задачу kind по подписке на runAt. Если задача уже есть, она переносится
+// и сбрасывается: захват воркером снимается, счётчик попыток обнуляется.
+// tx позволяет поставить задачу в той же транзакции, что и изменение подписки.
+func Enqueue(tx *gorm.DB, subscriptionID uint, kind string, runAt time.Time) error {
+	job := models.ReminderJob{
+		SubscriptionID: subscriptionID,
+		Kind:           kind,
+		RunAt:          runAt.UTC(),
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subscription_id"}, {Name: "kind"}},
+		DoUpdates: clause.AssignmentColumns([]string{"run_at", "attempts", "lease_token", "last_error", "updated_at"}),
+	}).Create(&job).Error
+}
+
+// WithJitter возвращает время задачи для срока dueAt: со случайным сдвигом от 0 до MaxJitter.
+// Сдвиг хранится в очереди вместе с задачей, поэтому переживает перезапуск сервиса.
+func WithJitter(dueAt time.Time) time.Time {
+	return dueAt.Add(time.Duration(mathrand.Int63n(int64(MaxJitter))))
+}
+
+// Schedule приводит очередь в соответствие с подпиской: напоминание -- на NotificationDate,
+// повтор -- на SnoozedUntil (или отменяется, если подписка не отложена). К обоим добавляется джиттер.
+func Schedule(tx *gorm.DB, subscription models.Subscription) error {
+	if err := Enqueue(tx, subscription.ID, KindReminder, WithJitter(subscription.NotificationDate)); err != nil {
+		return err
+	}
+	if subscription.SnoozedUntil != nil {
+		return Enqueue(tx, subscription.ID, KindSnooze, WithJitter(*subscription.SnoozedUntil))
+	}
+	return Cancel(tx, subscription.ID, KindSnooze)
+}
+
+// Cancel снимает с очереди задачи подписки указанных видов (без kinds -- все)
+func Cancel(tx *gorm.DB, subscriptionID uint, kinds ...string) error {
+	query := tx.Where("subscription_id = ?", subscriptionID)
+	if len(kinds) > 0 {
+		query = query.Where("kind IN ?", kinds)
+	}
+	return query.Delete(&models.ReminderJob{}).Error
+}
+
+// Claim забирает до limit задач, время которых подошло. Забранная задача невидима для других
+// воркеров visibility; если воркер упадёт, не завершив её, задачу по истечении этого срока заберёт другой.
+// В возвращённых задачах RunAt -- время, на которое задача была запланирована.
+func Claim(ctx context.Context, limit int, visibility time.Duration) ([]models.ReminderJob, error) {
+	token, err := newLeaseToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+
+	var jobs []models.ReminderJob
+	err = db.GormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("run_at <= ?", now).Order("run_at").Limit(limit)
+		// Экземпляры сервиса забирают разные задачи, не дожидаясь блокировок друг друга
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.Find(&jobs).Error; err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(jobs))
+		for _, job := range jobs {
+			ids = append(ids, job.ID)
+		}
+		return tx.Model(&models.ReminderJob{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"run_at":      now.Add(visibility),
+			"lease_token": token,
+			"attempts":    gorm.Expr("attempts + 1"),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range jobs {
+		jobs[i].LeaseToken = token
+		jobs[i].Attempts++
+	}
+	return jobs, nil
+}
+
+// Complete снимает обработанную задачу с очереди. Если за время обработки задачу перенесли
+// (например, подписку изменили или сдвинули на следующий период), она остаётся в очереди.
+func Complete(ctx context.Context, job models.ReminderJob) error {
+	return db.GormDB.WithContext(ctx).
+		Where("id = ? AND lease_token = ?", job.ID, job.LeaseToken).
+		Delete(&models.ReminderJob{}).Error
+}
+
+// Retry возвращает задачу в очередь через delay после неудачной попытки
+func Retry(ctx context.Context, job models.ReminderJob, delay time.Duration, reason string) error {
+	return db.GormDB.WithContext(ctx).Model(&models.ReminderJob{}).
+		Where("id = ? AND lease_token = ?", job.ID, job.LeaseToken).
+		Updates(map[string]interface{}{
+			"run_at":      time.Now().UTC().Add(delay),
+			"lease_token": "",
+			"last_error":  reason,
+		}).Error
+}
+
+// NextRunAt возвращает время ближайшей задачи; ok == false, если очередь пуста
+func NextRunAt(ctx context.Context) (time.Time, bool, error) {
+	var job models.ReminderJob
+	err := db.GormDB.WithContext(ctx).Order("run_at").Select("run_at").First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return job.RunAt, true, nil
+}
+
+// RetryDelay возвращает задержку перед повтором: 30s, 1m, 2m, ... но не больше 30 минут
+func RetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 7 {
+		return maxRetryDelay
+	}
+	delay := baseRetryDelay * time.Duration(1<<uint(attempts-1))
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// newLeaseToken создаёт метку захвата задач
+func newLeaseToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,161 @@
+package reminderqueue_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/reminderqueue"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+// initQueueDB создаёт таблицу очереди в SQLite в памяти
+func initQueueDB(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open("file:reminderqueue?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal("Failed to initialize mock database", err)
+	}
+	gormDB.Migrator().DropTable(&models.ReminderJob{})
+	gormDB.AutoMigrate(&models.ReminderJob{})
+
+	// SQLite не разбирает колонки timestamptz обратно в time.Time, пересоздаём их с datetime
+	var ddl string
+	gormDB.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", "reminder_jobs").Scan(&ddl)
+	gormDB.Exec("DROP TABLE reminder_jobs")
+	gormDB.Exec(strings.ReplaceAll(ddl, "timestamptz", "datetime"))
+	gormDB.Exec("CREATE UNIQUE INDEX idx_reminder_job_subscription_kind ON reminder_jobs (subscription_id, kind)")
+	db.GormDB = gormDB
+}
+
+func TestEnqueueReschedulesExistingJob(t *testing.T) {
+	initQueueDB(t)
+	runAt := time.Now().UTC().Add(time.Hour)
+
+	assert.NoError(t, reminderqueue.Enqueue(db.GormDB, 1, reminderqueue.KindReminder, runAt))
+	assert.NoError(t, reminderqueue.Enqueue(db.GormDB, 1, reminderqueue.KindReminder, runAt.Add(time.Hour)))
+	assert.NoError(t, reminderqueue.Enqueue(db.GormDB, 1, reminderqueue.KindSnooze, runAt))
+
+	var jobs []models.ReminderJob
+	db.GormDB.Order("kind").Find(&jobs)
+	if assert.Len(t, jobs, 2) {
+		assert.Equal(t, reminderqueue.KindReminder, jobs[0].Kind)
+		assert.WithinDuration(t, runAt.Add(time.Hour), jobs[0].RunAt, time.Second)
+	}
+}
+
+func TestClaimHidesJobUntilVisibilityTimeout(t *testing.T) {
+	initQueueDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	assert.NoError(t, reminderqueue.Enqueue(db.GormDB, 1, reminderqueue.KindReminder, now.Add(-time.Minute)))
+	assert.NoError(t, reminderqueue.Enqueue(db.GormDB, 2, reminderqueue.KindReminder, now.Add(time.Hour)))
+
+	claimed, err := reminderqueue.Claim(ctx, 10, 100*time.Millisecond)
+	assert.NoError(t, err)
+	if assert.Len(t, claimed, 1) {
+		assert.Equal(t, uint(1), claimed[0].SubscriptionID)
+		assert.Equal(t, 1, claimed[0].Attempts)
+	}
+
+	// Пока задача у воркера, другие её не видят
+	again, err := reminderqueue.Claim(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, again)
+
+	// Воркер "упал": после истечения захвата задачу забирает другой, а первый уже не может её завершить
+	time.Sleep(150 * time.Millisecond)
+	again, err = reminderqueue.Claim(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	if assert.Len(t, again, 1) {
+		assert.Equal(t, 2, again[0].Attempts)
+	}
+
+	assert.NoError(t, reminderqueue.Complete(ctx, claimed[0]))
+	var count int64
+	db.GormDB.Model(&models.ReminderJob{}).Where("subscription_id = ?", 1).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	assert.NoError(t, reminderqueue.Complete(ctx, again[0]))
+	db.GormDB.Model(&models.ReminderJob{}).Where("subscription_id = ?", 1).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestCompleteKeepsJobRescheduledDuringProcessing(t *testing.T) {
+	initQueueDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	assert.NoError(t, reminderqueue.Enqueue(db.GormDB, 1, reminderqueue.KindReminder, now.Add(-time.Minute)))
+	claimed, err := reminderqueue.Claim(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+
+	// Пока воркер отправлял напоминание, подписку сдвинули на следующий месяц
+	next := now.AddDate(0, 1, 0)
+	assert.NoError(t, reminderqueue.Enqueue(db.GormDB, 1, reminderqueue.KindReminder, next))
+	assert.NoError(t, reminderqueue.Complete(ctx, claimed[0]))
+
+	runAt, ok, err := reminderqueue.NextRunAt(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.WithinDuration(t, next, runAt, time.Second)
+}
+
+func TestRetryReturnsJobAfterDelay(t *testing.T) {
+	initQueueDB(t)
+	ctx := context.Background()
+
+	assert.NoError(t, reminderqueue.Enqueue(db.GormDB, 1, reminderqueue.KindReminder, time.Now().UTC().Add(-time.Minute)))
+	claimed, err := reminderqueue.Claim(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+
+	assert.NoError(t, reminderqueue.Retry(ctx, claimed[0], 50*time.Millisecond, "kafka unavailable"))
+
+	var job models.ReminderJob
+	db.GormDB.First(&job)
+	assert.Equal(t, "kafka unavailable", job.LastError)
+	assert.Empty(t, job.LeaseToken)
+
+	time.Sleep(100 * time.Millisecond)
+	again, err := reminderqueue.Claim(ctx, 10, time.Minute)
+	assert.NoError(t, err)
+	if assert.Len(t, again, 1) {
+		assert.Equal(t, 2, again[0].Attempts)
+	}
+}
+
+func TestScheduleBakesJitterIntoRunAt(t *testing.T) {
+	initQueueDB(t)
+	notificationDate := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	snoozedUntil := notificationDate.Add(time.Hour)
+
+	assert.NoError(t, reminderqueue.Schedule(db.GormDB, models.Subscription{
+		Model:            gorm.Model{ID: 1},
+		NotificationDate: notificationDate,
+		SnoozedUntil:     &snoozedUntil,
+	}))
+
+	// Джиттер хранится во времени задачи: не раньше срока и не позже чем через MaxJitter
+	var jobs []models.ReminderJob
+	db.GormDB.Order("kind").Find(&jobs)
+	if assert.Len(t, jobs, 2) {
+		for i, dueAt := range []time.Time{notificationDate, snoozedUntil} {
+			assert.False(t, jobs[i].RunAt.Before(dueAt), jobs[i].Kind)
+			assert.True(t, jobs[i].RunAt.Before(dueAt.Add(reminderqueue.MaxJitter)), jobs[i].Kind)
+		}
+	}
+}
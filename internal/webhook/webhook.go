@@ -0,0 +1,365 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/netguard"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Типы событий, на которые можно подписать webhook
+const (
+	EventReminderDue         = "reminder.due"
+	EventSubscriptionCreated = "subscription.created"
+	EventSubscriptionUpdated = "subscription.updated"
+	EventSubscriptionDeleted = "subscription.deleted"
+	EventPaymentOverdue      = "payment.overdue"
+)
+
+// SupportedEvents -- все поддерживаемые типы событий
+var SupportedEvents = []string{
+	EventReminderDue,
+	EventSubscriptionCreated,
+	EventSubscriptionUpdated,
+	EventSubscriptionDeleted,
+	EventPaymentOverdue,
+}
+
+const (
+	maxAttempts      = 8                // Попыток доставки одного события
+	baseRetryDelay   = 30 * time.Second // Задержка перед первым повтором, дальше удваивается
+	disableThreshold = 5                // После стольких подряд проваленных доставок endpoint отключается
+	claimTimeout     = 2 * time.Minute  // На это время доставка "забирается" воркером
+	retryInterval    = 30 * time.Second // Как часто воркер проверяет доставки, время повтора которых подошло
+	retryBatchSize   = 100
+)
+
+// SignatureHeader -- заголовок с подписью: "t=<unix>,v1=<hex(HMAC-SHA256(secret, "<t>.<body>"))>"
+const SignatureHeader = "X-PayAware-Signature"
+
+// httpClient не подключается к адресам внутренней сети: URL endpoint'а задаёт пользователь
+var httpClient = netguard.NewHTTPClient(10 * time.Second)
+
+// deliveryQueued будит воркер доставки, когда появились новые доставки
+var deliveryQueued = make(chan struct{}, 1)
+
+// envelope -- тело запроса, отправляемого на endpoint
+type envelope struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// IsSupportedEvent проверяет, что тип события известен
+func IsSupportedEvent(event string) bool {
+	for _, e := range SupportedEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscriptionData -- представление подписки в событиях
+func SubscriptionData(subscription models.Subscription) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                subscription.ID,
+		"service_name":      subscription.ServiceName,
+		"cost":              subscription.Cost,
+		"next_payment_date": subscription.NextPaymentDate,
+		"recurrence_type":   subscription.RecurrenceType,
+		"tag":               subscription.Tag,
+		"high_priority":     subscription.HighPriority,
+	}
+}
+
+// Publish ставит событие в очередь доставки на все активные endpoint'ы пользователя,
+// подписанные на этот тип события, и будит воркер доставки.
+// Возвращает количество поставленных в очередь доставок.
+func Publish(ctx context.Context, userID int, event string, data interface{}) int {
+	var endpoints []models.WebhookEndpoint
+	if err := db.GormDB.Where("user_id = ? AND enabled = ?", userID, true).Find(&endpoints).Error; err != nil {
+		logger.Error("Failed to load webhook endpoints", "userID", userID, "error", err)
+		return 0
+	}
+	if len(endpoints) == 0 {
+		return 0
+	}
+
+	eventID, err := newEventID()
+	if err != nil {
+		logger.Error("Failed to generate webhook event ID", "error", err)
+		return 0
+	}
+
+	payload, err := json.Marshal(envelope{
+		ID:        eventID,
+		Type:      event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		logger.Error("Failed to marshal webhook payload", "event", event, "error", err)
+		return 0
+	}
+
+	queued := 0
+	for _, endpoint := range endpoints {
+		if !subscribedTo(endpoint, event) {
+			continue
+		}
+
+		now := time.Now().UTC()
+		delivery := models.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			EventID:       eventID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        "pending",
+			NextAttemptAt: &now,
+		}
+		if err := db.GormDB.WithContext(ctx).Create(&delivery).Error; err != nil {
+			logger.Error("Failed to create webhook delivery", "endpointID", endpoint.ID, "error", err)
+			continue
+		}
+		queued++
+	}
+
+	if queued > 0 {
+		select {
+		case deliveryQueued <- struct{}{}:
+		default:
+		}
+		logger.Debug("Webhook event published", "userID", userID, "event", event, "eventID", eventID, "deliveries", queued)
+	}
+	return queued
+}
+
+// StartRetryWorker доставляет новые события и повторяет доставки, время которых подошло, пока не отменён ctx.
+// Начатая доставка доделывается; остальные остаются в очереди до следующего запуска.
+func StartRetryWorker(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	logger.Info("Webhook retry worker started")
+	for {
+		deliverDue(ctx)
+
+		select {
+		case <-deliveryQueued:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverDue доставляет пачку доставок, время которых подошло
+func deliverDue(ctx context.Context) {
+	var deliveries []models.WebhookDelivery
+	if err := db.GormDB.
+		Where("status = ? AND next_attempt_at <= ?", "pending", time.Now().UTC()).
+		Order("next_attempt_at").
+		Limit(retryBatchSize).
+		Find(&deliveries).Error; err != nil {
+		logger.Error("Failed to load pending webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		// Запрос не прерываем остановкой: его ограничивает таймаут httpClient
+		Deliver(context.Background(), delivery.ID)
+	}
+}
+
+// Deliver выполняет одну попытку доставки. При неудаче планирует повтор с экспоненциальной задержкой,
+// а после исчерпания попыток помечает доставку проваленной и при необходимости отключает endpoint.
+func Deliver(ctx context.Context, deliveryID uint) {
+	now := time.Now().UTC()
+	claimUntil := now.Add(claimTimeout)
+
+	// Забираем доставку, чтобы её не обработал параллельно другой воркер
+	result := db.GormDB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", deliveryID, "pending", now).
+		Update("next_attempt_at", claimUntil)
+	if result.Error != nil {
+		logger.Error("Failed to claim webhook delivery", "deliveryID", deliveryID, "error", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	if err := db.GormDB.First(&delivery, deliveryID).Error; err != nil {
+		logger.Error("Failed to load webhook delivery", "deliveryID", deliveryID, "error", err)
+		return
+	}
+
+	var endpoint models.WebhookEndpoint
+	if err := db.GormDB.First(&endpoint, delivery.EndpointID).Error; err != nil || !endpoint.Enabled {
+		db.GormDB.Model(&delivery).Updates(map[string]interface{}{
+			"status":     "failed",
+			"last_error": "endpoint is disabled or deleted",
+		})
+		return
+	}
+
+	statusCode, sendErr := send(ctx, endpoint, delivery)
+	delivery.Attempts++
+	delivery.ResponseCode = statusCode
+
+	if sendErr == nil {
+		deliveredAt := time.Now().UTC()
+		db.GormDB.Model(&delivery).Updates(map[string]interface{}{
+			"status":          "success",
+			"attempts":        delivery.Attempts,
+			"response_code":   statusCode,
+			"last_error":      "",
+			"next_attempt_at": nil,
+			"delivered_at":    &deliveredAt,
+		})
+		// Счётчик сбрасываем по значению в БД: загруженное до отправки могло устареть
+		db.GormDB.Model(&models.WebhookEndpoint{}).
+			Where("id = ? AND consecutive_failures > 0", endpoint.ID).
+			Update("consecutive_failures", 0)
+		logger.Debug("Webhook delivered", "deliveryID", delivery.ID, "endpointID", endpoint.ID, "event", delivery.Event)
+		return
+	}
+
+	logger.Warn("Webhook delivery attempt failed", "deliveryID", delivery.ID, "endpointID", endpoint.ID, "attempt", delivery.Attempts, "error", sendErr)
+
+	if delivery.Attempts < maxAttempts {
+		nextAttemptAt := time.Now().UTC().Add(RetryDelay(delivery.Attempts))
+		db.GormDB.Model(&delivery).Updates(map[string]interface{}{
+			"attempts":        delivery.Attempts,
+			"response_code":   statusCode,
+			"last_error":      sendErr.Error(),
+			"next_attempt_at": &nextAttemptAt,
+		})
+		return
+	}
+
+	db.GormDB.Model(&delivery).Updates(map[string]interface{}{
+		"status":          "failed",
+		"attempts":        delivery.Attempts,
+		"response_code":   statusCode,
+		"last_error":      sendErr.Error(),
+		"next_attempt_at": nil,
+	})
+	registerFailure(endpoint)
+}
+
+// RetryDelay возвращает задержку перед следующей попыткой: 30s, 1m, 2m, 4m, ...
+func RetryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return baseRetryDelay * time.Duration(1<<uint(attempts-1))
+}
+
+// Sign вычисляет значение заголовка подписи для тела запроса
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// GenerateSecret создаёт новый секрет для подписи запросов
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// send отправляет подписанный запрос и возвращает HTTP-статус ответа
+func send(ctx context.Context, endpoint models.WebhookEndpoint, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PayAware-Webhooks/1.0")
+	req.Header.Set("X-PayAware-Event", delivery.Event)
+	req.Header.Set("X-PayAware-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, time.Now().Unix(), body))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// registerFailure учитывает проваленную доставку и отключает endpoint после disableThreshold подряд.
+// Счётчик увеличивается и проверяется одним запросом: доставки на один endpoint идут параллельно.
+func registerFailure(endpoint models.WebhookEndpoint) {
+	now := time.Now().UTC()
+	var updated models.WebhookEndpoint
+	err := db.GormDB.Model(&updated).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "consecutive_failures"}}}).
+		Where("id = ?", endpoint.ID).
+		Updates(map[string]interface{}{
+			"consecutive_failures": gorm.Expr("consecutive_failures + 1"),
+			"enabled":              gorm.Expr("CASE WHEN consecutive_failures + 1 >= ? THEN ? ELSE enabled END", disableThreshold, false),
+			"disabled_at":          gorm.Expr("CASE WHEN consecutive_failures + 1 >= ? AND enabled THEN ? ELSE disabled_at END", disableThreshold, now),
+		}).Error
+	if err != nil {
+		logger.Error("Failed to update webhook endpoint failures", "endpointID", endpoint.ID, "error", err)
+		return
+	}
+
+	if updated.ConsecutiveFailures == disableThreshold {
+		logger.Warn("Webhook endpoint disabled after repeated failures", "endpointID", endpoint.ID, "userID", endpoint.UserID)
+	}
+}
+
+// subscribedTo проверяет, подписан ли endpoint на событие
+func subscribedTo(endpoint models.WebhookEndpoint, event string) bool {
+	for _, e := range endpoint.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// newEventID создаёт уникальный идентификатор события
+func newEventID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "evt_" + hex.EncodeToString(buf), nil
+}
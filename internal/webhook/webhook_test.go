@@ -0,0 +1,195 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/netguard"
+	"github.com/SergeyMilch/pay_aware/internal/webhook"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	// Тестовые endpoint'ы -- httptest-серверы на 127.0.0.1
+	os.Setenv("ALLOW_PRIVATE_NETWORK_TARGETS", "true")
+	os.Exit(m.Run())
+}
+
+// initWebhookDB создаёт чистую базу в памяти с таблицами webhook'ов
+func initWebhookDB(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal("Failed to initialize mock database", err)
+	}
+	gormDB.Migrator().DropTable(&models.WebhookEndpoint{}, &models.WebhookDelivery{})
+	gormDB.AutoMigrate(&models.WebhookEndpoint{}, &models.WebhookDelivery{})
+
+	// SQLite не знает тип timestamptz и не разбирает такие колонки обратно в time.Time,
+	// поэтому пересоздаём таблицы с datetime
+	for _, table := range []string{"webhook_endpoints", "webhook_deliveries"} {
+		var ddl string
+		gormDB.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&ddl)
+		gormDB.Exec("DROP TABLE " + table)
+		gormDB.Exec(strings.ReplaceAll(ddl, "timestamptz", "datetime"))
+	}
+	db.GormDB = gormDB
+}
+
+// createDelivery создаёт endpoint и ожидающую доставку для него
+func createDelivery(t *testing.T, url string, attempts, failures int) (models.WebhookEndpoint, models.WebhookDelivery) {
+	endpoint := models.WebhookEndpoint{
+		UserID:              1,
+		URL:                 url,
+		Secret:              "whsec_test",
+		Events:              []string{webhook.EventReminderDue},
+		Enabled:             true,
+		ConsecutiveFailures: failures,
+	}
+	assert.NoError(t, db.GormDB.Create(&endpoint).Error)
+
+	now := time.Now().UTC().Add(-time.Second)
+	delivery := models.WebhookDelivery{
+		EndpointID:    endpoint.ID,
+		EventID:       "evt_test",
+		Event:         webhook.EventReminderDue,
+		Payload:       `{"id":"evt_test","type":"reminder.due","data":{}}`,
+		Status:        "pending",
+		Attempts:      attempts,
+		NextAttemptAt: &now,
+	}
+	assert.NoError(t, db.GormDB.Create(&delivery).Error)
+	return endpoint, delivery
+}
+
+func TestDeliverSignsPayloadAndMarksSuccess(t *testing.T) {
+	initWebhookDB(t)
+
+	var gotSignature string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(webhook.SignatureHeader)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	_, delivery := createDelivery(t, server.URL, 0, 0)
+	webhook.Deliver(context.Background(), delivery.ID)
+
+	// Подпись должна проверяться секретом endpoint'а
+	parts := strings.Split(gotSignature, ",")
+	assert.Len(t, parts, 2)
+	timestamp, err := strconv.ParseInt(strings.TrimPrefix(parts[0], "t="), 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, webhook.Sign("whsec_test", timestamp, gotBody), gotSignature)
+
+	var stored models.WebhookDelivery
+	db.GormDB.First(&stored, delivery.ID)
+	assert.Equal(t, "success", stored.Status)
+	assert.Equal(t, 1, stored.Attempts)
+	assert.Equal(t, http.StatusNoContent, stored.ResponseCode)
+	assert.NotNil(t, stored.DeliveredAt)
+}
+
+func TestDeliverRefusesPrivateAddress(t *testing.T) {
+	initWebhookDB(t)
+	t.Setenv("ALLOW_PRIVATE_NETWORK_TARGETS", "")
+
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	_, delivery := createDelivery(t, server.URL, 0, 0)
+	webhook.Deliver(context.Background(), delivery.ID)
+
+	var stored models.WebhookDelivery
+	db.GormDB.First(&stored, delivery.ID)
+	assert.False(t, called)
+	assert.Equal(t, "pending", stored.Status)
+	assert.Contains(t, stored.LastError, netguard.ErrPrivateAddress.Error())
+}
+
+func TestDeliverSchedulesRetryWithBackoff(t *testing.T) {
+	initWebhookDB(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, delivery := createDelivery(t, server.URL, 2, 0)
+	webhook.Deliver(context.Background(), delivery.ID)
+
+	var stored models.WebhookDelivery
+	db.GormDB.First(&stored, delivery.ID)
+	assert.Equal(t, "pending", stored.Status)
+	assert.Equal(t, 3, stored.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, stored.ResponseCode)
+	assert.WithinDuration(t, time.Now().Add(webhook.RetryDelay(3)), *stored.NextAttemptAt, 5*time.Second)
+}
+
+func TestDeliverDisablesEndpointAfterRepeatedFailures(t *testing.T) {
+	initWebhookDB(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// Последняя попытка последней из подряд проваленных доставок
+	endpoint, delivery := createDelivery(t, server.URL, 7, 4)
+	webhook.Deliver(context.Background(), delivery.ID)
+
+	var storedDelivery models.WebhookDelivery
+	db.GormDB.First(&storedDelivery, delivery.ID)
+	assert.Equal(t, "failed", storedDelivery.Status)
+
+	var storedEndpoint models.WebhookEndpoint
+	db.GormDB.First(&storedEndpoint, endpoint.ID)
+	assert.False(t, storedEndpoint.Enabled)
+	assert.Equal(t, 5, storedEndpoint.ConsecutiveFailures)
+	assert.NotNil(t, storedEndpoint.DisabledAt)
+}
+
+func TestDeliverCountsFailuresRecordedDuringRequest(t *testing.T) {
+	initWebhookDB(t)
+
+	var endpointID uint
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Пока идёт запрос, параллельные доставки на этот endpoint успели провалиться ещё три раза
+		db.GormDB.Model(&models.WebhookEndpoint{}).Where("id = ?", endpointID).Update("consecutive_failures", 4)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	endpoint, delivery := createDelivery(t, server.URL, 7, 1)
+	endpointID = endpoint.ID
+	webhook.Deliver(context.Background(), delivery.ID)
+
+	var storedEndpoint models.WebhookEndpoint
+	db.GormDB.First(&storedEndpoint, endpoint.ID)
+	assert.Equal(t, 5, storedEndpoint.ConsecutiveFailures)
+	assert.False(t, storedEndpoint.Enabled)
+}
+
+func TestRetryDelayDoubles(t *testing.T) {
+	assert.Equal(t, 30*time.Second, webhook.RetryDelay(1))
+	assert.Equal(t, time.Minute, webhook.RetryDelay(2))
+	assert.Equal(t, 4*time.Minute, webhook.RetryDelay(4))
+}
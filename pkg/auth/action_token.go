@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// actionTokenPurpose отличает токен действия над уведомлением от токена авторизации
+const actionTokenPurpose = "notification_action"
+
+// purposeKey выводит из JWT_SECRET отдельный ключ подписи для каждого назначения токена,
+// чтобы токен действия или отписки нельзя было использовать вместо токена авторизации и наоборот
+func purposeKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// GenerateActionToken создаёт подписанный токен, разрешающий действия (оплачено, отложить, пропустить)
+// только над одним уведомлением пользователя. Передаётся в push-уведомлении.
+func GenerateActionToken(userID int, notificationID uint, secret string, duration time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"purpose":         actionTokenPurpose,
+		"uid":             userID,
+		"notification_id": notificationID,
+		"exp":             time.Now().UTC().Add(duration).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(purposeKey(secret, actionTokenPurpose))
+}
+
+// ValidateActionToken проверяет токен действия и возвращает пользователя и уведомление, к которым он выдан
+func ValidateActionToken(tokenStr, secret string) (int, uint, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return purposeKey(secret, actionTokenPurpose), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, 0, fmt.Errorf("invalid action token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != actionTokenPurpose {
+		return 0, 0, fmt.Errorf("invalid action token claims")
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		return 0, 0, fmt.Errorf("action token has no expiration")
+	}
+
+	userID, ok := claims["uid"].(float64)
+	if !ok {
+		return 0, 0, fmt.Errorf("user ID not found in action token")
+	}
+	notificationID, ok := claims["notification_id"].(float64)
+	if !ok {
+		return 0, 0, fmt.Errorf("notification ID not found in action token")
+	}
+
+	return int(userID), uint(notificationID), nil
+}
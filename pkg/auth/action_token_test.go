@@ -0,0 +1,48 @@
+package auth_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "test-secret"
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+func TestActionTokenRoundTrip(t *testing.T) {
+	token, err := auth.GenerateActionToken(5, 42, testSecret, time.Hour)
+	assert.NoError(t, err)
+
+	userID, notificationID, err := auth.ValidateActionToken(token, testSecret)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, userID)
+	assert.Equal(t, uint(42), notificationID)
+}
+
+func TestActionTokenRejectsWrongSecretAndExpiredToken(t *testing.T) {
+	token, _ := auth.GenerateActionToken(5, 42, testSecret, time.Hour)
+	_, _, err := auth.ValidateActionToken(token, "another-secret")
+	assert.Error(t, err)
+
+	expired, _ := auth.GenerateActionToken(5, 42, testSecret, -time.Minute)
+	_, _, err = auth.ValidateActionToken(expired, testSecret)
+	assert.Error(t, err)
+}
+
+func TestActionTokenIsNotInterchangeableWithLoginToken(t *testing.T) {
+	// Токен авторизации не открывает действия над уведомлениями
+	loginToken, err := auth.GenerateJWT(5, testSecret, time.Hour)
+	assert.NoError(t, err)
+
+	_, _, err = auth.ValidateActionToken(loginToken, testSecret)
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// unsubscribeTokenPurpose отличает токен отписки от сводки от остальных токенов
+const unsubscribeTokenPurpose = "digest_unsubscribe"
+
+// GenerateUnsubscribeToken создаёт подписанный токен для ссылки "Отписаться" в письме со сводкой.
+// Токен позволяет только выключить сводку пользователя, без входа в приложение.
+func GenerateUnsubscribeToken(userID int, secret string, duration time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"purpose": unsubscribeTokenPurpose,
+		"uid":     userID,
+		"exp":     time.Now().UTC().Add(duration).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(purposeKey(secret, unsubscribeTokenPurpose))
+}
+
+// ValidateUnsubscribeToken проверяет токен отписки и возвращает пользователя, которому он выдан
+func ValidateUnsubscribeToken(tokenStr, secret string) (int, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return purposeKey(secret, unsubscribeTokenPurpose), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, fmt.Errorf("invalid unsubscribe token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != unsubscribeTokenPurpose {
+		return 0, fmt.Errorf("invalid unsubscribe token claims")
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		return 0, fmt.Errorf("unsubscribe token has no expiration")
+	}
+
+	userID, ok := claims["uid"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("user ID not found in unsubscribe token")
+	}
+	return int(userID), nil
+}
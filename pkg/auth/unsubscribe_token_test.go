@@ -0,0 +1,29 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsubscribeTokenRoundTrip(t *testing.T) {
+	token, err := auth.GenerateUnsubscribeToken(5, testSecret, time.Hour)
+	assert.NoError(t, err)
+
+	userID, err := auth.ValidateUnsubscribeToken(token, testSecret)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, userID)
+}
+
+func TestUnsubscribeTokenIsNotInterchangeableWithActionToken(t *testing.T) {
+	actionToken, _ := auth.GenerateActionToken(5, 42, testSecret, time.Hour)
+	_, err := auth.ValidateUnsubscribeToken(actionToken, testSecret)
+	assert.Error(t, err)
+
+	unsubscribeToken, _ := auth.GenerateUnsubscribeToken(5, testSecret, time.Hour)
+	_, _, err = auth.ValidateActionToken(unsubscribeToken, testSecret)
+	assert.Error(t, err)
+}
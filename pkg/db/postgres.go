@@ -55,6 +55,17 @@ func InitPostgres(cfg *config.Config) {
         &models.User{},
         &models.Subscription{},
         &models.Notification{},
+        &models.AuditEvent{},
+        &models.DataExport{},
+        &models.WebhookEndpoint{},
+        &models.WebhookDelivery{},
+        &models.WebPushSubscription{},
+        &models.NotificationPreference{},
+        &models.Device{},
+        &models.PushTicket{},
+        &models.ReminderJob{},
+        &models.OutboxMessage{},
+        &models.DeadLetter{},
     ); err != nil {
         logger.Error("Failed to migrate models", "error", err)
         log.Fatalf("Failed to migrate models: %v", err)
@@ -64,6 +75,55 @@ func InitPostgres(cfg *config.Config) {
 
     // Создаём уникальный индекс только для тех записей, у которых deleted_at IS NULL
     createUniqueEmailIndex()
+
+    // У пользователя может быть только одна выгрузка данных в работе
+    createPendingDataExportIndex()
+
+    // Переносим токены устройств из users в таблицу devices
+    migrateLegacyDeviceTokens()
+}
+
+// CloseGorm закрывает пул соединений GORM с базой данных
+func CloseGorm() error {
+    if GormDB == nil {
+        return nil
+    }
+    sqlDB, err := GormDB.DB()
+    if err != nil {
+        return err
+    }
+    if err := sqlDB.Close(); err != nil {
+        return err
+    }
+    logger.Info("Postgres connection closed")
+    return nil
+}
+
+// migrateLegacyDeviceTokens переносит единственный users.device_token (до поддержки нескольких устройств)
+// в таблицу devices и удаляет старую колонку. Повторный запуск ничего не делает.
+func migrateLegacyDeviceTokens() {
+    if !GormDB.Migrator().HasColumn("users", "device_token") {
+        return
+    }
+
+    err := GormDB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Exec(`
+            INSERT INTO devices (user_id, token, last_seen_at, created_at, updated_at)
+            SELECT id, device_token, updated_at, NOW(), NOW()
+            FROM users
+            WHERE device_token <> '' AND deleted_at IS NULL
+            ON CONFLICT (token) DO NOTHING
+        `).Error; err != nil {
+            return err
+        }
+        return tx.Migrator().DropColumn("users", "device_token")
+    })
+    if err != nil {
+        logger.Error("Failed to migrate legacy device tokens", "error", err)
+        log.Fatalf("Failed to migrate legacy device tokens: %v", err)
+    }
+
+    logger.Info("Legacy device tokens migrated to devices table")
 }
 
 // createUniqueEmailIndex создаёт "частичный" уникальный индекс в PostgreSQL, 
@@ -84,6 +144,34 @@ func createUniqueEmailIndex() {
     logger.Info("Unique partial index for email (active users) created successfully")
 }
 
+// createPendingDataExportIndex создаёт частичный уникальный индекс: не больше одной выгрузки
+// со статусом pending на пользователя. Лишние pending-выгрузки, оставшиеся от прежних версий, помечаются как failed.
+func createPendingDataExportIndex() {
+    err := GormDB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Exec(`
+            UPDATE data_exports SET status = 'failed'
+            WHERE status = 'pending' AND deleted_at IS NULL AND id NOT IN (
+                SELECT MAX(id) FROM data_exports
+                WHERE status = 'pending' AND deleted_at IS NULL
+                GROUP BY user_id
+            )
+        `).Error; err != nil {
+            return err
+        }
+        return tx.Exec(`
+            CREATE UNIQUE INDEX IF NOT EXISTS unique_pending_data_export
+            ON data_exports (user_id)
+            WHERE status = 'pending' AND deleted_at IS NULL;
+        `).Error
+    })
+    if err != nil {
+        logger.Error("Failed to create partial unique index for pending data exports", "error", err)
+        log.Fatalf("Failed to create partial unique index for pending data exports: %v", err)
+    }
+
+    logger.Info("Unique partial index for pending data exports created successfully")
+}
+
 // InitTestPostgres инициализирует тестовую базу данных с использованием SQLite (in-memory)
 func InitTestPostgres() {
     var err error
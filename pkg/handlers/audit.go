@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// recordAuditEvent сохраняет событие аудита. Ошибка записи не должна ломать основной запрос,
+// поэтому она только логируется.
+func recordAuditEvent(c *gin.Context, userID int, action string) {
+    event := models.AuditEvent{
+        UserID:    userID,
+        Action:    action,
+        IP:        c.ClientIP(),
+        UserAgent: c.Request.UserAgent(),
+    }
+
+    if err := db.GormDB.Create(&event).Error; err != nil {
+        logger.Warn("Failed to record audit event", "userID", userID, "action", action, "error", err)
+    }
+}
@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
+	"github.com/SergeyMilch/pay_aware/internal/lifecycle"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/SergeyMilch/pay_aware/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	dataExportTTL          = 48 * time.Hour   // Сколько времени ссылка на архив остаётся действительной
+	dataExportBuildTimeout = 15 * time.Minute // Сборку, не законченную за это время, считаем брошенной (процесс упал)
+	dataExportPollInterval = time.Minute      // Как часто обработчик проверяет выгрузки, запрошенные на других экземплярах
+)
+
+// dataExportQueued будит обработчик выгрузок, когда появилась новая
+var dataExportQueued = make(chan struct{}, 1)
+
+// exportedProfile -- профиль пользователя в выгрузке (без хэшей пароля и ПИН-кода)
+type exportedProfile struct {
+	ID                  uint      `json:"id"`
+	Name                string    `json:"name"`
+	Email               string    `json:"email"`
+	NotificationChannel string    `json:"notification_channel"`
+	TelegramChatID      int64     `json:"telegram_chat_id,omitempty"`
+	Locale              string    `json:"locale"`
+	TimeZone            string    `json:"time_zone"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// exportedDevice -- устройство или браузер, на которые отправляются push-уведомления
+type exportedDevice struct {
+	DeviceToken     string     `json:"device_token,omitempty"`
+	Platform        string     `json:"platform,omitempty"`
+	AppVersion      string     `json:"app_version,omitempty"`
+	Name            string     `json:"name,omitempty"`
+	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+	WebPushEndpoint string     `json:"web_push_endpoint,omitempty"`
+	UserAgent       string     `json:"user_agent,omitempty"`
+}
+
+// RequestDataExport запускает асинхронную сборку архива с персональными данными пользователя
+func RequestDataExport(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Брошенная сборка не должна блокировать новую выгрузку. Письмо о неудаче не отправляем:
+	// пользователь как раз запрашивает выгрузку заново и получит письмо о ней.
+	if _, err := failAbandonedDataExports(db.GormDB.Where("user_id = ?", userIDInt), false); err != nil {
+		logger.Error("Failed to fail stale data exports", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request data export"})
+		return
+	}
+
+	token, err := generateExportToken()
+	if err != nil {
+		logger.Error("Failed to generate data export token", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request data export"})
+		return
+	}
+
+	export := models.DataExport{
+		UserID: userIDInt,
+		Token:  token,
+		Status: "pending",
+	}
+	// Уникальный индекс допускает одну pending-выгрузку на пользователя: пока предыдущая в работе, новая не создаётся
+	result := db.GormDB.Clauses(clause.OnConflict{DoNothing: true}).Create(&export)
+	if result.Error != nil {
+		logger.Error("Failed to create data export", "userID", userIDInt, "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request data export"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Data export is already in progress"})
+		return
+	}
+
+	recordAuditEvent(c, userIDInt, "user.data_export_requested")
+
+	// Сборка архива и отправка письма выполняются в фоне обработчиком выгрузок
+	select {
+	case dataExportQueued <- struct{}{}:
+	default:
+	}
+
+	logger.Info("Data export requested", "userID", userIDInt, "exportID", export.ID)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Data export started, a download link will be sent by email"})
+}
+
+// DownloadDataExport отдаёт готовый архив по ссылке из письма
+func DownloadDataExport(c *gin.Context) {
+	token := c.Param("token")
+
+	var export models.DataExport
+	if err := db.GormDB.Where("token = ?", token).First(&export).Error; err != nil {
+		logger.Warn("Data export not found for token")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	if export.Status != "ready" || time.Now().UTC().After(export.ExpiresAt) {
+		logger.Info("Data export is not available", "exportID", export.ID, "status", export.Status)
+		c.JSON(http.StatusGone, gin.H{"error": "Export is not available"})
+		return
+	}
+
+	logger.Info("Data export downloaded", "userID", export.UserID, "exportID", export.ID)
+	c.Header("Content-Disposition", `attachment; filename="pay_aware_export.zip"`)
+	c.Data(http.StatusOK, "application/zip", export.Archive)
+}
+
+// StartDataExportCleanup запускает CRON-задачу, удаляющую просроченные архивы и брошенные сборки, и работает до отмены ctx
+func StartDataExportCleanup(ctx context.Context) {
+	c := cron.New()
+
+	_, err := c.AddFunc("@hourly", cleanupExpiredDataExports)
+	if err != nil {
+		logger.Error("Failed to schedule data export cleanup", "error", err)
+		return
+	}
+
+	logger.Info("Data export cleanup scheduled")
+	lifecycle.RunCron(ctx, c)
+}
+
+// StartDataExportWorker собирает запрошенные выгрузки по одной, пока не отменён ctx. Начатая сборка
+// доделывается; выгрузки, оставшиеся в очереди, собираются после перезапуска.
+func StartDataExportWorker(ctx context.Context) {
+	ticker := time.NewTicker(dataExportPollInterval)
+	defer ticker.Stop()
+
+	logger.Info("Data export worker started")
+	for {
+		processPendingDataExports(ctx)
+
+		select {
+		case <-dataExportQueued:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// processPendingDataExports собирает все ожидающие выгрузки, пока они есть и не отменён ctx
+func processPendingDataExports(ctx context.Context) {
+	for ctx.Err() == nil {
+		export, ok := claimPendingDataExport()
+		if !ok {
+			return
+		}
+		processDataExport(export)
+	}
+}
+
+// claimPendingDataExport забирает самую старую выгрузку из очереди, которую ещё не взял другой обработчик.
+// Возвращает false, если таких нет.
+func claimPendingDataExport() (models.DataExport, bool) {
+	for {
+		// Postgres хранит время с точностью до микросекунд: started_at потом сравнивается на равенство
+		now := time.Now().UTC().Truncate(time.Microsecond)
+
+		var export models.DataExport
+		err := db.GormDB.Where("status = ? AND started_at IS NULL", "pending").
+			Order("id").
+			Limit(1).
+			Find(&export).Error
+		if err != nil {
+			logger.Error("Failed to load pending data exports", "error", err)
+			return models.DataExport{}, false
+		}
+		if export.ID == 0 {
+			return models.DataExport{}, false
+		}
+
+		// Выгрузку мог забрать обработчик на другом экземпляре -- тогда берём следующую
+		result := db.GormDB.Model(&models.DataExport{}).
+			Where("id = ? AND status = ? AND started_at IS NULL", export.ID, "pending").
+			Update("started_at", now)
+		if result.Error != nil {
+			logger.Error("Failed to claim data export", "exportID", export.ID, "error", result.Error)
+			return models.DataExport{}, false
+		}
+		if result.RowsAffected > 0 {
+			export.StartedAt = &now
+			return export, true
+		}
+	}
+}
+
+// failAbandonedDataExports помечает как failed выгрузки из tx, сборка которых начата больше
+// dataExportBuildTimeout назад и не закончена. Если notify, пользователю отправляется письмо.
+func failAbandonedDataExports(tx *gorm.DB, notify bool) (int, error) {
+	var exports []models.DataExport
+	if err := tx.Select("id", "user_id", "started_at").
+		Where("status = ? AND started_at < ?", "pending", time.Now().UTC().Add(-dataExportBuildTimeout)).
+		Find(&exports).Error; err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, export := range exports {
+		if failDataExport(export, notify) {
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+// cleanupExpiredDataExports удаляет архивы с истёкшим сроком и помечает выгрузки как expired,
+// а брошенные сборки -- как failed
+func cleanupExpiredDataExports() {
+	if failed, err := failAbandonedDataExports(db.GormDB, true); err != nil {
+		logger.Error("Failed to fail abandoned data exports", "error", err)
+	} else if failed > 0 {
+		logger.Warn("Abandoned data exports marked as failed", "count", failed)
+	}
+
+	result := db.GormDB.Model(&models.DataExport{}).
+		Where("status = ? AND expires_at < ?", "ready", time.Now().UTC()).
+		Updates(map[string]interface{}{"status": "expired", "archive": nil})
+	if result.Error != nil {
+		logger.Error("Failed to clean up expired data exports", "error", result.Error)
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		logger.Info("Expired data exports cleaned up", "count", result.RowsAffected)
+	}
+}
+
+// processDataExport собирает архив, сохраняет его в БД и отправляет пользователю ссылку
+func processDataExport(export models.DataExport) {
+	var user models.User
+	if err := db.GormDB.First(&user, export.UserID).Error; err != nil {
+		logger.Error("User not found for data export", "userID", export.UserID, "error", err)
+		failDataExport(export, false)
+		return
+	}
+
+	archive, err := buildDataExportArchive(user)
+	if err != nil {
+		logger.Error("Failed to build data export archive", "userID", user.ID, "error", err)
+		failDataExport(export, true)
+		return
+	}
+
+	// Архив хранится в БД, а не на диске: скачать его можно через любой экземпляр сервиса.
+	// Если сборку уже признали брошенной (started_at другой или статус failed), результат не сохраняем.
+	expiresAt := time.Now().UTC().Add(dataExportTTL)
+	result := db.GormDB.Model(&models.DataExport{}).
+		Where("id = ? AND status = ? AND started_at = ?", export.ID, "pending", export.StartedAt).
+		Updates(map[string]interface{}{
+			"status":     "ready",
+			"archive":    archive,
+			"expires_at": expiresAt,
+		})
+	if result.Error != nil {
+		logger.Error("Failed to update data export", "exportID", export.ID, "error", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		logger.Warn("Data export was abandoned before the archive was saved", "exportID", export.ID)
+		return
+	}
+
+	location := utils.LoadUserLocation(user.TimeZone)
+	localExpiresAt := expiresAt.In(location)
+	downloadLink := fmt.Sprintf("%s/data-export/%s", os.Getenv("PUBLIC_BASE_URL"), export.Token)
+	emailBody := i18n.T(user.Locale, "data_export.body", map[string]interface{}{
+		"Link":      downloadLink,
+		"Hours":     int(dataExportTTL.Hours()),
+		"ExpiresAt": i18n.FormatDate(user.Locale, localExpiresAt) + localExpiresAt.Format(" 15:04"),
+		"TimeZone":  location.String(),
+	})
+
+	if err := utils.SendEmail(user.Email, i18n.T(user.Locale, "data_export.subject", nil), emailBody); err != nil {
+		logger.Error("Failed to send data export email", "userID", user.ID, "error", err)
+		return
+	}
+
+	logger.Info("Data export is ready and email sent", "userID", user.ID, "exportID", export.ID)
+}
+
+// buildDataExportArchive собирает ZIP-архив с данными пользователя
+func buildDataExportArchive(user models.User) ([]byte, error) {
+	var subscriptions []models.Subscription
+	if err := db.GormDB.Where("user_id = ?", user.ID).Find(&subscriptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+
+	var notifications []models.Notification
+	if err := db.GormDB.Where("user_id = ?", user.ID).Order("sent_at desc").Find(&notifications).Error; err != nil {
+		return nil, fmt.Errorf("failed to load notifications: %w", err)
+	}
+
+	var auditEvents []models.AuditEvent
+	if err := db.GormDB.Where("user_id = ?", user.ID).Order("created_at desc").Find(&auditEvents).Error; err != nil {
+		return nil, fmt.Errorf("failed to load audit events: %w", err)
+	}
+
+	var webhookEndpoints []models.WebhookEndpoint
+	if err := db.GormDB.Where("user_id = ?", user.ID).Find(&webhookEndpoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to load webhook endpoints: %w", err)
+	}
+
+	var preferences []models.NotificationPreference
+	if err := db.GormDB.Where("user_id = ?", user.ID).Find(&preferences).Error; err != nil {
+		return nil, fmt.Errorf("failed to load notification preferences: %w", err)
+	}
+
+	var webPushSubscriptions []models.WebPushSubscription
+	if err := db.GormDB.Where("user_id = ?", user.ID).Find(&webPushSubscriptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load web push subscriptions: %w", err)
+	}
+
+	var userDevices []models.Device
+	if err := db.GormDB.Where("user_id = ?", user.ID).Order("id").Find(&userDevices).Error; err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+
+	devices := []exportedDevice{}
+	for _, device := range userDevices {
+		devices = append(devices, exportedDevice{
+			DeviceToken: device.Token,
+			Platform:    device.Platform,
+			AppVersion:  device.AppVersion,
+			Name:        device.Name,
+			LastSeenAt:  &device.LastSeenAt,
+		})
+	}
+	for _, subscription := range webPushSubscriptions {
+		devices = append(devices, exportedDevice{
+			WebPushEndpoint: subscription.Endpoint,
+			UserAgent:       subscription.UserAgent,
+		})
+	}
+
+	files := map[string]interface{}{
+		"profile.json": exportedProfile{
+			ID:                  user.ID,
+			Name:                user.Name,
+			Email:               user.Email,
+			NotificationChannel: user.NotificationChannel,
+			TelegramChatID:      user.TelegramChatID,
+			Locale:              user.Locale,
+			TimeZone:            user.TimeZone,
+			CreatedAt:           user.CreatedAt,
+			UpdatedAt:           user.UpdatedAt,
+		},
+		"subscriptions.json":            subscriptions,
+		"notifications.json":            notifications,
+		"devices.json":                  devices,
+		"audit_events.json":             auditEvents,
+		"webhooks.json":                 webhookEndpoints,
+		"notification_preferences.json": preferences,
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		if err := writeJSONToArchive(archive, name, content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize export archive: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeJSONToArchive добавляет в архив файл с JSON-представлением content
+func writeJSONToArchive(archive *zip.Writer, name string, content interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(content); err != nil {
+		return fmt.Errorf("failed to write %s to archive: %w", name, err)
+	}
+	return nil
+}
+
+// failDataExport помечает выгрузку как неудачную, если её всё ещё собирает забравший её обработчик,
+// чтобы пользователь мог запросить выгрузку снова. Если notify, пользователю отправляется письмо.
+func failDataExport(export models.DataExport, notify bool) bool {
+	result := db.GormDB.Model(&models.DataExport{}).
+		Where("id = ? AND status = ? AND started_at = ?", export.ID, "pending", export.StartedAt).
+		Update("status", "failed")
+	if result.Error != nil {
+		logger.Error("Failed to mark data export as failed", "exportID", export.ID, "error", result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	if notify {
+		notifyDataExportFailed(export.UserID)
+	}
+	return true
+}
+
+// notifyDataExportFailed сообщает пользователю, что архив собрать не удалось и выгрузку можно запросить снова
+func notifyDataExportFailed(userID int) {
+	var user models.User
+	if err := db.GormDB.First(&user, userID).Error; err != nil {
+		logger.Error("User not found for data export failure email", "userID", userID, "error", err)
+		return
+	}
+
+	subject := i18n.T(user.Locale, "data_export.failed_subject", nil)
+	if err := utils.SendEmail(user.Email, subject, i18n.T(user.Locale, "data_export.failed_body", nil)); err != nil {
+		logger.Error("Failed to send data export failure email", "userID", userID, "error", err)
+	}
+}
+
+// generateExportToken создаёт случайный токен для ссылки на скачивание
+func generateExportToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/handlers"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// initDataExports создаёт чистую базу выгрузок с тем же частичным индексом, что и в Postgres,
+// и роутер от имени пользователя 1
+func initDataExports(t *testing.T) *gin.Engine {
+	gormDB := setupTestDB(t, &models.DataExport{}, &models.AuditEvent{})
+	gormDB.Exec("CREATE UNIQUE INDEX unique_pending_data_export ON data_exports (user_id) WHERE status = 'pending' AND deleted_at IS NULL")
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("userID", 1) })
+	router.POST("/api/users/me/data-export", handlers.RequestDataExport)
+	return router
+}
+
+// requestDataExport запрашивает выгрузку и возвращает ответ
+func requestDataExport(router *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users/me/data-export", nil))
+	return w
+}
+
+// pendingDataExports возвращает число выгрузок пользователя 1 в работе
+func pendingDataExports(t *testing.T) int64 {
+	var count int64
+	assert.NoError(t, db.GormDB.Model(&models.DataExport{}).Where("user_id = ? AND status = ?", 1, "pending").Count(&count).Error)
+	return count
+}
+
+func TestRequestDataExportAllowsOnePending(t *testing.T) {
+	router := initDataExports(t)
+
+	w := requestDataExport(router)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), "Data export started")
+
+	w = requestDataExport(router)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), "already in progress")
+	assert.Equal(t, int64(1), pendingDataExports(t))
+}
+
+func TestRequestDataExportReplacesAbandonedBuild(t *testing.T) {
+	router := initDataExports(t)
+
+	// Сборка брошена: процесс упал, не успев собрать архив
+	startedAt := time.Now().UTC().Add(-20 * time.Minute)
+	abandoned := models.DataExport{UserID: 1, Token: "abandoned", Status: "pending", StartedAt: &startedAt}
+	assert.NoError(t, db.GormDB.Create(&abandoned).Error)
+
+	w := requestDataExport(router)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), "Data export started")
+
+	assert.NoError(t, db.GormDB.First(&abandoned, abandoned.ID).Error)
+	assert.Equal(t, "failed", abandoned.Status)
+	assert.Equal(t, int64(1), pendingDataExports(t))
+}
+
+func TestRequestDataExportKeepsQueuedExport(t *testing.T) {
+	router := initDataExports(t)
+
+	// Выгрузка давно ждёт в очереди, но её ещё никто не начал собирать -- она не брошена
+	queued := models.DataExport{UserID: 1, Token: "queued", Status: "pending"}
+	queued.CreatedAt = time.Now().UTC().Add(-2 * time.Hour)
+	assert.NoError(t, db.GormDB.Create(&queued).Error)
+
+	w := requestDataExport(router)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), "already in progress")
+
+	assert.NoError(t, db.GormDB.First(&queued, queued.ID).Error)
+	assert.Equal(t, "pending", queued.Status)
+}
@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTestDB создаёт для теста чистую базу SQLite в памяти с таблицами tables и делает её db.GormDB
+func setupTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	gin.SetMode(gin.TestMode)
+
+	name := strings.ReplaceAll(t.Name(), "/", "_")
+	gormDB, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal("Failed to initialize mock database", err)
+	}
+	gormDB.Migrator().DropTable(tables...)
+	gormDB.AutoMigrate(tables...)
+
+	// SQLite не разбирает колонки timestamptz обратно в time.Time, пересоздаём таблицы с datetime
+	// (индексы удаляются вместе с таблицей, их создаём заново)
+	for _, table := range tables {
+		stmt := &gorm.Statement{DB: gormDB}
+		if err := stmt.Parse(table); err != nil {
+			t.Fatal("Failed to parse test model", err)
+		}
+
+		var ddl string
+		var indexes []string
+		gormDB.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", stmt.Schema.Table).Scan(&ddl)
+		gormDB.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", stmt.Schema.Table).Scan(&indexes)
+		gormDB.Exec("DROP TABLE " + stmt.Schema.Table)
+		gormDB.Exec(strings.ReplaceAll(ddl, "timestamptz", "datetime"))
+		for _, index := range indexes {
+			gormDB.Exec(index)
+		}
+	}
+
+	db.GormDB = gormDB
+	return gormDB
+}
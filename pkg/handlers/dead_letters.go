@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/SergeyMilch/pay_aware/internal/deadletter"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetDeadLetters возвращает сообщения из DLQ, новые первыми.
+// ?topic= -- только из этого топика, ?pending=true -- только ещё не отправленные повторно.
+func GetDeadLetters(c *gin.Context) {
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 || parsed > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+			return
+		}
+		limit = parsed
+	}
+
+	query := db.GormDB.Order("id desc").Limit(limit)
+	if topic := c.Query("topic"); topic != "" {
+		query = query.Where("topic = ?", topic)
+	}
+	if c.Query("pending") == "true" {
+		query = query.Where("replayed_at IS NULL")
+	}
+
+	var letters []models.DeadLetter
+	if err := query.Find(&letters).Error; err != nil {
+		logger.Error("Failed to get dead letters", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get dead letters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, letters)
+}
+
+// GetDeadLetter возвращает сообщение из DLQ с исходными данными и ошибкой
+func GetDeadLetter(c *gin.Context) {
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+
+	var letter models.DeadLetter
+	if err := db.GormDB.First(&letter, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+			return
+		}
+		logger.Error("Failed to retrieve dead letter", "deadLetterID", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dead letter"})
+		return
+	}
+
+	c.JSON(http.StatusOK, letter)
+}
+
+// ReplayDeadLetter отправляет сообщение из DLQ в исходный топик заново
+func ReplayDeadLetter(c *gin.Context) {
+	id, ok := parseDeadLetterID(c)
+	if !ok {
+		return
+	}
+
+	letter, err := deadletter.Replay(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+			return
+		}
+		logger.Error("Failed to replay dead letter", "deadLetterID", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay dead letter"})
+		return
+	}
+
+	c.JSON(http.StatusOK, letter)
+}
+
+// parseDeadLetterID разбирает URL-параметр :id. При ошибке сам пишет ответ.
+func parseDeadLetterID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dead letter ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
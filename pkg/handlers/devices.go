@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// GetDevices возвращает устройства пользователя, на которые приходят push-уведомления
+func GetDevices(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var devices []models.Device
+	if err := db.GormDB.Where("user_id = ?", userIDInt).Order("last_seen_at DESC").Find(&devices).Error; err != nil {
+		logger.Error("Failed to load devices", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to load devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// DeleteDevice отвязывает устройство (например, потерянный телефон) -- уведомления на него больше не приходят
+func DeleteDevice(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	deviceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || deviceID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+
+	result := db.GormDB.Unscoped().Where("id = ? AND user_id = ?", deviceID, userIDInt).Delete(&models.Device{})
+	if result.Error != nil {
+		logger.Error("Failed to delete device", "userID", userIDInt, "deviceID", deviceID, "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete device"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	recordAuditEvent(c, userIDInt, "device.deleted")
+	logger.Info("Device deleted", "userID", userIDInt, "deviceID", deviceID)
+	c.JSON(http.StatusOK, gin.H{"message": "Device deleted successfully"})
+}
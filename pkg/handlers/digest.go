@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/auth"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// UnsubscribeDigest выключает email-сводку по ссылке из письма.
+// GET -- переход по ссылке, POST -- отписка в один клик из почтового клиента (List-Unsubscribe-Post).
+func UnsubscribeDigest(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing token"})
+		return
+	}
+
+	userID, err := auth.ValidateUnsubscribeToken(token, os.Getenv("JWT_SECRET"))
+	if err != nil {
+		logger.Warn("Invalid digest unsubscribe token", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+
+	if err := db.GormDB.Model(&models.NotificationPreference{}).
+		Where("user_id = ?", userID).
+		Update("digest_frequency", "").Error; err != nil {
+		logger.Error("Failed to unsubscribe from digest", "userID", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe"})
+		return
+	}
+	recordAuditEvent(c, userID, "digest.unsubscribed")
+
+	var user models.User
+	db.GormDB.Select("locale").First(&user, userID)
+
+	logger.Info("User unsubscribed from digest", "userID", userID)
+	c.JSON(http.StatusOK, gin.H{"message": i18n.T(user.Locale, "digest.unsubscribed", nil)})
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/SergeyMilch/pay_aware/internal/config"
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
 	"github.com/SergeyMilch/pay_aware/internal/logger"
 	"github.com/SergeyMilch/pay_aware/pkg/auth"
 	"github.com/SergeyMilch/pay_aware/pkg/db"
@@ -45,9 +46,9 @@ func ForgotPassword(c *gin.Context) {
 
   // Отправляем email с ссылкой для сброса пароля
   resetLink := fmt.Sprintf("%s/reset-password?token=%s", os.Getenv("RESET_PASSWORD_URL"), token)
-    emailBody := fmt.Sprintf(`<p>Чтобы сбросить ваш пароль, нажмите на следующую ссылку:</p><a href="%s">Сбросить пароль</a>`, resetLink)
+    emailBody := i18n.T(user.Locale, "password_reset.body", map[string]interface{}{"Link": resetLink})
 
-    err = utils.SendEmail(user.Email, "Password Reset Request", emailBody)
+    err = utils.SendEmail(user.Email, i18n.T(user.Locale, "password_reset.subject", nil), emailBody)
     if err != nil {
         logger.Error("Failed to send reset email", "error", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send reset email"})
@@ -103,6 +104,8 @@ func ResetPassword(c *gin.Context) {
         return
     }
 
+    recordAuditEvent(c, userID, "user.password_reset")
+
     // Успешный ответ
     logger.Info("Password reset successful for user", "userID", userID)
     c.JSON(http.StatusOK, gin.H{
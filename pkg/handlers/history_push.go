@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/realtime"
 	"github.com/SergeyMilch/pay_aware/pkg/db"
 	"github.com/SergeyMilch/pay_aware/pkg/models"
 	"github.com/gin-gonic/gin"
@@ -31,6 +33,7 @@ func GetUserNotifications(c *gin.Context) {
 	// Извлекаем параметры пагинации из запроса
 	limitStr := c.Query("limit")
 	offsetStr := c.Query("offset")
+	cursorStr := c.Query("cursor")
 
 	limit := 20 // Значение по умолчанию
 	offset := 0
@@ -44,6 +47,9 @@ func GetUserNotifications(c *gin.Context) {
 			return
 		}
 	}
+	if limit > maxNotificationsPageSize {
+		limit = maxNotificationsPageSize
+	}
 
 	if offsetStr != "" {
 		offset, err = strconv.Atoi(offsetStr)
@@ -54,19 +60,46 @@ func GetUserNotifications(c *gin.Context) {
 		}
 	}
 
-	var notifications []models.Notification
-	// Выполняем запрос с предзагрузкой подписки
-	if err := db.GormDB.Preload("Subscription").
-		Where("user_id = ?", userID).
+	filter, err := parseNotificationFilter(c)
+	if err != nil {
+		logger.Warn("Invalid notification filter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Сортируем по sent_at и id, чтобы порядок был однозначным при одинаковом времени отправки
+	query := filter.apply(db.GormDB.Preload("Subscription").Where("user_id = ?", userID)).
 		Order("sent_at desc").
-		Limit(limit).
-		Offset(offset).
-		Find(&notifications).Error; err != nil {
+		Order("id desc")
+
+	if cursorStr != "" {
+		if offset != 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor and offset cannot be combined"})
+			return
+		}
+		cursorSentAt, cursorID, err := decodeNotificationCursor(cursorStr)
+		if err != nil {
+			logger.Warn("Invalid notification cursor", "cursor", cursorStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor parameter"})
+			return
+		}
+		query = query.Where("sent_at < ? OR (sent_at = ? AND id < ?)", cursorSentAt, cursorSentAt, cursorID)
+	}
+
+	var notifications []models.Notification
+	// Берём на одну запись больше, чтобы понять, есть ли следующая страница
+	if err := query.Limit(limit + 1).Offset(offset).Find(&notifications).Error; err != nil {
 		logger.Error("Ошибка при получении уведомлений:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
 		return
 	}
 
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[len(notifications)-1]
+		c.Header("X-Next-Cursor", encodeNotificationCursor(last.SentAt, last.ID))
+	}
+
 	c.JSON(http.StatusOK, notifications)
 }
 
@@ -120,6 +153,7 @@ func MarkNotificationAsRead(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
 		return
 	}
+	realtime.PublishUnreadCount(context.Background(), notification.UserID)
 
 	c.JSON(http.StatusOK, notification)
-}
\ No newline at end of file
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/auth"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/SergeyMilch/pay_aware/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Варианты "отложить" для кнопок уведомления
+const (
+	snoozeOneHour         = "1h"
+	snoozeOneDay          = "1d"
+	snoozeTomorrowMorning = "tomorrow_morning"
+
+	snoozeMorningHour = 9                   // "Завтра утром" -- 09:00 по времени пользователя
+	maxSnoozeDuration = 30 * 24 * time.Hour // Дальше откладывать нет смысла -- придёт напоминание о следующем платеже
+)
+
+var errInvalidSnooze = errors.New("invalid snooze")
+
+// notificationActionRequest -- нажатие кнопки в уведомлении
+type notificationActionRequest struct {
+	ActionToken string     `json:"action_token"` // Токен из данных уведомления (можно передать в заголовке X-Action-Token)
+	Action      string     `json:"action"`       // "paid", "snooze" или "skip"
+	Snooze      string     `json:"snooze"`       // "1h", "1d" (по умолчанию) или "tomorrow_morning"
+	Until       *time.Time `json:"until"`        // Точное время повтора вместо Snooze
+}
+
+// ApplyNotificationAction применяет действие из уведомления: отметить оплату, отложить или пропустить напоминание.
+// Запрос авторизуется подписанным токеном из push-уведомления, поэтому работает и без открытия приложения.
+func ApplyNotificationAction(c *gin.Context) {
+	notificationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || notificationID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	var request notificationActionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Warn("Invalid notification action request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if request.ActionToken == "" {
+		request.ActionToken = c.GetHeader("X-Action-Token")
+	}
+
+	userID, tokenNotificationID, err := auth.ValidateActionToken(request.ActionToken, os.Getenv("JWT_SECRET"))
+	if err != nil || tokenNotificationID != uint(notificationID) {
+		logger.Warn("Invalid notification action token", "notificationID", notificationID, "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired action token"})
+		return
+	}
+
+	var notification models.Notification
+	if err := db.GormDB.Where("id = ? AND user_id = ?", notificationID, userID).First(&notification).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			return
+		}
+		logger.Error("Failed to load notification for action", "notificationID", notificationID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var until time.Time
+	switch request.Action {
+	case reminderActionPaid, reminderActionSkip:
+	case reminderActionSnooze:
+		var user models.User
+		if err := db.GormDB.First(&user, userID).Error; err != nil {
+			logger.Warn("User not found for notification action", "userID", userID)
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		until, err = snoozeUntil(request.Snooze, request.Until, utils.LoadUserLocation(user.TimeZone), time.Now().UTC())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Snooze must be 1h, 1d, tomorrow_morning or a future time within 30 days"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Action must be one of: paid, snooze, skip"})
+		return
+	}
+
+	if err := applyReminderAction(userID, notification.SubscriptionID, notification.ID, request.Action, until); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+			return
+		}
+		logger.Error("Failed to apply notification action", "notificationID", notificationID, "action", request.Action, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to apply action"})
+		return
+	}
+
+	recordAuditEvent(c, userID, "reminder."+request.Action)
+
+	response := gin.H{"message": "Action applied successfully", "action": request.Action}
+	if request.Action == reminderActionSnooze {
+		response["snoozed_until"] = until
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// snoozeUntil вычисляет время повтора напоминания по выбранному варианту или точному времени
+func snoozeUntil(preset string, until *time.Time, loc *time.Location, now time.Time) (time.Time, error) {
+	if until != nil {
+		if !until.After(now) || until.Sub(now) > maxSnoozeDuration {
+			return time.Time{}, errInvalidSnooze
+		}
+		return until.UTC(), nil
+	}
+
+	switch preset {
+	case snoozeOneHour:
+		return now.Add(time.Hour), nil
+	case snoozeOneDay, "":
+		return now.Add(24 * time.Hour), nil
+	case snoozeTomorrowMorning:
+		return utils.TomorrowAt(now, loc, snoozeMorningHour, 0), nil
+	default:
+		return time.Time{}, errInvalidSnooze
+	}
+}
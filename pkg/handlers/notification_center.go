@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/realtime"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxNotificationsPageSize   = 100 // Максимальный размер страницы истории уведомлений
+	maxNotificationsBulkDelete = 500 // Максимум уведомлений в одном запросе на удаление
+)
+
+// Фильтр по статусу прочтения
+const (
+	notificationStatusRead   = "read"
+	notificationStatusUnread = "unread"
+)
+
+// notificationFilter -- фильтры истории уведомлений из query-параметров
+type notificationFilter struct {
+	Status         string     // "read" или "unread"
+	SubscriptionID int        // 0 -- все подписки
+	From           *time.Time // Нижняя граница sent_at (включительно)
+	To             *time.Time // Верхняя граница sent_at (не включительно)
+}
+
+// parseNotificationFilter разбирает параметры status, subscription_id, from и to (RFC 3339)
+func parseNotificationFilter(c *gin.Context) (notificationFilter, error) {
+	var filter notificationFilter
+
+	switch status := c.Query("status"); status {
+	case "", notificationStatusRead, notificationStatusUnread:
+		filter.Status = status
+	default:
+		return filter, fmt.Errorf("invalid status parameter: %s", status)
+	}
+
+	if value := c.Query("subscription_id"); value != "" {
+		subscriptionID, err := strconv.Atoi(value)
+		if err != nil || subscriptionID <= 0 {
+			return filter, errors.New("invalid subscription_id parameter")
+		}
+		filter.SubscriptionID = subscriptionID
+	}
+
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s parameter, expected RFC 3339", param.name)
+		}
+		parsed = parsed.UTC()
+		*param.target = &parsed
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, errors.New("from must be before to")
+	}
+
+	return filter, nil
+}
+
+// apply добавляет условия фильтра к запросу по таблице notifications.
+// Неотправленные уведомления в историю, счётчик и отметку прочитанными не попадают.
+func (f notificationFilter) apply(query *gorm.DB) *gorm.DB {
+	query = query.Scopes(models.VisibleNotifications)
+	switch f.Status {
+	case notificationStatusRead:
+		query = query.Where("read_at IS NOT NULL")
+	case notificationStatusUnread:
+		query = query.Where("read_at IS NULL")
+	}
+	if f.SubscriptionID != 0 {
+		query = query.Where("subscription_id = ?", f.SubscriptionID)
+	}
+	if f.From != nil {
+		query = query.Where("sent_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("sent_at < ?", *f.To)
+	}
+	return query
+}
+
+// encodeNotificationCursor кодирует позицию последнего уведомления страницы: "<sent_at в нс>:<id>"
+func encodeNotificationCursor(sentAt time.Time, id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", sentAt.UnixNano(), id)))
+}
+
+// decodeNotificationCursor разбирает курсор, выданный в заголовке X-Next-Cursor
+func decodeNotificationCursor(cursor string) (time.Time, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	sentAtStr, idStr, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, 0, errors.New("malformed cursor")
+	}
+	sentAtNano, err := strconv.ParseInt(sentAtStr, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return time.Unix(0, sentAtNano).UTC(), uint(id), nil
+}
+
+// GetUnreadNotificationsCount возвращает число непрочитанных уведомлений (для бейджа в приложении).
+// Поддерживает фильтры subscription_id, from и to.
+func GetUnreadNotificationsCount(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	filter, err := parseNotificationFilter(c)
+	if err != nil {
+		logger.Warn("Invalid notification filter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Status = notificationStatusUnread
+
+	var count int64
+	if err := filter.apply(db.GormDB.Model(&models.Notification{}).Where("user_id = ?", userIDInt)).
+		Count(&count).Error; err != nil {
+		logger.Error("Failed to count unread notifications", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread_count": count})
+}
+
+// MarkAllNotificationsAsRead отмечает прочитанными все непрочитанные уведомления пользователя.
+// Фильтры subscription_id, from и to ограничивают, какие именно.
+func MarkAllNotificationsAsRead(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	filter, err := parseNotificationFilter(c)
+	if err != nil {
+		logger.Warn("Invalid notification filter", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Status = notificationStatusUnread
+
+	result := filter.apply(db.GormDB.Model(&models.Notification{}).Where("user_id = ?", userIDInt)).
+		Update("read_at", time.Now().UTC())
+	if result.Error != nil {
+		logger.Error("Failed to mark notifications as read", "userID", userIDInt, "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+
+	logger.Debug("Notifications marked as read", "userID", userIDInt, "count", result.RowsAffected)
+	realtime.PublishUnreadCount(context.Background(), userIDInt)
+	c.JSON(http.StatusOK, gin.H{"updated": result.RowsAffected})
+}
+
+// deleteNotificationsRequest -- тело запроса на удаление уведомлений из истории
+type deleteNotificationsRequest struct {
+	IDs []uint `json:"ids" binding:"required"`
+}
+
+// DeleteNotifications удаляет из истории уведомления с указанными ID. Чужие ID молча пропускаются.
+func DeleteNotifications(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var request deleteNotificationsRequest
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.IDs) == 0 {
+		logger.Warn("Invalid delete notifications request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if len(request.IDs) > maxNotificationsBulkDelete {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Too many IDs, maximum is %d", maxNotificationsBulkDelete)})
+		return
+	}
+
+	result := db.GormDB.Where("user_id = ? AND id IN ?", userIDInt, request.IDs).Delete(&models.Notification{})
+	if result.Error != nil {
+		logger.Error("Failed to delete notifications", "userID", userIDInt, "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notifications"})
+		return
+	}
+
+	logger.Debug("Notifications deleted", "userID", userIDInt, "count", result.RowsAffected)
+	realtime.PublishUnreadCount(context.Background(), userIDInt)
+	c.JSON(http.StatusOK, gin.H{"deleted": result.RowsAffected})
+}
+
+// DeleteNotification удаляет одно уведомление из истории
+func DeleteNotification(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	notificationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || notificationID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	result := db.GormDB.Where("id = ? AND user_id = ?", notificationID, userIDInt).Delete(&models.Notification{})
+	if result.Error != nil {
+		logger.Error("Failed to delete notification", "notificationID", notificationID, "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	logger.Debug("Notification deleted", "userID", userIDInt, "notificationID", notificationID)
+	realtime.PublishUnreadCount(context.Background(), userIDInt)
+	c.JSON(http.StatusOK, gin.H{"message": "Notification deleted"})
+}
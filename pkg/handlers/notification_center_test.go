@@ -0,0 +1,180 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/handlers"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// initNotificationCenter создаёт чистую базу с историей уведомлений и роутер от имени пользователя 1
+func initNotificationCenter(t *testing.T) *gin.Engine {
+	setupTestDB(t, &models.Subscription{}, &models.Notification{})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("userID", 1) })
+	router.GET("/api/notifications", handlers.GetUserNotifications)
+	router.GET("/api/notifications/unread-count", handlers.GetUnreadNotificationsCount)
+	router.POST("/api/notifications/read-all", handlers.MarkAllNotificationsAsRead)
+	router.DELETE("/api/notifications", handlers.DeleteNotifications)
+	return router
+}
+
+// createNotification добавляет уведомление в историю
+func createNotification(t *testing.T, userID, subscriptionID int, sentAt time.Time, read bool) models.Notification {
+	notification := models.Notification{UserID: userID, SubscriptionID: subscriptionID, SentAt: sentAt}
+	if read {
+		notification.ReadAt = &sentAt
+	}
+	assert.NoError(t, db.GormDB.Create(&notification).Error)
+	return notification
+}
+
+// listNotifications запрашивает страницу истории и возвращает ID уведомлений и курсор следующей страницы
+func listNotifications(t *testing.T, router *gin.Engine, query url.Values) ([]uint, string) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/notifications?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var notifications []models.Notification
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &notifications))
+	ids := make([]uint, 0, len(notifications))
+	for _, notification := range notifications {
+		ids = append(ids, notification.ID)
+	}
+	return ids, w.Header().Get("X-Next-Cursor")
+}
+
+func TestGetUserNotificationsCursorPagination(t *testing.T) {
+	router := initNotificationCenter(t)
+
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	oldest := createNotification(t, 1, 0, base, false)
+	tieA := createNotification(t, 1, 0, base.Add(time.Hour), false)
+	tieB := createNotification(t, 1, 0, base.Add(time.Hour), false) // То же время отправки
+	newest := createNotification(t, 1, 0, base.Add(2*time.Hour), false)
+	createNotification(t, 2, 0, base.Add(3*time.Hour), false) // Чужое уведомление
+
+	ids, cursor := listNotifications(t, router, url.Values{"limit": {"2"}})
+	assert.Equal(t, []uint{newest.ID, tieB.ID}, ids)
+	assert.NotEmpty(t, cursor)
+
+	// Новое уведомление между страницами не сдвигает следующую страницу
+	createNotification(t, 1, 0, base.Add(4*time.Hour), false)
+
+	ids, cursor = listNotifications(t, router, url.Values{"limit": {"2"}, "cursor": {cursor}})
+	assert.Equal(t, []uint{tieA.ID, oldest.ID}, ids)
+	assert.Empty(t, cursor)
+}
+
+func TestGetUserNotificationsFilters(t *testing.T) {
+	router := initNotificationCenter(t)
+
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	unreadMusic := createNotification(t, 1, 7, base, false)
+	readMusic := createNotification(t, 1, 7, base.Add(24*time.Hour), true)
+	unreadCloud := createNotification(t, 1, 8, base.Add(48*time.Hour), false)
+
+	ids, _ := listNotifications(t, router, url.Values{"status": {"unread"}})
+	assert.Equal(t, []uint{unreadCloud.ID, unreadMusic.ID}, ids)
+
+	ids, _ = listNotifications(t, router, url.Values{"subscription_id": {"7"}})
+	assert.Equal(t, []uint{readMusic.ID, unreadMusic.ID}, ids)
+
+	ids, _ = listNotifications(t, router, url.Values{
+		"from": {base.Add(time.Hour).Format(time.RFC3339)},
+		"to":   {base.Add(48 * time.Hour).Format(time.RFC3339)},
+	})
+	assert.Equal(t, []uint{readMusic.ID}, ids)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/notifications?status=archived", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUnreadCountAndReadAll(t *testing.T) {
+	router := initNotificationCenter(t)
+
+	now := time.Now().UTC()
+	createNotification(t, 1, 7, now, false)
+	createNotification(t, 1, 8, now, false)
+	createNotification(t, 1, 8, now, true)
+	createNotification(t, 2, 9, now, false)
+
+	unreadCount := func() int64 {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/notifications/unread-count", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			UnreadCount int64 `json:"unread_count"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.UnreadCount
+	}
+	assert.Equal(t, int64(2), unreadCount())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/notifications/read-all?subscription_id=7", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(1), unreadCount())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/notifications/read-all", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(0), unreadCount())
+
+	// Уведомления другого пользователя не затронуты
+	var foreignUnread int64
+	db.GormDB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", 2).Count(&foreignUnread)
+	assert.Equal(t, int64(1), foreignUnread)
+}
+
+func TestDeleteNotificationsSkipsForeignIDs(t *testing.T) {
+	router := initNotificationCenter(t)
+
+	now := time.Now().UTC()
+	own := createNotification(t, 1, 0, now, false)
+	kept := createNotification(t, 1, 0, now, false)
+	foreign := createNotification(t, 2, 0, now, false)
+
+	body, _ := json.Marshal(map[string][]uint{"ids": {own.ID, foreign.ID}})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/api/notifications", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted": 1}`, w.Body.String())
+
+	var remaining []uint
+	db.GormDB.Model(&models.Notification{}).Order("id").Pluck("id", &remaining)
+	assert.Equal(t, []uint{kept.ID, foreign.ID}, remaining)
+}
+
+func TestUnsentNotificationsAreHidden(t *testing.T) {
+	router := initNotificationCenter(t)
+
+	now := time.Now().UTC()
+	sent := createNotification(t, 1, 7, now, false)
+	// Напоминания, которые ещё отправляются или не дошли, пользователь не видит
+	for _, status := range []string{"sending", "failed"} {
+		notification := models.Notification{UserID: 1, SubscriptionID: 7, SentAt: now, Status: status}
+		assert.NoError(t, db.GormDB.Create(&notification).Error)
+	}
+
+	ids, _ := listNotifications(t, router, url.Values{})
+	assert.Equal(t, []uint{sent.ID}, ids)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/notifications/unread-count", nil))
+	assert.JSONEq(t, `{"unread_count": 1}`, w.Body.String())
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// notificationPreferencesRequest -- тело запроса на изменение настроек уведомлений
+type notificationPreferencesRequest struct {
+	EnabledChannels      *[]string           `json:"enabled_channels"` // nil -- поле не передано
+	EventChannels        map[string][]string `json:"event_channels"`
+	HighPriorityChannels []string            `json:"high_priority_channels"`
+	QuietHoursStart      string              `json:"quiet_hours_start"`
+	QuietHoursEnd        string              `json:"quiet_hours_end"`
+	DigestFrequency      string              `json:"digest_frequency"`
+}
+
+// GetNotificationPreferences возвращает действующие настройки уведомлений
+// (значения по умолчанию, если пользователь их ещё не менял)
+func GetNotificationPreferences(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var user models.User
+	if err := db.GormDB.First(&user, userIDInt).Error; err != nil {
+		logger.Info("User not found for notification preferences", "userID", userIDInt)
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	prefs, err := notifier.LoadPreferences(userIDInt)
+	if err != nil {
+		logger.Error("Failed to load notification preferences", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notification preferences"})
+		return
+	}
+	if prefs == nil {
+		defaults := notifier.DefaultPreferences(user)
+		prefs = &defaults
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"preferences":        prefs,
+		"available_channels": notifier.RoutableChannels(),
+		"events":             notifier.RoutableEvents,
+	})
+}
+
+// UpdateNotificationPreferences сохраняет настройки уведомлений целиком
+func UpdateNotificationPreferences(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var request notificationPreferencesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Warn("Invalid notification preferences request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	prefs, err := notifier.LoadPreferences(userIDInt)
+	if err != nil {
+		logger.Error("Failed to load notification preferences", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+		return
+	}
+	if prefs == nil {
+		prefs = &models.NotificationPreference{UserID: userIDInt}
+	}
+
+	// Если поле не передано, сохраняем nil -- "все каналы". Явный [] сохраняем как пустой список:
+	// пользователь выключил все каналы.
+	prefs.EnabledChannels = nil
+	if request.EnabledChannels != nil {
+		prefs.EnabledChannels = *request.EnabledChannels
+		if prefs.EnabledChannels == nil {
+			prefs.EnabledChannels = []string{}
+		}
+	}
+	prefs.EventChannels = request.EventChannels
+	prefs.HighPriorityChannels = request.HighPriorityChannels
+	prefs.QuietHoursStart = request.QuietHoursStart
+	prefs.QuietHoursEnd = request.QuietHoursEnd
+	prefs.DigestFrequency = request.DigestFrequency
+
+	if err := notifier.ValidatePreferences(*prefs); err != nil {
+		logger.Warn("Invalid notification preferences", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.GormDB.Save(prefs).Error; err != nil {
+		logger.Error("Failed to save notification preferences", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+		return
+	}
+
+	logger.Debug("Notification preferences updated", "userID", userIDInt)
+	c.JSON(http.StatusOK, prefs)
+}
@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/handlers"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// initNotificationPreferences создаёт чистую базу настроек уведомлений и роутер от имени пользователя 1
+func initNotificationPreferences(t *testing.T) *gin.Engine {
+	setupTestDB(t, &models.NotificationPreference{})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("userID", 1) })
+	router.PUT("/api/users/me/notification-preferences", handlers.UpdateNotificationPreferences)
+	return router
+}
+
+// putPreferences отправляет настройки и возвращает сохранённую запись
+func putPreferences(t *testing.T, router *gin.Engine, body string) models.NotificationPreference {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/api/users/me/notification-preferences", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var prefs models.NotificationPreference
+	assert.NoError(t, db.GormDB.Where("user_id = ?", 1).First(&prefs).Error)
+	return prefs
+}
+
+func TestUpdateNotificationPreferencesKeepsAllChannelsWhenOmitted(t *testing.T) {
+	router := initNotificationPreferences(t)
+
+	// Запрос меняет только частоту сводки: каналы не переданы и остаются "все включены"
+	prefs := putPreferences(t, router, `{"digest_frequency": "weekly"}`)
+	assert.Nil(t, prefs.EnabledChannels)
+	assert.Equal(t, "weekly", prefs.DigestFrequency)
+}
+
+func TestUpdateNotificationPreferencesStoresExplicitEmptyChannels(t *testing.T) {
+	router := initNotificationPreferences(t)
+
+	prefs := putPreferences(t, router, `{"enabled_channels": []}`)
+	assert.NotNil(t, prefs.EnabledChannels)
+	assert.Empty(t, prefs.EnabledChannels)
+
+	// Настройки сохраняются целиком: без поля снова действуют все каналы
+	prefs = putPreferences(t, router, `{"quiet_hours_start": "22:00", "quiet_hours_end": "08:00"}`)
+	assert.Nil(t, prefs.EnabledChannels)
+}
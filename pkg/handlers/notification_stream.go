@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/realtime"
+	"github.com/gin-gonic/gin"
+)
+
+// sseHeartbeatInterval -- как часто отправлять комментарий-пинг, чтобы прокси не закрывали простаивающее соединение
+const sseHeartbeatInterval = 25 * time.Second
+
+// StreamNotifications держит открытым поток Server-Sent Events с событиями пользователя:
+// новые уведомления, изменения подписок и число непрочитанных. Заменяет опрос /api/notifications.
+func StreamNotifications(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Подписываемся до чтения счётчика, чтобы не пропустить изменения между ними
+	events, unsubscribe := realtime.Subscribe(userIDInt)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Отключаем буферизацию ответа в nginx
+
+	// Сразу отдаём текущее число непрочитанных: клиенту не нужен отдельный запрос
+	if count, err := realtime.UnreadCount(userIDInt); err != nil {
+		logger.Warn("Failed to count unread notifications", "userID", userIDInt, "error", err)
+	} else {
+		c.SSEvent(realtime.EventUnreadCount, gin.H{"unread_count": count})
+	}
+	c.Writer.Flush()
+
+	logger.Debug("Notification stream opened", "userID", userIDInt)
+	defer logger.Debug("Notification stream closed", "userID", userIDInt)
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event.Data)
+			return true
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			return true
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/internal/realtime"
+	"github.com/SergeyMilch/pay_aware/internal/reminderqueue"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"gorm.io/gorm"
+)
+
+// Действия пользователя над полученным напоминанием
+const (
+	reminderActionPaid   = notifier.ActionPaid
+	reminderActionSnooze = notifier.ActionSnooze
+	reminderActionSkip   = notifier.ActionSkip
+)
+
+var errUnknownReminderAction = errors.New("unknown reminder action")
+
+// applyReminderAction применяет действие пользователя к напоминанию по подписке:
+// "paid" отмечает напоминание оплаченным, "snooze" откладывает повтор до until,
+// "skip" отмечает напоминание прочитанным и отменяет отложенный повтор.
+// notificationID указывает конкретное напоминание, 0 -- последнее по подписке.
+// Дата следующего платежа при этом не меняется.
+func applyReminderAction(userID, subscriptionID int, notificationID uint, action string, until time.Time) error {
+	var subscription models.Subscription
+	if err := db.GormDB.Where("id = ? AND user_id = ?", subscriptionID, userID).First(&subscription).Error; err != nil {
+		return err
+	}
+
+	switch action {
+	case reminderActionPaid:
+		now := time.Now().UTC()
+
+		notification, err := findReminderNotification(userID, subscriptionID, notificationID, "paid_at IS NULL")
+		if err == nil {
+			updates := map[string]interface{}{"paid_at": now}
+			if notification.ReadAt == nil {
+				updates["read_at"] = now
+			}
+			if err := db.GormDB.Model(&notification).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to mark notification as paid: %w", err)
+			}
+		} else {
+			logger.Debug("No unpaid notification found for subscription", "subscriptionID", subscriptionID, "error", err)
+		}
+
+		// Оплаченное напоминание повторять не нужно
+		if err := clearSnooze(subscription); err != nil {
+			return err
+		}
+
+	case reminderActionSnooze:
+		snoozedUntil := until.UTC()
+		if err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&subscription).Update("snoozed_until", &snoozedUntil).Error; err != nil {
+				return err
+			}
+			return reminderqueue.Enqueue(tx, subscription.ID, reminderqueue.KindSnooze, reminderqueue.WithJitter(snoozedUntil))
+		}); err != nil {
+			return fmt.Errorf("failed to snooze reminder: %w", err)
+		}
+
+	case reminderActionSkip:
+		notification, err := findReminderNotification(userID, subscriptionID, notificationID, "read_at IS NULL")
+		if err == nil {
+			if err := db.GormDB.Model(&notification).Update("read_at", time.Now().UTC()).Error; err != nil {
+				return fmt.Errorf("failed to mark notification as read: %w", err)
+			}
+		} else {
+			logger.Debug("No unread notification found for subscription", "subscriptionID", subscriptionID, "error", err)
+		}
+
+		// Пропущенное напоминание до следующего платежа больше не повторяется
+		if err := clearSnooze(subscription); err != nil {
+			return err
+		}
+
+	default:
+		return errUnknownReminderAction
+	}
+
+	// Удаляем кэш подписок пользователя, чтобы фронт увидел актуальное состояние
+	redisKey := fmt.Sprintf("subscriptions:user:%d", userID)
+	db.RedisClient.Del(context.Background(), redisKey)
+
+	// Другие устройства пользователя сразу видят отметку и новый счётчик непрочитанных
+	db.GormDB.First(&subscription, subscription.ID)
+	realtime.PublishSubscriptionChanged(context.Background(), userID, realtime.SubscriptionUpdated, subscription)
+	realtime.PublishUnreadCount(context.Background(), userID)
+
+	logger.Info("Reminder action applied", "userID", userID, "subscriptionID", subscriptionID, "action", action)
+	return nil
+}
+
+// clearSnooze отменяет отложенный повтор напоминания и снимает его с очереди
+func clearSnooze(subscription models.Subscription) error {
+	if err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&subscription).Update("snoozed_until", nil).Error; err != nil {
+			return err
+		}
+		return reminderqueue.Cancel(tx, subscription.ID, reminderqueue.KindSnooze)
+	}); err != nil {
+		return fmt.Errorf("failed to clear snooze: %w", err)
+	}
+	return nil
+}
+
+// findReminderNotification возвращает напоминание notificationID или, если он не задан,
+// последнее напоминание по подписке, удовлетворяющее condition
+func findReminderNotification(userID, subscriptionID int, notificationID uint, condition string) (models.Notification, error) {
+	var notification models.Notification
+	query := db.GormDB.Where("user_id = ? AND subscription_id = ?", userID, subscriptionID)
+	if notificationID != 0 {
+		err := query.Where("id = ? AND "+condition, notificationID).First(&notification).Error
+		return notification, err
+	}
+	err := query.Where(condition).Order("sent_at desc").First(&notification).Error
+	return notification, err
+}
@@ -11,6 +11,10 @@ import (
 	"unicode/utf8"
 
 	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/internal/realtime"
+	"github.com/SergeyMilch/pay_aware/internal/reminderqueue"
+	"github.com/SergeyMilch/pay_aware/internal/webhook"
 	"github.com/SergeyMilch/pay_aware/pkg/db"
 	"github.com/SergeyMilch/pay_aware/pkg/models"
 	"github.com/SergeyMilch/pay_aware/pkg/utils"
@@ -58,6 +62,12 @@ func CreateSubscription(c *gin.Context) {
 		return
 	}
 
+    // Каналы подписки переопределяют настройки пользователя, поэтому должны быть известными
+    if err := notifier.ValidateChannels(subscription.NotificationChannels); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
     // Здесь можно проверить обязательные поля, например:
     // - ServiceName не должен быть пустым
     // - NextPaymentDate не должен быть нулевым временем
@@ -97,8 +107,13 @@ func CreateSubscription(c *gin.Context) {
         subscription.NotificationDate = subscription.NextPaymentDate
     }
 
-    // Создание подписки в базе данных
-    if err := db.GormDB.Create(&subscription).Error; err != nil {
+    // Создание подписки в базе данных вместе с задачей напоминания в очереди
+    if err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(&subscription).Error; err != nil {
+            return err
+        }
+        return reminderqueue.Schedule(tx, subscription)
+    }); err != nil {
         logger.Error("Failed to create subscription", "userID", userIDInt, "error", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
         return
@@ -111,6 +126,9 @@ func CreateSubscription(c *gin.Context) {
 
     logger.Debug("Subscription created successfully", "subscriptionID", subscription.ID, "userID", subscription.UserID)
 
+    notifier.PublishWebhookEvent(context.Background(), userIDInt, webhook.EventSubscriptionCreated, webhook.SubscriptionData(subscription))
+    realtime.PublishSubscriptionChanged(context.Background(), userIDInt, realtime.SubscriptionCreated, subscription)
+
     // Возвращаем всю структуру подписки
     c.JSON(http.StatusOK, subscription)
 }
@@ -176,6 +194,11 @@ func UpdateSubscription(c *gin.Context) {
 		return
 	}
 
+    if err := notifier.ValidateChannels(updatedData.NotificationChannels); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
     // Обновляем поля existingSubscription (объект, который взяли из БД) новыми значениями
     // Поле existingSubscription.ID при этом останется прежним, то есть мы меняем только данные
     // (ServiceName, Cost, NextPaymentDate, NotificationOffset и RecurrenceType).
@@ -189,6 +212,8 @@ func UpdateSubscription(c *gin.Context) {
     existingSubscription.RecurrenceType = updatedData.RecurrenceType
     existingSubscription.Tag = updatedData.Tag // <-- обновляем тег
     existingSubscription.HighPriority = updatedData.HighPriority // Обновляем поле заметности
+    existingSubscription.NotificationChannels = updatedData.NotificationChannels // Каналы только для этой подписки (пусто -- по настройкам пользователя)
+    existingSubscription.SnoozedUntil = nil // После ручного изменения отложенный повтор теряет смысл
 
     // Пересчитываем дату и время уведомления
     if existingSubscription.NotificationOffset > 0 {
@@ -199,7 +224,14 @@ func UpdateSubscription(c *gin.Context) {
         existingSubscription.NotificationDate = existingSubscription.NextPaymentDate
     }
 
-    if err := db.GormDB.Save(&existingSubscription).Error; err != nil {
+    // Задача напоминания в очереди переносится на новую дату (отложенный повтор снимается).
+    // Напоминание на новую дату уйдёт, даже если за старую уже отправлено: у него свой ключ идемпотентности
+    if err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(&existingSubscription).Error; err != nil {
+            return err
+        }
+        return reminderqueue.Schedule(tx, existingSubscription)
+    }); err != nil {
         logger.Error("Failed to update subscription", "id", existingSubscription.ID, "error", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription"})
         return
@@ -212,15 +244,11 @@ func UpdateSubscription(c *gin.Context) {
     db.RedisClient.Del(context.Background(), redisKey)
     logger.Debug("Deleted subscriptions cache after updating a subscription", "userID", userIDInt)
 
-    // Также удаляем кэш уведомления (notification_sent:subscription:ID), 
-    // ведь если юзер меняет дату вручную, мы, возможно, захотим переслать уведомление заново
-    // Удаляем кэш уведомления для данной подписки после обновления
-    notificationCacheKey := fmt.Sprintf("notification_sent:subscription:%d", existingSubscription.ID)
-    db.RedisClient.Del(context.Background(), notificationCacheKey)
-    logger.Debug("Deleted notification cache after updating a subscription", "subscriptionID", existingSubscription.ID)
-
     logger.Debug("Subscription updated successfully", "subscriptionID", existingSubscription.ID, "userID", userIDInt)
 
+    notifier.PublishWebhookEvent(context.Background(), userIDInt, webhook.EventSubscriptionUpdated, webhook.SubscriptionData(existingSubscription))
+    realtime.PublishSubscriptionChanged(context.Background(), userIDInt, realtime.SubscriptionUpdated, existingSubscription)
+
     // Возвращаем всю структуру подписки
     c.JSON(http.StatusOK, existingSubscription)
 }
@@ -265,8 +293,13 @@ func DeleteSubscription(c *gin.Context) {
         return
     }
 
-    // Удаление подписки
-    if err := db.GormDB.Delete(&subscription).Error; err != nil {
+    // Удаление подписки и её задач в очереди напоминаний
+    if err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Delete(&subscription).Error; err != nil {
+            return err
+        }
+        return reminderqueue.Cancel(tx, subscription.ID)
+    }); err != nil {
         logger.Error("Failed to delete subscription", "id", subscriptionID, "error", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete subscription"})
         return
@@ -279,6 +312,10 @@ func DeleteSubscription(c *gin.Context) {
 
     logger.Debug("Subscription deleted successfully", "subscriptionID", subscriptionID)
 
+    notifier.PublishWebhookEvent(context.Background(), userIDInt, webhook.EventSubscriptionDeleted, webhook.SubscriptionData(subscription))
+    realtime.PublishSubscriptionChanged(context.Background(), userIDInt, realtime.SubscriptionDeleted, subscription)
+    realtime.PublishUnreadCount(context.Background(), userIDInt) // Вместе с подпиской удалены её уведомления
+
     c.JSON(http.StatusOK, gin.H{"message": "Subscription deleted successfully"})
 }
 
@@ -30,17 +30,17 @@ func InitMockDB(t *testing.T) *gorm.DB {
 		t.Fatal("Failed to initialize mock database", err)
 	}
 
-	db.AutoMigrate(&models.User{}, &models.Subscription{})
+	db.AutoMigrate(&models.User{}, &models.Subscription{}, &models.ReminderJob{})
 	return db
 }
 
 // ClearMockDB очищает все таблицы базы данных для тестирования
 func ClearMockDB(t *testing.T, db *gorm.DB) {
-	err := db.Migrator().DropTable(&models.User{}, &models.Subscription{})
+	err := db.Migrator().DropTable(&models.User{}, &models.Subscription{}, &models.ReminderJob{})
 	if err != nil {
 		t.Fatal("Failed to clear mock database:", err)
 	}
-	db.AutoMigrate(&models.User{}, &models.Subscription{})
+	db.AutoMigrate(&models.User{}, &models.Subscription{}, &models.ReminderJob{})
 }
 
 // TestMain выполняет начальную настройку
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// telegramLinkCodeTTL -- время жизни одноразового кода привязки
+const telegramLinkCodeTTL = 10 * time.Minute
+
+// telegramLinkCodeAlphabet -- символы кода без похожих друг на друга (0/O, 1/I)
+const telegramLinkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// telegramUpdate -- интересующая нас часть Update из Telegram Bot API
+type telegramUpdate struct {
+	Message *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		From telegramUser `json:"from"`
+		Text string       `json:"text"`
+	} `json:"message"`
+	CallbackQuery *struct {
+		ID      string       `json:"id"`
+		Data    string       `json:"data"`
+		From    telegramUser `json:"from"`
+		Message *struct {
+			Chat struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+		} `json:"message"`
+	} `json:"callback_query"`
+}
+
+// telegramUser -- отправитель обновления; язык клиента Telegram используется, пока чат не привязан
+type telegramUser struct {
+	LanguageCode string `json:"language_code"`
+}
+
+// CreateTelegramLinkCode выдаёт одноразовый код, который пользователь отправляет боту для привязки чата
+func CreateTelegramLinkCode(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if notifier.Telegram() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Telegram notifications are not configured"})
+		return
+	}
+
+	code, err := generateTelegramLinkCode()
+	if err != nil {
+		logger.Error("Failed to generate telegram link code", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create link code"})
+		return
+	}
+
+	redisKey := fmt.Sprintf("telegram_link_code:%s", code)
+	if err := db.RedisClient.Set(context.Background(), redisKey, userIDInt, telegramLinkCodeTTL).Err(); err != nil {
+		logger.Error("Failed to store telegram link code", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create link code"})
+		return
+	}
+
+	response := gin.H{
+		"code":       code,
+		"expires_in": int(telegramLinkCodeTTL.Seconds()),
+	}
+	// Deep link открывает бота сразу с кодом в команде /start
+	if botUsername := os.Getenv("TELEGRAM_BOT_USERNAME"); botUsername != "" {
+		response["bot_url"] = fmt.Sprintf("https://t.me/%s?start=%s", botUsername, code)
+	}
+
+	logger.Debug("Telegram link code created", "userID", userIDInt)
+	c.JSON(http.StatusOK, response)
+}
+
+// UnlinkTelegram отвязывает Telegram-чат от аккаунта
+func UnlinkTelegram(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := db.GormDB.Model(&models.User{}).Where("id = ?", userIDInt).Update("telegram_chat_id", 0).Error; err != nil {
+		logger.Error("Failed to unlink telegram", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to unlink Telegram"})
+		return
+	}
+
+	logger.Info("Telegram unlinked", "userID", userIDInt)
+	c.JSON(http.StatusOK, gin.H{"message": "Telegram unlinked successfully"})
+}
+
+// TelegramWebhook принимает обновления от Telegram: коды привязки и нажатия inline-кнопок
+func TelegramWebhook(c *gin.Context) {
+	bot := notifier.Telegram()
+	secret := os.Getenv("TELEGRAM_WEBHOOK_SECRET")
+	if bot == nil || secret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+
+	providedSecret := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(providedSecret), []byte(secret)) != 1 {
+		logger.Warn("Invalid telegram webhook secret")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var update telegramUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		logger.Warn("Invalid telegram update", "error", err)
+		// Отвечаем 200, иначе Telegram будет бесконечно повторять некорректное обновление
+		c.Status(http.StatusOK)
+		return
+	}
+
+	ctx := c.Request.Context()
+	switch {
+	case update.CallbackQuery != nil:
+		handleTelegramCallback(ctx, bot, update)
+	case update.Message != nil:
+		locale := i18n.Normalize(update.Message.From.LanguageCode)
+		handleTelegramLinkMessage(ctx, bot, update.Message.Chat.ID, update.Message.Text, locale)
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// handleTelegramLinkMessage привязывает чат к пользователю по коду из сообщения ("/start CODE" или "CODE")
+func handleTelegramLinkMessage(ctx context.Context, bot *notifier.TelegramBot, chatID int64, text, locale string) {
+	code := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "/start")))
+	if code == "" {
+		replyTelegram(ctx, bot, chatID, i18n.T(locale, "telegram.send_link_code", nil))
+		return
+	}
+
+	redisKey := fmt.Sprintf("telegram_link_code:%s", code)
+	userIDStr, err := db.RedisClient.GetDel(ctx, redisKey).Result()
+	if err == redis.Nil {
+		replyTelegram(ctx, bot, chatID, i18n.T(locale, "telegram.link_code_not_found", nil))
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to read telegram link code", "error", err)
+		replyTelegram(ctx, bot, chatID, i18n.T(locale, "telegram.link_failed", nil))
+		return
+	}
+
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		logger.Error("Invalid user ID stored for telegram link code", "value", userIDStr)
+		return
+	}
+
+	err = db.GormDB.Transaction(func(tx *gorm.DB) error {
+		// Один чат может быть привязан только к одному аккаунту
+		if err := tx.Model(&models.User{}).Where("telegram_chat_id = ? AND id <> ?", chatID, userID).Update("telegram_chat_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("telegram_chat_id", chatID).Error
+	})
+	if err != nil {
+		logger.Error("Failed to link telegram chat", "userID", userID, "error", err)
+		replyTelegram(ctx, bot, chatID, i18n.T(locale, "telegram.link_failed", nil))
+		return
+	}
+
+	logger.Info("Telegram chat linked", "userID", userID)
+	replyTelegram(ctx, bot, chatID, i18n.T(locale, "telegram.linked", nil))
+}
+
+// handleTelegramCallback обрабатывает нажатия кнопок "Оплачено" / "Отложить на 1 день"
+func handleTelegramCallback(ctx context.Context, bot *notifier.TelegramBot, update telegramUpdate) {
+	query := update.CallbackQuery
+	locale := i18n.Normalize(query.From.LanguageCode)
+	if query.Message == nil {
+		answerTelegramCallback(ctx, bot, query.ID, i18n.T(locale, "telegram.action_unavailable", nil))
+		return
+	}
+
+	action, subscriptionIDStr, found := strings.Cut(query.Data, ":")
+	subscriptionID, err := strconv.Atoi(subscriptionIDStr)
+	if !found || err != nil {
+		logger.Warn("Invalid telegram callback data", "data", query.Data)
+		answerTelegramCallback(ctx, bot, query.ID, i18n.T(locale, "telegram.action_unavailable", nil))
+		return
+	}
+
+	// Пользователь определяется по чату, из которого нажата кнопка
+	var user models.User
+	if err := db.GormDB.Where("telegram_chat_id = ?", query.Message.Chat.ID).First(&user).Error; err != nil {
+		logger.Warn("Telegram callback from unlinked chat")
+		answerTelegramCallback(ctx, bot, query.ID, i18n.T(locale, "telegram.chat_not_linked", nil))
+		return
+	}
+	locale = i18n.Normalize(user.Locale)
+
+	var answer string
+	switch action {
+	case notifier.TelegramActionPaid:
+		err = applyReminderAction(int(user.ID), subscriptionID, 0, reminderActionPaid, time.Time{})
+		answer = i18n.T(locale, "telegram.marked_paid", nil)
+	case notifier.TelegramActionSnooze:
+		err = applyReminderAction(int(user.ID), subscriptionID, 0, reminderActionSnooze, time.Now().UTC().Add(24*time.Hour))
+		answer = i18n.T(locale, "telegram.snoozed", nil)
+	default:
+		err = errUnknownReminderAction
+	}
+
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, errUnknownReminderAction) {
+			logger.Error("Failed to apply telegram reminder action", "userID", user.ID, "subscriptionID", subscriptionID, "error", err)
+		}
+		answerTelegramCallback(ctx, bot, query.ID, i18n.T(locale, "telegram.action_unavailable", nil))
+		return
+	}
+
+	answerTelegramCallback(ctx, bot, query.ID, answer)
+}
+
+// replyTelegram отправляет ответ в чат, ошибки только логируются
+func replyTelegram(ctx context.Context, bot *notifier.TelegramBot, chatID int64, text string) {
+	if err := bot.SendMessage(ctx, chatID, text, nil); err != nil {
+		logger.Warn("Failed to reply in telegram", "error", err)
+	}
+}
+
+// answerTelegramCallback отвечает на нажатие кнопки, ошибки только логируются
+func answerTelegramCallback(ctx context.Context, bot *notifier.TelegramBot, callbackQueryID, text string) {
+	if err := bot.AnswerCallbackQuery(ctx, callbackQueryID, text); err != nil {
+		logger.Warn("Failed to answer telegram callback", "error", err)
+	}
+}
+
+// generateTelegramLinkCode создаёт случайный 8-символьный код привязки
+func generateTelegramLinkCode() (string, error) {
+	code := make([]byte, 8)
+	alphabetLen := big.NewInt(int64(len(telegramLinkCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabetLen)
+		if err != nil {
+			return "", err
+		}
+		code[i] = telegramLinkCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
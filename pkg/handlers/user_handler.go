@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/SergeyMilch/pay_aware/internal/config"
+	"github.com/SergeyMilch/pay_aware/internal/i18n"
 	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
 	"github.com/SergeyMilch/pay_aware/pkg/auth"
 	"github.com/SergeyMilch/pay_aware/pkg/db"
 	"github.com/SergeyMilch/pay_aware/pkg/models"
@@ -41,6 +43,23 @@ func CreateUser(c *gin.Context) {
         return
     }
 
+    // Язык можно передать явно, иначе определяем его по Accept-Language
+    if user.Locale != "" && !i18n.IsSupported(user.Locale) {
+        logger.Warn("Unsupported locale provided", "locale", user.Locale)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale"})
+        return
+    }
+    if user.Locale == "" {
+        user.Locale = i18n.FromAcceptLanguage(c.GetHeader("Accept-Language"))
+    }
+
+    // Часовой пояс можно передать при регистрации (по умолчанию UTC)
+    if user.TimeZone != "" && !utils.IsValidTimeZone(user.TimeZone) {
+        logger.Warn("Unsupported time zone provided", "timeZone", user.TimeZone)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported time zone"})
+        return
+    }
+
     // Валидация пароля
     if user.Password == "" || !utils.IsValidPassword(user.Password) {
         logger.Warn("Invalid password provided")
@@ -84,6 +103,7 @@ func CreateUser(c *gin.Context) {
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
     } else {
+        recordAuditEvent(c, int(user.ID), "user.created")
         logger.Info("User created successfully", "userID", user.ID)
     }
 }
@@ -164,7 +184,8 @@ func GetUserByID(c *gin.Context) {
     })
 }
 
-// UpdateDeviceToken обновляет токен устройства пользователя
+// UpdateDeviceToken регистрирует устройство пользователя или обновляет его данные.
+// Токен уникален: если он был привязан к другому аккаунту (смена пользователя на устройстве), устройство переходит к текущему.
 func UpdateDeviceToken(c *gin.Context) {
     userID, exists := c.Get("userID")
     if !exists {
@@ -185,6 +206,9 @@ func UpdateDeviceToken(c *gin.Context) {
 
     var request struct {
         DeviceToken string `json:"device_token"`
+        Platform    string `json:"platform"`
+        AppVersion  string `json:"app_version"`
+        Name        string `json:"name"`
     }
 
     if err := c.ShouldBindJSON(&request); err != nil {
@@ -206,15 +230,168 @@ func UpdateDeviceToken(c *gin.Context) {
         return
     }
 
-    user.DeviceToken = request.DeviceToken
-    if err := db.GormDB.Save(&user).Error; err != nil {
+    var device models.Device
+    err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+        err := tx.Where("token = ?", request.DeviceToken).First(&device).Error
+        if err != nil && err != gorm.ErrRecordNotFound {
+            return err
+        }
+        if device.ID != 0 && device.UserID != userIDInt {
+            logger.Info("Device moved to another user", "deviceID", device.ID, "fromUserID", device.UserID, "toUserID", userIDInt)
+        }
+
+        device.UserID = userIDInt
+        device.Token = request.DeviceToken
+        if request.Platform != "" {
+            device.Platform = request.Platform
+        }
+        if request.AppVersion != "" {
+            device.AppVersion = request.AppVersion
+        }
+        if request.Name != "" {
+            device.Name = request.Name
+        }
+        device.LastSeenAt = time.Now().UTC()
+        return tx.Save(&device).Error
+    })
+    if err != nil {
         logger.Error("Failed to update device token", "userID", userIDInt, "error", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update device token"})
         return
     }
 
-    logger.Debug("Device token updated successfully", "userID", userIDInt)
-    c.JSON(http.StatusOK, gin.H{"message": "Device token updated successfully"})
+    logger.Debug("Device token updated successfully", "userID", userIDInt, "deviceID", device.ID)
+    c.JSON(http.StatusOK, gin.H{
+        "message":      "Device token updated successfully",
+        "device_id":    device.ID,
+        "device_token": device.Token,
+    })
+}
+
+// UpdateNotificationChannel меняет предпочтительный канал доставки уведомлений ("push" или "email")
+func UpdateNotificationChannel(c *gin.Context) {
+    userID, exists := c.Get("userID")
+    if !exists {
+        logger.Warn("User ID is missing in context")
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    userIDInt, ok := userID.(int)
+    if !ok {
+        logger.Error("Invalid user ID type in context")
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+        return
+    }
+
+    var request struct {
+        Channel string `json:"channel"`
+    }
+
+    if err := c.ShouldBindJSON(&request); err != nil {
+        logger.Warn("Invalid notification channel request", "error", err)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    if !notifier.IsSupported(request.Channel) || !notifier.IsPersonalChannel(request.Channel) {
+        logger.Warn("Unsupported notification channel", "userID", userIDInt, "channel", request.Channel)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported notification channel"})
+        return
+    }
+
+    if err := db.GormDB.Model(&models.User{}).Where("id = ?", userIDInt).Update("notification_channel", request.Channel).Error; err != nil {
+        logger.Error("Failed to update notification channel", "userID", userIDInt, "error", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update notification channel"})
+        return
+    }
+
+    logger.Debug("Notification channel updated successfully", "userID", userIDInt, "channel", request.Channel)
+    c.JSON(http.StatusOK, gin.H{"message": "Notification channel updated successfully", "channel": request.Channel})
+}
+
+// UpdateLocale меняет язык уведомлений и писем пользователя
+func UpdateLocale(c *gin.Context) {
+    userID, exists := c.Get("userID")
+    if !exists {
+        logger.Warn("User ID is missing in context")
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    userIDInt, ok := userID.(int)
+    if !ok {
+        logger.Error("Invalid user ID type in context")
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+        return
+    }
+
+    var request struct {
+        Locale string `json:"locale"`
+    }
+
+    if err := c.ShouldBindJSON(&request); err != nil {
+        logger.Warn("Invalid locale request", "error", err)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    if !i18n.IsSupported(request.Locale) {
+        logger.Warn("Unsupported locale", "userID", userIDInt, "locale", request.Locale)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale", "supported_locales": i18n.SupportedLocales})
+        return
+    }
+
+    if err := db.GormDB.Model(&models.User{}).Where("id = ?", userIDInt).Update("locale", request.Locale).Error; err != nil {
+        logger.Error("Failed to update locale", "userID", userIDInt, "error", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update locale"})
+        return
+    }
+
+    logger.Debug("Locale updated successfully", "userID", userIDInt, "locale", request.Locale)
+    c.JSON(http.StatusOK, gin.H{"message": "Locale updated successfully", "locale": request.Locale})
+}
+
+// UpdateTimeZone меняет часовой пояс пользователя (IANA, например "Europe/Moscow")
+func UpdateTimeZone(c *gin.Context) {
+    userID, exists := c.Get("userID")
+    if !exists {
+        logger.Warn("User ID is missing in context")
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+        return
+    }
+
+    userIDInt, ok := userID.(int)
+    if !ok {
+        logger.Error("Invalid user ID type in context")
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+        return
+    }
+
+    var request struct {
+        TimeZone string `json:"time_zone"`
+    }
+
+    if err := c.ShouldBindJSON(&request); err != nil {
+        logger.Warn("Invalid time zone request", "error", err)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    if !utils.IsValidTimeZone(request.TimeZone) {
+        logger.Warn("Unsupported time zone", "userID", userIDInt, "timeZone", request.TimeZone)
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported time zone"})
+        return
+    }
+
+    if err := db.GormDB.Model(&models.User{}).Where("id = ?", userIDInt).Update("time_zone", request.TimeZone).Error; err != nil {
+        logger.Error("Failed to update time zone", "userID", userIDInt, "error", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update time zone"})
+        return
+    }
+
+    logger.Debug("Time zone updated successfully", "userID", userIDInt, "timeZone", request.TimeZone)
+    c.JSON(http.StatusOK, gin.H{"message": "Time zone updated successfully", "time_zone": request.TimeZone})
 }
 
 // LoginUser аутентифицирует пользователя и выдает JWT токен
@@ -264,6 +441,7 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
+	recordAuditEvent(c, int(user.ID), "user.login")
 	logger.Debug("User logged in successfully", "userID", user.ID)
 	c.JSON(http.StatusOK, gin.H{
 		"token":   token,
@@ -321,6 +499,7 @@ func SetPin(c *gin.Context) {
         return
     }
 
+    recordAuditEvent(c, userIDInt, "user.pin_set")
     logger.Debug("PIN code set successfully", "userID", userIDInt)
     c.JSON(http.StatusOK, gin.H{"message": "PIN code set successfully"})
 }
@@ -365,6 +544,7 @@ func LoginWithPin(c *gin.Context) {
         return
     }
 
+    recordAuditEvent(c, int(user.ID), "user.login_pin")
     logger.Debug("User logged in successfully with PIN", "userID", user.ID)
     c.JSON(http.StatusOK, gin.H{
         "token":   token,
@@ -372,7 +552,9 @@ func LoginWithPin(c *gin.Context) {
     })
 }
 
-// LogoutUser сбрасывает device_token у пользователя, чтобы пуши не приходили
+// LogoutUser удаляет текущее устройство пользователя, чтобы пуши на него больше не приходили.
+// Устройство определяется по device_token в теле запроса; старые клиенты его не передают --
+// тогда, как и раньше, отвязываются все устройства.
 func LogoutUser(c *gin.Context) {
     userID, exists := c.Get("userID")
     if !exists {
@@ -388,6 +570,17 @@ func LogoutUser(c *gin.Context) {
         return
     }
 
+    var request struct {
+        DeviceToken string `json:"device_token"`
+    }
+    if c.Request.ContentLength > 0 {
+        if err := c.ShouldBindJSON(&request); err != nil {
+            logger.Warn("Invalid logout request", "error", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+    }
+
     // Ищем пользователя по userIDInt
     var user models.User
     if err := db.GormDB.First(&user, userIDInt).Error; err != nil {
@@ -396,10 +589,13 @@ func LogoutUser(c *gin.Context) {
         return
     }
 
-    // Обнуляем DeviceToken
-    user.DeviceToken = ""
-    if err := db.GormDB.Save(&user).Error; err != nil {
-        logger.Error("Failed to logout (clear device token)", "userID", userIDInt, "error", err)
+    // Удаляем только текущее устройство (или все, если клиент его не указал)
+    query := db.GormDB.Unscoped().Where("user_id = ?", userIDInt)
+    if request.DeviceToken != "" {
+        query = query.Where("token = ?", request.DeviceToken)
+    }
+    if err := query.Delete(&models.Device{}).Error; err != nil {
+        logger.Error("Failed to logout (remove device)", "userID", userIDInt, "error", err)
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to logout"})
         return
     }
@@ -407,6 +603,7 @@ func LogoutUser(c *gin.Context) {
     // Дополнительно, если нужно - можно добавить принудительное истечение JWT-токена,
     // но у вас это, скорее всего, просто на клиенте удалится.
 
+    recordAuditEvent(c, userIDInt, "user.logout")
     c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
 }
 
@@ -442,6 +639,14 @@ func DeleteUserAccount(c *gin.Context) {
         return
     }
 
+    // Снимаем с очереди напоминания по подпискам пользователя
+    if err := tx.Where("subscription_id IN (?)", tx.Unscoped().Model(&models.Subscription{}).Select("id").Where("user_id = ?", userIDInt)).Delete(&models.ReminderJob{}).Error; err != nil {
+        logger.Error("Failed to delete user reminder jobs", "userID", userIDInt, "error", err)
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete user subscriptions"})
+        return
+    }
+
     // Физически удаляем связанные Subscription (Unscoped)
     if err := tx.Unscoped().Where("user_id = ?", userIDInt).Delete(&models.Subscription{}).Error; err != nil {
         logger.Error("Failed to delete user subscriptions", "userID", userIDInt, "error", err)
@@ -450,6 +655,14 @@ func DeleteUserAccount(c *gin.Context) {
         return
     }
 
+    // Физически удаляем тикеты push-уведомлений (в них хранятся токены устройств)
+    if err := tx.Unscoped().Where("notification_id IN (?)", tx.Model(&models.Notification{}).Select("id").Where("user_id = ?", userIDInt)).Delete(&models.PushTicket{}).Error; err != nil {
+        logger.Error("Failed to delete user push tickets", "userID", userIDInt, "error", err)
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete user notifications"})
+        return
+    }
+
     // Физически удаляем связанные Notification (подстраховка)
     if err := tx.Unscoped().Where("user_id = ?", userIDInt).Delete(&models.Notification{}).Error; err != nil {
         logger.Error("Failed to delete user notifications", "userID", userIDInt, "error", err)
@@ -458,6 +671,60 @@ func DeleteUserAccount(c *gin.Context) {
         return
     }
 
+    // Физически удаляем журнал аудита пользователя
+    if err := tx.Unscoped().Where("user_id = ?", userIDInt).Delete(&models.AuditEvent{}).Error; err != nil {
+        logger.Error("Failed to delete user audit events", "userID", userIDInt, "error", err)
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete user audit events"})
+        return
+    }
+
+    // Физически удаляем webhook endpoint'ы и журнал их доставок
+    if err := tx.Unscoped().Where("endpoint_id IN (?)", tx.Model(&models.WebhookEndpoint{}).Select("id").Where("user_id = ?", userIDInt)).Delete(&models.WebhookDelivery{}).Error; err != nil {
+        logger.Error("Failed to delete user webhook deliveries", "userID", userIDInt, "error", err)
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete user webhooks"})
+        return
+    }
+    if err := tx.Unscoped().Where("user_id = ?", userIDInt).Delete(&models.WebhookEndpoint{}).Error; err != nil {
+        logger.Error("Failed to delete user webhook endpoints", "userID", userIDInt, "error", err)
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete user webhooks"})
+        return
+    }
+
+    // Физически удаляем устройства пользователя
+    if err := tx.Unscoped().Where("user_id = ?", userIDInt).Delete(&models.Device{}).Error; err != nil {
+        logger.Error("Failed to delete user devices", "userID", userIDInt, "error", err)
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete user devices"})
+        return
+    }
+
+    // Физически удаляем настройки уведомлений
+    if err := tx.Unscoped().Where("user_id = ?", userIDInt).Delete(&models.NotificationPreference{}).Error; err != nil {
+        logger.Error("Failed to delete user notification preferences", "userID", userIDInt, "error", err)
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete user notification preferences"})
+        return
+    }
+
+    // Физически удаляем подписки браузеров на Web Push
+    if err := tx.Unscoped().Where("user_id = ?", userIDInt).Delete(&models.WebPushSubscription{}).Error; err != nil {
+        logger.Error("Failed to delete user web push subscriptions", "userID", userIDInt, "error", err)
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete user web push subscriptions"})
+        return
+    }
+
+    // Удаляем выгрузки персональных данных вместе с архивами
+    if err := tx.Unscoped().Where("user_id = ?", userIDInt).Delete(&models.DataExport{}).Error; err != nil {
+        logger.Error("Failed to delete user data exports", "userID", userIDInt, "error", err)
+        tx.Rollback()
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete user data exports"})
+        return
+    }
+
     // Коммит транзакции
     if err := tx.Commit().Error; err != nil {
         logger.Error("Failed to commit transaction", "error", err)
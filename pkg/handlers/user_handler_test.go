@@ -68,7 +68,7 @@ func TestUpdateDeviceToken(t *testing.T) {
 
     db.InitRedis()
     db.InitTestPostgres()
-    db.GormDB.AutoMigrate(&models.User{})
+    db.GormDB.AutoMigrate(&models.User{}, &models.Device{})
     router.PUT("/users/device-token", handlers.UpdateDeviceToken)
 
     // Добавляем тестового пользователя
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/notifier"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// webPushSubscriptionRequest -- результат PushSubscription.toJSON() из браузера
+type webPushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// GetVAPIDPublicKey возвращает публичный VAPID-ключ для pushManager.subscribe в браузере
+func GetVAPIDPublicKey(c *gin.Context) {
+	publicKey := notifier.VAPIDPublicKey()
+	if publicKey == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Web push notifications are not configured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"public_key": publicKey})
+}
+
+// RegisterWebPushSubscription сохраняет подписку браузера. Повторная регистрация того же endpoint'а
+// обновляет ключи и переносит подписку на текущего пользователя.
+func RegisterWebPushSubscription(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if notifier.VAPIDPublicKey() == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Web push notifications are not configured"})
+		return
+	}
+
+	var request webPushSubscriptionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Warn("Invalid web push subscription request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := notifier.ValidateWebPushEndpoint(request.Endpoint); err != nil {
+		logger.Warn("Invalid web push subscription endpoint", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Endpoint must be a push service URL"})
+		return
+	}
+	if err := notifier.ValidateWebPushKeys(request.Keys.P256dh, request.Keys.Auth); err != nil {
+		logger.Warn("Invalid web push subscription keys", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription keys"})
+		return
+	}
+
+	var subscription models.WebPushSubscription
+	err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("endpoint = ?", request.Endpoint).First(&subscription).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		subscription.UserID = userIDInt
+		subscription.Endpoint = request.Endpoint
+		subscription.P256dh = request.Keys.P256dh
+		subscription.Auth = request.Keys.Auth
+		subscription.UserAgent = c.Request.UserAgent()
+		return tx.Save(&subscription).Error
+	})
+	if err != nil {
+		logger.Error("Failed to save web push subscription", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to save web push subscription"})
+		return
+	}
+
+	logger.Info("Web push subscription registered", "userID", userIDInt, "subscriptionID", subscription.ID)
+	c.JSON(http.StatusCreated, subscription)
+}
+
+// DeleteWebPushSubscription удаляет подписку браузера (например, при pushSubscription.unsubscribe())
+func DeleteWebPushSubscription(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var request struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Endpoint == "" {
+		logger.Warn("Invalid web push unsubscribe request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	result := db.GormDB.Unscoped().Where("user_id = ? AND endpoint = ?", userIDInt, request.Endpoint).Delete(&models.WebPushSubscription{})
+	if result.Error != nil {
+		logger.Error("Failed to delete web push subscription", "userID", userIDInt, "error", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete web push subscription"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Web push subscription not found"})
+		return
+	}
+
+	logger.Info("Web push subscription deleted", "userID", userIDInt)
+	c.JSON(http.StatusOK, gin.H{"message": "Web push subscription deleted successfully"})
+}
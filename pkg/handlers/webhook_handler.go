@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/internal/netguard"
+	"github.com/SergeyMilch/pay_aware/internal/webhook"
+	"github.com/SergeyMilch/pay_aware/pkg/db"
+	"github.com/SergeyMilch/pay_aware/pkg/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxWebhookEndpoints -- ограничение на количество endpoint'ов у одного пользователя
+const maxWebhookEndpoints = 10
+
+// webhookEndpointRequest -- тело запроса на создание/изменение endpoint'а
+type webhookEndpointRequest struct {
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// CreateWebhookEndpoint регистрирует новый endpoint. Секрет для проверки подписи возвращается только здесь.
+func CreateWebhookEndpoint(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var request webhookEndpointRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Warn("Invalid webhook endpoint request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if errMsg := validateWebhookEndpointRequest(c.Request.Context(), request); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	var count int64
+	if err := db.GormDB.Model(&models.WebhookEndpoint{}).Where("user_id = ?", userIDInt).Count(&count).Error; err != nil {
+		logger.Error("Failed to count webhook endpoints", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook endpoint"})
+		return
+	}
+	if count >= maxWebhookEndpoints {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many webhook endpoints"})
+		return
+	}
+
+	secret, err := webhook.GenerateSecret()
+	if err != nil {
+		logger.Error("Failed to generate webhook secret", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook endpoint"})
+		return
+	}
+
+	endpoint := models.WebhookEndpoint{
+		UserID:  userIDInt,
+		URL:     request.URL,
+		Secret:  secret,
+		Events:  request.Events,
+		Enabled: true,
+	}
+	if err := db.GormDB.Create(&endpoint).Error; err != nil {
+		logger.Error("Failed to create webhook endpoint", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook endpoint"})
+		return
+	}
+
+	logger.Info("Webhook endpoint created", "userID", userIDInt, "endpointID", endpoint.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"endpoint": endpoint,
+		"secret":   secret,
+	})
+}
+
+// GetWebhookEndpoints возвращает endpoint'ы пользователя
+func GetWebhookEndpoints(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var endpoints []models.WebhookEndpoint
+	if err := db.GormDB.Where("user_id = ?", userIDInt).Order("id").Find(&endpoints).Error; err != nil {
+		logger.Error("Failed to get webhook endpoints", "userID", userIDInt, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook endpoints"})
+		return
+	}
+
+	c.JSON(http.StatusOK, endpoints)
+}
+
+// UpdateWebhookEndpoint меняет адрес, события или включает endpoint обратно после автоотключения
+func UpdateWebhookEndpoint(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	endpoint, found := findUserWebhookEndpoint(c, userIDInt)
+	if !found {
+		return
+	}
+
+	var request webhookEndpointRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Warn("Invalid webhook endpoint request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if errMsg := validateWebhookEndpointRequest(c.Request.Context(), request); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	endpoint.URL = request.URL
+	endpoint.Events = request.Events
+	if request.Enabled != nil {
+		endpoint.Enabled = *request.Enabled
+		if endpoint.Enabled {
+			// Ручное включение сбрасывает счётчик ошибок
+			endpoint.ConsecutiveFailures = 0
+			endpoint.DisabledAt = nil
+		}
+	}
+
+	if err := db.GormDB.Save(&endpoint).Error; err != nil {
+		logger.Error("Failed to update webhook endpoint", "endpointID", endpoint.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook endpoint"})
+		return
+	}
+
+	logger.Debug("Webhook endpoint updated", "userID", userIDInt, "endpointID", endpoint.ID)
+	c.JSON(http.StatusOK, endpoint)
+}
+
+// DeleteWebhookEndpoint удаляет endpoint вместе с журналом доставок
+func DeleteWebhookEndpoint(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	endpoint, found := findUserWebhookEndpoint(c, userIDInt)
+	if !found {
+		return
+	}
+
+	err := db.GormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("endpoint_id = ?", endpoint.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&endpoint).Error
+	})
+	if err != nil {
+		logger.Error("Failed to delete webhook endpoint", "endpointID", endpoint.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook endpoint"})
+		return
+	}
+
+	logger.Info("Webhook endpoint deleted", "userID", userIDInt, "endpointID", endpoint.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook endpoint deleted successfully"})
+}
+
+// GetWebhookDeliveries возвращает журнал доставок endpoint'а (последние сначала)
+func GetWebhookDeliveries(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		logger.Warn("User ID is missing in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		logger.Error("Invalid user ID type in context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	endpoint, found := findUserWebhookEndpoint(c, userIDInt)
+	if !found {
+		return
+	}
+
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 || parsed > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+			return
+		}
+		limit = parsed
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := db.GormDB.Where("endpoint_id = ?", endpoint.ID).
+		Order("created_at desc").
+		Limit(limit).
+		Find(&deliveries).Error; err != nil {
+		logger.Error("Failed to get webhook deliveries", "endpointID", endpoint.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// findUserWebhookEndpoint ищет endpoint из URL-параметра :id и проверяет владельца.
+// При ошибке сам пишет ответ и возвращает found == false.
+func findUserWebhookEndpoint(c *gin.Context, userID int) (models.WebhookEndpoint, bool) {
+	var endpoint models.WebhookEndpoint
+
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook endpoint ID"})
+		return endpoint, false
+	}
+
+	if err := db.GormDB.Where("id = ? AND user_id = ?", endpointID, userID).First(&endpoint).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook endpoint not found"})
+			return endpoint, false
+		}
+		logger.Error("Failed to retrieve webhook endpoint", "endpointID", endpointID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhook endpoint"})
+		return endpoint, false
+	}
+
+	return endpoint, true
+}
+
+// validateWebhookEndpointRequest проверяет URL и список событий, возвращает текст ошибки или ""
+func validateWebhookEndpointRequest(ctx context.Context, request webhookEndpointRequest) string {
+	parsed, err := url.Parse(request.URL)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return "Webhook URL must be a valid https URL"
+	}
+	// Сервер не должен отправлять запросы во внутреннюю сеть (SSRF)
+	if err := netguard.CheckHost(ctx, parsed.Hostname()); err != nil {
+		logger.Warn("Rejected webhook URL", "host", parsed.Hostname(), "error", err)
+		return "Webhook URL must point to a public address"
+	}
+
+	if len(request.Events) == 0 {
+		return "At least one event is required"
+	}
+	for _, event := range request.Events {
+		if !webhook.IsSupportedEvent(event) {
+			return "Unsupported event: " + event
+		}
+	}
+	return ""
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// AuditEvent фиксирует значимые действия пользователя (вход, смена пароля и т.п.)
+type AuditEvent struct {
+    gorm.Model
+    UserID    int    `json:"user_id" gorm:"index"`
+    Action    string `json:"action"`     // Тип события, например "user.login"
+    IP        string `json:"ip"`
+    UserAgent string `json:"user_agent"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DataExport описывает запрос пользователя на выгрузку персональных данных
+type DataExport struct {
+    gorm.Model
+    UserID    int        `json:"user_id" gorm:"index"`
+    Token     string     `json:"-" gorm:"uniqueIndex"` // Секрет для ссылки на скачивание архива
+    Status    string     `json:"status"`               // "pending", "ready", "failed" или "expired"
+    Archive   []byte     `json:"-"` // ZIP-архив; хранится в БД, чтобы его можно было скачать через любой экземпляр
+    ExpiresAt time.Time  `json:"expires_at" gorm:"type:timestamptz;index"`
+    StartedAt *time.Time `json:"-" gorm:"type:timestamptz"` // Когда сборку взял обработчик; nil -- ещё в очереди
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// DeadLetter -- сообщение Kafka, которое не удалось обработать за все попытки (или которое нельзя обработать вовсе).
+// Хранится с исходными данными и последней ошибкой, чтобы его можно было разобрать и отправить повторно.
+type DeadLetter struct {
+    ID         uint       `json:"id" gorm:"primaryKey"`
+    Topic      string     `json:"topic" gorm:"index"` // Исходный топик: туда сообщение уходит при повторной отправке
+    MessageKey string     `json:"message_key"`
+    Payload    string     `json:"payload" gorm:"type:text"`
+    Error      string     `json:"error" gorm:"type:text"`
+    Attempts   int        `json:"attempts"` // Сколько раз сообщение обрабатывалось
+    ReplayedAt *time.Time `json:"replayed_at" gorm:"type:timestamptz"`
+    CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Device -- мобильное устройство пользователя, на которое отправляются push-уведомления Expo
+type Device struct {
+    gorm.Model
+    UserID     int       `json:"user_id" gorm:"index"`
+    Token      string    `json:"-" gorm:"uniqueIndex"` // Expo push token (ExponentPushToken[...])
+    Platform   string    `json:"platform"` // "ios" или "android"
+    AppVersion string    `json:"app_version"`
+    Name       string    `json:"name"` // Название устройства для списка в настройках, например "iPhone Анны"
+    LastSeenAt time.Time `json:"last_seen_at" gorm:"type:timestamptz"` // Когда приложение последний раз регистрировало токен
+}
@@ -13,7 +13,19 @@ type Notification struct {
     Message        string    `json:"message"`
     SentAt         time.Time `json:"sent_at" gorm:"type:timestamptz;index:idx_subscription_user_sentat"` // Время отправки уведомления
     Status         string    `json:"status" gorm:"index:idx_user_status"` // Статус отправки (например, "success" или "failed")
+    Channel        string    `json:"channel"` // Канал, через который доставлено уведомление ("push", "email")
     ReadAt         *time.Time `json:"read_at" gorm:"type:timestamptz;index"` // Для истории уведомлений (пометки прочитанным)
+    PaidAt         *time.Time `json:"paid_at" gorm:"type:timestamptz"` // Пользователь подтвердил оплату по напоминанию
+    DeliveryStatus string    `json:"delivery_status,omitempty" gorm:"index"` // Статус доставки push по квитанциям: "delivered", если доставлено хотя бы на одно устройство
+    FailureReason  string    `json:"failure_reason,omitempty"` // Код ошибки из квитанции Expo (например, "DeviceNotRegistered")
+    Missed         bool      `json:"missed,omitempty"` // Напоминание отправлено с опозданием больше допустимого (после простоя сервиса)
+    IdempotencyKey *string   `json:"idempotency_key,omitempty" gorm:"uniqueIndex"` // Ключ напоминания за период: повторная доставка того же сообщения не создаёт второе уведомление
 
     Subscription   Subscription `json:"subscription" gorm:"foreignKey:SubscriptionID"`
 }
+
+// VisibleNotifications -- условие для истории и счётчика непрочитанных: записи, отправка которых ещё идёт
+// ("sending") или не удалась ("failed"), пользователю не показываются -- напоминание до него не дошло
+func VisibleNotifications(db *gorm.DB) *gorm.DB {
+    return db.Where("status NOT IN ?", []string{"sending", "failed"})
+}
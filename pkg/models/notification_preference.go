@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NotificationPreference -- настройки доставки уведомлений пользователя
+type NotificationPreference struct {
+    gorm.Model
+    UserID               int                 `json:"user_id" gorm:"uniqueIndex"`
+    EnabledChannels      []string            `json:"enabled_channels" gorm:"serializer:json"` // Разрешённые каналы: "push", "webpush", "telegram", "email", "webhook"
+    EventChannels        map[string][]string `json:"event_channels" gorm:"serializer:json"` // Тип события -> каналы, например "reminder.due": ["push"]
+    HighPriorityChannels []string            `json:"high_priority_channels" gorm:"serializer:json"` // Каналы для напоминаний по подпискам с HighPriority
+    QuietHoursStart      string              `json:"quiet_hours_start"` // Начало тихих часов по местному времени, "ЧЧ:ММ" (пусто -- выключены)
+    QuietHoursEnd        string              `json:"quiet_hours_end"`   // Конец тихих часов, "ЧЧ:ММ"; интервал может переходить через полночь
+    DigestFrequency      string              `json:"digest_frequency"` // Сводка по email: "weekly", "monthly" или "" (выключена)
+    LastDigestAt         *time.Time          `json:"last_digest_at" gorm:"type:timestamptz"` // Когда последний раз отправлена сводка
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// OutboxMessage -- сообщение для Kafka, записанное в той же транзакции, что и изменение данных.
+// Relay отправляет его после коммита, поэтому данные и сообщение не расходятся при падении сервиса.
+type OutboxMessage struct {
+    ID             uint       `json:"id" gorm:"primaryKey"`
+    Topic          string     `json:"topic"`
+    MessageKey     string     `json:"message_key"` // Ключ сообщения Kafka: сообщения одной подписки попадают в одну партицию
+    Payload        string     `json:"payload" gorm:"type:text"`
+    Headers        string     `json:"headers,omitempty" gorm:"type:text"` // Заголовки сообщения Kafka в JSON
+    IdempotencyKey *string    `json:"idempotency_key,omitempty" gorm:"uniqueIndex"` // Второе сообщение с тем же ключом не записывается
+    Attempts       int        `json:"attempts"`
+    NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"type:timestamptz;index"` // Когда relay может забрать сообщение; пока оно у relay -- до какого момента действует захват
+    LeaseToken     string     `json:"-"`
+    LastError      string     `json:"last_error"`
+    SentAt         *time.Time `json:"sent_at" gorm:"type:timestamptz;index"`
+    CreatedAt      time.Time  `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// PushTicket -- тикет Expo, выданный на отправку уведомления одному устройству.
+// По нему позже запрашивается квитанция о доставке.
+type PushTicket struct {
+    gorm.Model
+    NotificationID uint   `json:"notification_id" gorm:"index"`
+    DeviceID       uint   `json:"device_id" gorm:"index"`
+    Token          string `json:"-"` // Токен устройства на момент отправки (чтобы удалить его, если квитанция вернёт DeviceNotRegistered)
+    TicketID       string `json:"ticket_id" gorm:"index"`
+    Status         string `json:"status" gorm:"index"` // "pending", "delivered" или "failed"
+    FailureReason  string `json:"failure_reason,omitempty"`
+}
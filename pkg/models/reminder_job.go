@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// ReminderJob -- задача очереди напоминаний: отправить напоминание по подписке в RunAt.
+// На подписку приходится не больше одной задачи каждого вида.
+type ReminderJob struct {
+    ID             uint      `json:"id" gorm:"primaryKey"`
+    SubscriptionID uint      `json:"subscription_id" gorm:"uniqueIndex:idx_reminder_job_subscription_kind"`
+    Kind           string    `json:"kind" gorm:"uniqueIndex:idx_reminder_job_subscription_kind"` // "reminder" -- по notification_date, "snooze" -- повтор по snoozed_until
+    RunAt          time.Time `json:"run_at" gorm:"type:timestamptz;index"` // Когда задачу можно забрать; пока она у воркера -- до какого момента действует захват
+    Attempts       int       `json:"attempts"`
+    LeaseToken     string    `json:"-" gorm:"index"` // Метка захвата: завершить задачу может только забравший её воркер
+    LastError      string    `json:"last_error"`
+    CreatedAt      time.Time `json:"created_at"`
+    UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -18,4 +18,6 @@ type Subscription struct {
     RecurrenceType    string         `json:"recurrence_type"` // Новое поле для указания типа повторения: "monthly", "yearly" или ""
     Tag               string         `json:"tag" gorm:"index:idx_tag"` // <-- добавляем для фильтра
     HighPriority      bool           `json:"high_priority"` // Новое поле для выбора типа уведомления
+    SnoozedUntil      *time.Time     `json:"snoozed_until" gorm:"type:timestamptz;index"` // Повтор уже отправленного напоминания (дата платежа не сдвигается)
+    NotificationChannels []string    `json:"notification_channels,omitempty" gorm:"serializer:json"` // Каналы только для этой подписки (переопределяют настройки пользователя)
 }
@@ -9,8 +9,11 @@ type User struct {
     Name       string `json:"name"`
     Email      string `json:"email"` // убираем gorm:"uniqueIndex" и создаем в коде индекс записей, у которых deleted_at IS NULL
     Password   string `json:"password,omitempty"` // Принимаем пароль, но не передаем обратно
-    DeviceToken string `json:"device_token,omitempty" gorm:"index"`
     PinCode     string `json:"pin_code,omitempty"` // Добавляем поле для ПИН-кода
+    NotificationChannel string `json:"notification_channel" gorm:"default:push"` // Предпочтительный канал уведомлений: "push", "webpush", "telegram" или "email"
+    TelegramChatID int64 `json:"telegram_chat_id,omitempty" gorm:"index"` // ID чата с Telegram-ботом (0 -- не привязан)
+    Locale      string `json:"locale" gorm:"default:ru"` // Язык уведомлений и писем ("ru", "en"), при регистрации берётся из Accept-Language
+    TimeZone    string `json:"time_zone" gorm:"default:UTC"` // IANA-пояс, например "Europe/Moscow": тихие часы и сдвиг дат считаются по нему
 
     Subscriptions []Subscription `json:"subscriptions" gorm:"constraint:OnDelete:CASCADE;"`
 }
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// WebPushSubscription -- подписка браузера на Web Push (PushSubscription из Push API)
+type WebPushSubscription struct {
+    gorm.Model
+    UserID    int    `json:"user_id" gorm:"index"`
+    Endpoint  string `json:"endpoint" gorm:"uniqueIndex"` // URL push-сервиса браузера
+    P256dh    string `json:"-"` // Публичный ключ браузера (base64url), используется для шифрования
+    Auth      string `json:"-"` // Секрет аутентификации (base64url)
+    UserAgent string `json:"user_agent"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookEndpoint -- адрес пользователя, на который отправляются подписанные события
+type WebhookEndpoint struct {
+    gorm.Model
+    UserID              int        `json:"user_id" gorm:"index"`
+    URL                 string     `json:"url"`
+    Secret              string     `json:"-"` // Ключ HMAC-SHA256 для подписи запросов, отдаётся клиенту только при создании
+    Events              []string   `json:"events" gorm:"serializer:json"` // Типы событий, например "reminder.due"
+    Enabled             bool       `json:"enabled" gorm:"default:true"`
+    ConsecutiveFailures int        `json:"consecutive_failures"` // Подряд неуспешных доставок (после всех повторов)
+    DisabledAt          *time.Time `json:"disabled_at" gorm:"type:timestamptz"`
+}
+
+// WebhookDelivery -- попытка доставки события на endpoint (журнал доставок)
+type WebhookDelivery struct {
+    gorm.Model
+    EndpointID    uint       `json:"endpoint_id" gorm:"index"`
+    EventID       string     `json:"event_id" gorm:"index"`
+    Event         string     `json:"event"`
+    Payload       string     `json:"payload"`
+    Status        string     `json:"status" gorm:"index"` // "pending", "success" или "failed"
+    Attempts      int        `json:"attempts"`
+    NextAttemptAt *time.Time `json:"next_attempt_at" gorm:"type:timestamptz;index"`
+    ResponseCode  int        `json:"response_code"`
+    LastError     string     `json:"last_error"`
+    DeliveredAt   *time.Time `json:"delivered_at" gorm:"type:timestamptz"`
+}
@@ -15,4 +15,21 @@ func SendEmail(to, subject, body string) error {
 
     d := gomail.NewDialer(os.Getenv("SMTP_HOST"), 587, os.Getenv("SMTP_USER"), os.Getenv("SMTP_PASS"))
     return d.DialAndSend(m)
-}
\ No newline at end of file
+}
+
+// SendMultipartEmail отправляет письмо с HTML- и текстовой версиями и дополнительными заголовками
+// (например, List-Unsubscribe)
+func SendMultipartEmail(to, subject, htmlBody, textBody string, headers map[string]string) error {
+    m := gomail.NewMessage()
+    m.SetHeader("From", os.Getenv("SMTP_FROM"))
+    m.SetHeader("To", to)
+    m.SetHeader("Subject", subject)
+    for name, value := range headers {
+        m.SetHeader(name, value)
+    }
+    m.SetBody("text/plain", textBody)
+    m.AddAlternative("text/html", htmlBody)
+
+    d := gomail.NewDialer(os.Getenv("SMTP_HOST"), 587, os.Getenv("SMTP_USER"), os.Getenv("SMTP_PASS"))
+    return d.DialAndSend(m)
+}
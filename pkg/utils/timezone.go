@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+)
+
+// clockLayout -- формат времени начала и конца тихих часов
+const clockLayout = "15:04"
+
+// IsValidTimeZone проверяет, что строка -- известный IANA-пояс (например, "Europe/Moscow")
+func IsValidTimeZone(name string) bool {
+	if name == "" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// LoadUserLocation возвращает часовой пояс пользователя, при пустом или неизвестном поясе -- UTC
+func LoadUserLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		logger.Warn("Unknown user time zone, falling back to UTC", "timeZone", name, "error", err)
+		return time.UTC
+	}
+	return loc
+}
+
+// ParseClock разбирает время суток "ЧЧ:ММ" и возвращает количество минут от полуночи
+func ParseClock(value string) (int, error) {
+	parsed, err := time.Parse(clockLayout, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// NextAllowedTime возвращает t, если оно не попадает в тихие часы [start, end) по местному времени,
+// иначе -- момент окончания тихих часов (в UTC). Интервал может переходить через полночь ("22:00"-"08:00").
+// Пустые или совпадающие границы означают, что тихие часы выключены.
+func NextAllowedTime(t time.Time, loc *time.Location, start, end string) time.Time {
+	if start == "" || end == "" {
+		return t
+	}
+	startMinutes, err := ParseClock(start)
+	if err != nil {
+		return t
+	}
+	endMinutes, err := ParseClock(end)
+	if err != nil || startMinutes == endMinutes {
+		return t
+	}
+
+	local := t.In(loc)
+	minutes := local.Hour()*60 + local.Minute()
+
+	var quiet bool
+	if startMinutes < endMinutes {
+		quiet = minutes >= startMinutes && minutes < endMinutes
+	} else {
+		quiet = minutes >= startMinutes || minutes < endMinutes
+	}
+	if !quiet {
+		return t
+	}
+
+	allowed := time.Date(local.Year(), local.Month(), local.Day(), endMinutes/60, endMinutes%60, 0, 0, loc)
+	if !allowed.After(local) {
+		allowed = allowed.AddDate(0, 0, 1)
+	}
+	return allowed.UTC()
+}
+
+// AddRecurrence сдвигает дату на период повторения ("monthly" или "yearly") по календарю пользователя,
+// чтобы платёж оставался в тот же местный день и час независимо от смещения UTC и перехода на летнее время
+func AddRecurrence(t time.Time, recurrenceType string, loc *time.Location) time.Time {
+	local := t.In(loc)
+	switch recurrenceType {
+	case "monthly":
+		local = local.AddDate(0, 1, 0)
+	case "yearly":
+		local = local.AddDate(1, 0, 0)
+	}
+	return local.UTC()
+}
+
+// TomorrowAt возвращает момент (в UTC), когда по местному времени наступит следующий день в указанные часы и минуты.
+// Используется для "отложить до завтрашнего утра".
+func TomorrowAt(t time.Time, loc *time.Location, hour, minute int) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, hour, minute, 0, 0, loc).UTC()
+}
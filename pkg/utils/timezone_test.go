@@ -0,0 +1,73 @@
+package utils_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SergeyMilch/pay_aware/internal/logger"
+	"github.com/SergeyMilch/pay_aware/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("")
+	os.Exit(m.Run())
+}
+
+func TestNextAllowedTimeDefersInsideOvernightQuietHours(t *testing.T) {
+	moscow := utils.LoadUserLocation("Europe/Moscow")
+
+	// 03:00 по Москве -- внутри тихих часов 22:00-08:00
+	at := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	allowed := utils.NextAllowedTime(at, moscow, "22:00", "08:00")
+
+	assert.Equal(t, time.Date(2024, 3, 10, 5, 0, 0, 0, time.UTC), allowed)
+}
+
+func TestNextAllowedTimeMovesEveningReminderToNextMorning(t *testing.T) {
+	moscow := utils.LoadUserLocation("Europe/Moscow")
+
+	// 23:30 по Москве -> 08:00 следующего дня
+	at := time.Date(2024, 3, 10, 20, 30, 0, 0, time.UTC)
+	allowed := utils.NextAllowedTime(at, moscow, "22:00", "08:00")
+
+	assert.Equal(t, time.Date(2024, 3, 11, 5, 0, 0, 0, time.UTC), allowed)
+}
+
+func TestNextAllowedTimeKeepsTimeOutsideQuietHours(t *testing.T) {
+	at := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, at, utils.NextAllowedTime(at, time.UTC, "22:00", "08:00"))
+	assert.Equal(t, at, utils.NextAllowedTime(at, time.UTC, "", ""))
+}
+
+func TestAddRecurrenceKeepsLocalCalendarDay(t *testing.T) {
+	moscow := utils.LoadUserLocation("Europe/Moscow")
+
+	// 1 марта 00:30 по Москве -- это ещё 29 февраля по UTC
+	payment := time.Date(2024, 2, 29, 21, 30, 0, 0, time.UTC)
+	next := utils.AddRecurrence(payment, "monthly", moscow)
+
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 30, 0, 0, moscow), next.In(moscow))
+}
+
+func TestAddRecurrenceKeepsLocalHourAcrossDST(t *testing.T) {
+	berlin := utils.LoadUserLocation("Europe/Berlin")
+
+	// 10:00 зимнего времени -> 10:00 летнего времени через месяц
+	payment := time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC)
+	next := utils.AddRecurrence(payment, "monthly", berlin)
+
+	assert.Equal(t, time.Date(2024, 4, 15, 8, 0, 0, 0, time.UTC), next)
+}
+
+func TestTomorrowAtUsesLocalCalendarDay(t *testing.T) {
+	tokyo := utils.LoadUserLocation("Asia/Tokyo")
+
+	// 23:30 UTC 10 марта -- уже 08:30 11 марта в Токио, "завтра утром" -- 12 марта
+	at := time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC)
+	next := utils.TomorrowAt(at, tokyo, 9, 0)
+
+	assert.Equal(t, time.Date(2024, 3, 12, 9, 0, 0, 0, tokyo), next.In(tokyo))
+}